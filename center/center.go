@@ -2,8 +2,17 @@ package center
 
 import (
 	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"sync"
 
 	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/dedup"
+	_ "github.com/hysios/edgekv/mq/mqtt"
+	"github.com/hysios/edgekv/mq/mqtt/broker"
+	"github.com/hysios/edgekv/openapi"
+	_ "github.com/hysios/edgekv/store/memory"
 	"github.com/hysios/edgekv/store/redis"
 	"github.com/hysios/log"
 	"github.com/r3labs/diff/v2"
@@ -11,11 +20,21 @@ import (
 
 var RedisURI = "redis://127.0.0.1:6379?db=2"
 
+// BrokerPrefix 使用内嵌代理时 mqtt 队列的主题前缀
+var BrokerPrefix = "edgekv"
+
 type CenterServer struct {
 	store    edgekv.CenterStore
 	mq       edgekv.MessageQueue
 	listener edgekv.Listener
+	broker   *broker.Broker
+	ownMQ    bool
+	retain   bool
+	dedup    *dedup.Window
+	models   *openapi.Registry
 	done     chan struct{}
+	initOnce sync.Once
+	stopOnce sync.Once
 }
 
 var server = &CenterServer{}
@@ -32,43 +51,160 @@ func OpenEdge(edgeID edgekv.EdgeID) (edgekv.Database, error) {
 	return server.OpenEdge(edgeID), nil
 }
 
+// init 只执行一次，Start 通常在另外的 goroutine 中运行，Stop 也会调用
 func (serve *CenterServer) init() {
-	serve.done = make(chan struct{})
+	serve.initOnce.Do(func() {
+		serve.done = make(chan struct{})
+		if serve.dedup == nil {
+			serve.dedup = dedup.NewWindow(0)
+		}
+	})
 }
 
+// Start 阻塞直到 Stop, 启动失败时释放已经打开的资源并返回错误
 func (serve *CenterServer) Start() error {
-	var err error
 	serve.init()
 
+	if err := serve.start(); err != nil {
+		serve.Stop()
+		return err
+	}
+
+	<-serve.done
+	return nil
+}
+
+func (serve *CenterServer) start() error {
 	if serve.store == nil || serve.mq == nil {
 		return errors.New("don't open store or message queue")
 	}
 
 	go serve.listener.Start()
 
-	// 订阅中心同步频道
-	if err = serve.mq.Subscribe("sync", serve.syncProcess); err != nil {
+	// 订阅所有边缘节点的同步频道
+	if err := serve.mq.Subscribe(edgekv.UpWildcard(edgekv.TopicSync), serve.syncProcess); err != nil {
 		return err
 	}
 
-	// 订阅Binder频道
-	if err = serve.mq.Subscribe("binder", serve.binderProcess); err != nil {
+	// 订阅所有边缘节点的 Binder 频道
+	return serve.mq.Subscribe(edgekv.UpWildcard(edgekv.TopicBinder), serve.binderProcess)
+}
+
+// Stop 停止 Center, 可以重复调用
+func (serve *CenterServer) Stop() error {
+	var err error
+	serve.init()
+	serve.stopOnce.Do(func() {
+		close(serve.done)
+
+		if serve.ownMQ {
+			serve.mq.Close()
+		}
+
+		if serve.broker != nil {
+			serve.broker.Close()
+		}
+
+		if serve.dedup != nil {
+			serve.dedup.Close()
+		}
+		err = serve.listener.Close()
+	})
+	return err
+}
+
+// EnableBroker 在 Center 进程中启动内嵌的 MQTT 代理，监听在 addr 上，
+// 没有设置消息队列时，使用 mqtt 客户端连接到内嵌代理; 需要在 Start 之前调用
+func (serve *CenterServer) EnableBroker(addr string) error {
+	serve.broker = broker.NewBroker(addr)
+	return serve.startBroker()
+}
+
+// BrokerURI 返回内嵌代理的 mqtt 队列地址, 供 Edge 连接使用
+func (serve *CenterServer) BrokerURI() string {
+	if serve.broker == nil {
+		return ""
+	}
+	return serve.broker.URI(BrokerPrefix)
+}
+
+// EnableRetain 开启后 Center 把每个边缘节点模型的最新值以保留消息发布到
+// {ns}/down/desired/{model}, 边缘节点 (重新) 连接订阅时立即收到最新的配置，
+// 消息队列需要实现 edgekv.RetainPublisher
+func (serve *CenterServer) EnableRetain() {
+	serve.retain = true
+}
+
+// EnableDedup 把同步消息的去重窗口保存在 filename 中，最多保留 size 个消息 ID,
+// Center 重启之后已经应用过的重复消息不会再次应用，没有开启时使用内存中的窗口
+func (serve *CenterServer) EnableDedup(filename string, size int) error {
+	w, err := dedup.OpenWindow(filename, size)
+	if err != nil {
 		return err
 	}
-	<-serve.done
+
+	if serve.dedup != nil {
+		serve.dedup.Close()
+	}
+	serve.dedup = w
 	return nil
 }
 
-func (serve *CenterServer) Stop() error {
-	serve.done <- struct{}{}
-	return serve.listener.Close()
+// publishDesired 发布边缘节点上 key 所在模型的最新值
+func (serve *CenterServer) publishDesired(edgeID edgekv.EdgeID, key string) {
+	if !serve.retain {
+		return
+	}
+
+	rp, ok := serve.mq.(edgekv.RetainPublisher)
+	if !ok {
+		log.Errorf("centerServer: message queue %T does not support retained messages", serve.mq)
+		return
+	}
+
+	model, _ := edgekv.SplitKey(key)
+	val, ok := serve.store.Get(serve.store.EdgeKey(edgeID, model))
+	if !ok {
+		return
+	}
+
+	topic := edgeID.DownTopic(path.Join(edgekv.TopicDesired, model))
+	msg := edgekv.NewMessage(string(edgeID), edgekv.CmdDesired, edgekv.MessageDesired{Key: model, Value: val})
+	if err := rp.PublishRetained(topic, msg); err != nil {
+		log.Errorf("centerServer: publish desired '%s' error %s", topic, err)
+	}
+}
+
+func (serve *CenterServer) startBroker() error {
+	if err := serve.broker.Start(); err != nil {
+		return err
+	}
+
+	if serve.mq != nil {
+		return nil
+	}
+
+	mq, err := edgekv.OpenQueue("mqtt", serve.BrokerURI())
+	if err != nil {
+		serve.broker.Close()
+		return fmt.Errorf("center: connect embedded broker error: %w", err)
+	}
+
+	serve.mq = mq
+	serve.ownMQ = true
+	return nil
 }
 
 func (serve *CenterServer) SetStore(store edgekv.CenterStore) {
 	serve.store = store
 }
 
+// SetMessageQueue 设置消息队列，替换 EnableBroker 打开的连接
 func (serve *CenterServer) SetMessageQueue(mq edgekv.MessageQueue) {
+	if serve.ownMQ {
+		serve.mq.Close()
+		serve.ownMQ = false
+	}
 	serve.mq = mq
 }
 
@@ -99,16 +235,56 @@ func (serve *CenterServer) dispatch(key string, event edgekv.WatchEvent) {
 	serve.listener.Dispatch(key, event)
 }
 
+// edgeOf 返回消息所属的边缘节点，主题中的节点 ID 由代理的 ACL 保证，
+// 与 From 不一致的消息视为伪造
+func (serve *CenterServer) edgeOf(msg edgekv.Message) (edgekv.EdgeID, error) {
+	var from = edgekv.EdgeID(msg.From)
+	if len(msg.Topic) == 0 {
+		return from, nil
+	}
+
+	id, _, _, ok := edgekv.ParseTopic(msg.Topic)
+	if !ok {
+		return "", fmt.Errorf("centerServer: invalid topic '%s'", msg.Topic)
+	}
+
+	if !from.IsNil() && from != id {
+		return "", fmt.Errorf("centerServer: message from '%s' on topic of edge '%s'", from, id)
+	}
+	return id, nil
+}
+
 func (serve *CenterServer) syncProcess(msg edgekv.Message) error {
+	edgeId, err := serve.edgeOf(msg)
+	if err != nil {
+		log.Errorf("%s", err)
+		return nil
+	}
+
+	// 重复投递的消息已经应用过，直接确认
+	if serve.seen(msg) {
+		log.Debugf("centerServer: drop duplicate message '%s'", msg.ID)
+		return nil
+	}
+
+	if err = serve.applySync(edgeId, msg); err != nil {
+		return err
+	}
+	serve.markSeen(msg)
+	return nil
+}
+
+func (serve *CenterServer) applySync(edgeId edgekv.EdgeID, msg edgekv.Message) error {
 	switch msg.Type {
 	case edgekv.CmdChangelog:
 		var (
-			cmdMsg   = msg.Payload.(*edgekv.MessageChangelog)
-			val      interface{}
-			ok       bool
-			edgeId   = edgekv.EdgeID(msg.From)
-			doChange diff.Change
+			cmdMsg, ok = msg.Payload.(*edgekv.MessageChangelog)
+			val        interface{}
+			doChange   diff.Change
 		)
+		if !ok || len(cmdMsg.Changes) == 0 {
+			return fmt.Errorf("centerServer: invalid changelog payload %T", msg.Payload)
+		}
 		doChange = serve.lastChange(cmdMsg.Changes)
 
 		fullkey := serve.store.EdgeKey(edgeId, cmdMsg.Key)
@@ -123,7 +299,7 @@ func (serve *CenterServer) syncProcess(msg edgekv.Message) error {
 		serve.store.Set(fullkey, val)
 		var event = edgekv.WatchEvent{
 			Key:  cmdMsg.Key,
-			From: edgekv.EdgeID(msg.From),
+			From: edgeId,
 			Old:  val,
 			Val:  doChange.To,
 			Done: func(ok bool) {
@@ -133,17 +309,41 @@ func (serve *CenterServer) syncProcess(msg edgekv.Message) error {
 		}
 
 		serve.dispatch(fullkey, event)
+		serve.publishDesired(edgeId, cmdMsg.Key)
 	}
 	return nil
 }
 
+func (serve *CenterServer) seen(msg edgekv.Message) bool {
+	return len(msg.ID) > 0 && serve.dedup != nil && serve.dedup.Seen(msg.ID)
+}
+
+// markSeen 在消息处理成功之后记录消息 ID, 处理失败的消息重新投递时仍会处理
+func (serve *CenterServer) markSeen(msg edgekv.Message) {
+	if len(msg.ID) == 0 || serve.dedup == nil {
+		return
+	}
+
+	if e := serve.dedup.Add(msg.ID); e != nil {
+		log.Errorf("centerServer: record message '%s' error %s", msg.ID, e)
+	}
+}
+
 func (serve *CenterServer) binderProcess(msg edgekv.Message) error {
+	edgeId, err := serve.edgeOf(msg)
+	if err != nil {
+		log.Errorf("%s", err)
+		return nil
+	}
+
 	switch msg.Type {
 	case edgekv.CmdDeclareBinder:
 		var (
-			cmdMsg = msg.Payload.(*edgekv.MessageDeclareBinder)
-			edgeId = edgekv.EdgeID(msg.From)
+			cmdMsg, ok = msg.Payload.(*edgekv.MessageDeclareBinder)
 		)
+		if !ok {
+			return fmt.Errorf("centerServer: invalid declare binder payload %T", msg.Payload)
+		}
 
 		if !edgeId.IsNil() {
 			_ = cmdMsg
@@ -155,6 +355,22 @@ func (serve *CenterServer) binderProcess(msg edgekv.Message) error {
 	return nil
 }
 
+func EnableBroker(addr string) error {
+	return server.EnableBroker(addr)
+}
+
+func EnableRetain() {
+	server.EnableRetain()
+}
+
+func EnableDedup(filename string, size int) error {
+	return server.EnableDedup(filename, size)
+}
+
+func BrokerURI() string {
+	return server.BrokerURI()
+}
+
 func SetStore(store edgekv.CenterStore) {
 	server.SetStore(store)
 }
@@ -167,11 +383,26 @@ func WatchEdges(prefix string, fn edgekv.EdgeChangeFunc) {
 	server.WatchEdges(prefix, fn)
 }
 
+// Handler 返回默认 Center 的 HTTP API
+func Handler() http.Handler {
+	return server.Handler()
+}
+
+func SetModels(reg *openapi.Registry) {
+	server.SetModels(reg)
+}
+
 func OpenCenterStore(name string) (edgekv.CenterStore, error) {
 	switch name {
 	case "redis":
 		store, err := edgekv.OpenStore("redis", RedisURI)
 		return store.(*redis.RedisStore), err
+	case "memory":
+		store, err := edgekv.OpenStore("memory")
+		if err != nil {
+			return nil, err
+		}
+		return store.(edgekv.CenterStore), nil
 	default:
 		return nil, edgekv.ErrNonimpement
 	}
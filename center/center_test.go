@@ -0,0 +1,608 @@
+package center
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/edge"
+	"github.com/hysios/edgekv/edge/edgeserve"
+	"github.com/hysios/edgekv/mq/memory"
+	"github.com/hysios/edgekv/mq/secure"
+	"github.com/hysios/edgekv/openapi"
+	memstore "github.com/hysios/edgekv/store/memory"
+	"github.com/r3labs/diff/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+const testEdgeID = "E2E"
+
+type testEnv struct {
+	center    *CenterServer
+	edge      *edgeserve.EdgeServer
+	edgeStore edgekv.Store
+	edgeMQ    edgekv.MessageQueue
+	dir       string
+}
+
+// openEnv 在进程内启动 Center 与 Edge, 两者默认通过内存消息队列通信
+func openEnv(t *testing.T) *testEnv {
+	centerMQ, _ := memory.OpenMemoryMQ("memory://e2e/edgekv")
+	edgeMQ, _ := memory.OpenMemoryMQ("memory://e2e/edgekv")
+
+	var center = &CenterServer{}
+	center.SetMessageQueue(centerMQ)
+	return startEnv(t, center, edgeMQ)
+}
+
+// openBrokerEnv 启动带内嵌 MQTT 代理的 Center, Edge 通过 mqtt 连接到代理
+func openBrokerEnv(t *testing.T) *testEnv {
+	var center = &CenterServer{}
+	if err := center.EnableBroker(freeAddr(t)); err != nil {
+		t.Fatalf("start broker error %s", err)
+	}
+
+	edgeMQ, err := edgekv.OpenQueue("mqtt", center.BrokerURI()+"?client_id="+testEdgeID)
+	if err != nil {
+		t.Fatalf("open mqtt error %s", err)
+	}
+	return startEnv(t, center, edgeMQ)
+}
+
+func startEnv(t *testing.T, center *CenterServer, edgeMQ edgekv.MessageQueue) *testEnv {
+	env := startCenter(center)
+	env.startEdge(t, edgeMQ)
+	return env
+}
+
+// startCenter 只启动 Center, 之后通过 startEdge 启动 Edge
+func startCenter(center *CenterServer) *testEnv {
+	center.SetStore(memstore.OpenMapStore())
+	go center.Start()
+	return &testEnv{center: center}
+}
+
+// startEdge 启动 Edge, setup 在启动之前调用，用于添加监听等设置
+func (env *testEnv) startEdge(t *testing.T, edgeMQ edgekv.MessageQueue, setup ...func(serve *edgeserve.EdgeServer)) {
+	env.edge = &edgeserve.EdgeServer{}
+	env.edgeStore = memstore.OpenMapStore()
+	env.edgeMQ = edgeMQ
+
+	dir, err := ioutil.TempDir("", "edgekv")
+	if err != nil {
+		t.Fatalf("create temp dir error %s", err)
+	}
+	env.dir = dir
+	edge.UnixSock = filepath.Join(dir, "edgekv.sock")
+
+	env.edge.SetEdgeID(testEdgeID)
+	env.edge.SetStore(env.edgeStore)
+	env.edge.SetMessageQueue(edgeMQ)
+	for _, fn := range setup {
+		fn(env.edge)
+	}
+	go env.edge.Start()
+
+	eventually(t, func() bool {
+		_, err := os.Stat(edge.UnixSock)
+		return err == nil
+	})
+}
+
+func (env *testEnv) Close() {
+	env.edge.Stop()
+	env.center.Stop()
+	env.edgeMQ.Close()
+	os.RemoveAll(env.dir)
+}
+
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error %s", err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func eventually(t *testing.T, cond func() bool) {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("condition not satisfied in time")
+}
+
+func TestCenterToEdge(t *testing.T) {
+	env := openEnv(t)
+	defer env.Close()
+
+	testCenterToEdge(t, env)
+}
+
+func TestEmbeddedBroker(t *testing.T) {
+	env := openBrokerEnv(t)
+	defer env.Close()
+
+	testCenterToEdge(t, env)
+}
+
+func testCenterToEdge(t *testing.T, env *testEnv) {
+	db := env.center.OpenEdge(testEdgeID)
+	db.Set("test", map[string]interface{}{"on": true, "id": 1234})
+
+	eventually(t, func() bool {
+		return env.edgeStore.GetBool("test.on")
+	})
+	assert.Equal(t, env.edgeStore.GetInt("test.id"), 1234)
+}
+
+func TestStartError(t *testing.T) {
+	var (
+		center = &CenterServer{}
+		addr   = freeAddr(t)
+	)
+	assert.NoError(t, center.EnableBroker(addr))
+
+	// 没有设置存储时启动失败，关闭内嵌代理
+	assert.Error(t, center.Start())
+	ln, err := net.Listen("tcp", addr)
+	if assert.NoError(t, err) {
+		ln.Close()
+	}
+	assert.NoError(t, center.Stop())
+}
+
+func TestEdgeToCenter(t *testing.T) {
+	env := openEnv(t)
+	defer env.Close()
+
+	type change struct {
+		key    string
+		edgeID edgekv.EdgeID
+		val    interface{}
+	}
+	var ch = make(chan change, 1)
+	env.center.WatchEdges("test.*", func(key string, edgeID edgekv.EdgeID, old, new interface{}) error {
+		ch <- change{key: key, edgeID: edgeID, val: new}
+		return nil
+	})
+
+	client, err := edge.Open()
+	assert.NoError(t, err)
+	client.Set("test.on", true)
+
+	select {
+	case c := <-ch:
+		assert.Equal(t, c.key, "test.on")
+		assert.Equal(t, c.edgeID, edgekv.EdgeID(testEdgeID))
+		assert.Equal(t, c.val, true)
+	case <-time.After(3 * time.Second):
+		t.Fatalf("wait edge change timeout")
+	}
+
+	assert.True(t, env.edgeStore.GetBool("test.on"))
+}
+
+func TestSpoofedEdge(t *testing.T) {
+	env := openEnv(t)
+	defer env.Close()
+
+	var ch = make(chan edgekv.EdgeID, 2)
+	env.center.WatchEdges("test.*", func(key string, edgeID edgekv.EdgeID, old, new interface{}) error {
+		ch <- edgeID
+		return nil
+	})
+
+	publish := func(from string) {
+		env.edgeMQ.Publish(edgekv.EdgeID(testEdgeID).UpTopic(edgekv.TopicSync), edgekv.Message{
+			From: from,
+			Type: edgekv.CmdChangelog,
+			Payload: edgekv.MessageChangelog{
+				Key:     "test.on",
+				Changes: diff.Changelog{{Type: diff.UPDATE, Path: []string{"test", "on"}, To: true}},
+			},
+		})
+	}
+
+	// 在 E2E 的主题上冒充其他节点的消息被丢弃
+	publish("OTHER")
+	publish(testEdgeID)
+
+	select {
+	case id := <-ch:
+		assert.Equal(t, id, edgekv.EdgeID(testEdgeID))
+	case <-time.After(3 * time.Second):
+		t.Fatalf("wait edge change timeout")
+	}
+
+	select {
+	case id := <-ch:
+		t.Errorf("unexpected change from %s", id)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRetainedDesired(t *testing.T) {
+	var center = &CenterServer{}
+	centerMQ, _ := memory.OpenMemoryMQ("memory://retain/edgekv")
+	center.SetMessageQueue(centerMQ)
+	center.EnableRetain()
+
+	env := startCenter(center)
+	db := center.OpenEdge(testEdgeID)
+	db.Set("test", map[string]interface{}{"on": true, "id": 1234})
+
+	// Edge 在 Center 发布之后才启动，订阅时收到保留的最新配置
+	edgeMQ, _ := memory.OpenMemoryMQ("memory://retain/edgekv")
+	env.startEdge(t, edgeMQ)
+	defer env.Close()
+
+	eventually(t, func() bool {
+		return env.edgeStore.GetBool("test.on")
+	})
+	assert.Equal(t, env.edgeStore.GetInt("test.id"), 1234)
+}
+
+func TestDuplicateMessage(t *testing.T) {
+	env := openEnv(t)
+	defer env.Close()
+
+	var ch = make(chan interface{}, 2)
+	env.center.WatchEdges("test.*", func(key string, edgeID edgekv.EdgeID, old, new interface{}) error {
+		ch <- new
+		return nil
+	})
+
+	msg := edgekv.NewMessage(testEdgeID, edgekv.CmdChangelog, edgekv.MessageChangelog{
+		Key:     "test.count",
+		Changes: diff.Changelog{{Type: diff.UPDATE, Path: []string{"test", "count"}, To: 1}},
+	})
+
+	// 重复投递的同一条消息只应用一次
+	topic := edgekv.EdgeID(testEdgeID).UpTopic(edgekv.TopicSync)
+	env.edgeMQ.Publish(topic, msg)
+	env.edgeMQ.Publish(topic, msg)
+
+	select {
+	case val := <-ch:
+		assert.Equal(t, val, 1)
+	case <-time.After(3 * time.Second):
+		t.Fatalf("wait edge change timeout")
+	}
+
+	select {
+	case val := <-ch:
+		t.Errorf("duplicate message applied again %v", val)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestSecureQueue(t *testing.T) {
+	centerKey, _ := secure.GenerateKey(secure.CenterOwner)
+	edgeKey, _ := secure.GenerateKey(testEdgeID)
+	centerReg, edgeReg := secure.NewRegistry(), secure.NewRegistry()
+	centerReg.Add(edgeKey.Public())
+	edgeReg.Add(centerKey.Public())
+
+	centerMQ, _ := memory.OpenMemoryMQ("memory://secure/edgekv")
+	edgeMQ, _ := memory.OpenMemoryMQ("memory://secure/edgekv")
+
+	var center = &CenterServer{}
+	center.SetMessageQueue(secure.Wrap(centerMQ, centerKey, centerReg))
+	env := startEnv(t, center, secure.Wrap(edgeMQ, edgeKey, edgeReg))
+	defer env.Close()
+
+	testCenterToEdge(t, env)
+}
+
+func TestBindObserver(t *testing.T) {
+	env := openEnv(t)
+	defer env.Close()
+
+	var sets = make(chan interface{}, 1)
+	client, err := edge.Open()
+	assert.NoError(t, err)
+	assert.NoError(t, client.Bind("device.on", func(mt edgekv.BindMethod, key string, val interface{}) (interface{}, bool) {
+		switch mt {
+		case edgekv.BindGet:
+			return "yes", true
+		case edgekv.BindSet:
+			sets <- val
+		}
+		return nil, false
+	}))
+
+	mq, _ := memory.OpenMemoryMQ("memory://e2e/edgekv")
+	defer mq.Close()
+
+	var rets = make(chan *edgekv.MessageRetBind, 10)
+	mq.Subscribe(edgekv.UpWildcard(edgekv.TopicBinder), func(msg edgekv.Message) error {
+		if ret, ok := msg.Payload.(*edgekv.MessageRetBind); ok {
+			rets <- ret
+		}
+		return nil
+	})
+
+	// Edge 服务在观察者连接之后异步订阅 bind 频道，重复发送直到收到回复
+	bindTopic := edgekv.EdgeID(testEdgeID).DownTopic(edgekv.TopicBind)
+	var ret *edgekv.MessageRetBind
+	eventually(t, func() bool {
+		mq.Publish(bindTopic, edgekv.NewMessage("CENTER", edgekv.CmdGetBind, edgekv.MessageGetBind{Key: "device.on", SessionID: "s1"}))
+		select {
+		case ret = <-rets:
+			return true
+		case <-time.After(20 * time.Millisecond):
+			return false
+		}
+	})
+	assert.Equal(t, ret.SessionID, "s1")
+	assert.Equal(t, ret.Value, "yes")
+	assert.True(t, ret.Found)
+
+	mq.Publish(bindTopic, edgekv.NewMessage("CENTER", edgekv.CmdSetBind, edgekv.MessageSetBind{Key: "device.on", Value: false}))
+	select {
+	case val := <-sets:
+		assert.Equal(t, val, false)
+	case <-time.After(3 * time.Second):
+		t.Fatalf("wait bind set timeout")
+	}
+}
+
+func TestEdgeWatch(t *testing.T) {
+	env := openEnv(t)
+	defer env.Close()
+
+	client, err := edge.Open()
+	assert.NoError(t, err)
+
+	var ch = make(chan string, 16)
+	client.Watch("test", func(key string, old, new interface{}) error {
+		ch <- key
+		return nil
+	})
+
+	// Watch 在后台连接，修改直到收到变更
+	db := env.center.OpenEdge(testEdgeID)
+	var i int
+	eventually(t, func() bool {
+		i++
+		db.Set("test", map[string]interface{}{"id": i})
+		select {
+		case key := <-ch:
+			assert.Equal(t, key, "test")
+			return true
+		case <-time.After(20 * time.Millisecond):
+			return false
+		}
+	})
+}
+
+// listenEdge 在 TCP 与 UnixSock 上启动 Edge, UnixSock 最后打开，文件出现时所有监听都已就绪
+func listenEdge(t *testing.T, tcp string, tlsFiles ...string) *testEnv {
+	centerMQ, _ := memory.OpenMemoryMQ("memory://listen/edgekv")
+	edgeMQ, _ := memory.OpenMemoryMQ("memory://listen/edgekv")
+
+	var center = &CenterServer{}
+	center.SetMessageQueue(centerMQ)
+	env := startCenter(center)
+	env.startEdge(t, edgeMQ, func(serve *edgeserve.EdgeServer) {
+		if len(tlsFiles) >= 2 {
+			assert.NoError(t, serve.EnableTLS(tlsFiles[0], tlsFiles[1]))
+		}
+		if len(tlsFiles) == 3 {
+			assert.NoError(t, serve.EnableClientAuth(tlsFiles[2]))
+		}
+		assert.NoError(t, serve.Listen(tcp))
+		assert.NoError(t, serve.Listen("unix://"+edge.UnixSock))
+	})
+	return env
+}
+
+func testEdgeClient(t *testing.T, env *testEnv, dsn string) {
+	client, err := edge.Open(dsn)
+	assert.NoError(t, err)
+
+	client.Set("test.on", true)
+	eventually(t, func() bool {
+		return env.edgeStore.GetBool("test.on")
+	})
+
+	v, ok := client.Get("test")
+	assert.True(t, ok)
+	assert.Equal(t, v, map[string]interface{}{"on": true})
+}
+
+func TestEdgeOverTCP(t *testing.T) {
+	addr := freeAddr(t)
+	env := listenEdge(t, "tcp://"+addr)
+	defer env.Close()
+
+	testEdgeClient(t, env, "http://"+addr)
+
+	// 默认的 UnixSock 仍然可用
+	client, err := edge.Open()
+	assert.NoError(t, err)
+	assert.True(t, client.GetBool("test.on"))
+}
+
+func TestEdgeOverTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "edgekv-tls")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := selfSigned(t, dir)
+	addr := freeAddr(t)
+	env := listenEdge(t, "https://"+addr, certFile, keyFile)
+	defer env.Close()
+
+	testEdgeClient(t, env, "https://"+addr+"?ca="+certFile)
+
+	// 不信任的证书连接失败
+	client, err := edge.Open("https://" + addr)
+	assert.NoError(t, err)
+	_, ok := client.Get("test")
+	assert.False(t, ok)
+}
+
+func TestEdgeOverMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "edgekv-mtls")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := selfSigned(t, dir)
+	addr := freeAddr(t)
+	env := listenEdge(t, "https://"+addr, certFile, keyFile, certFile)
+	defer env.Close()
+
+	testEdgeClient(t, env, "https://"+addr+"?ca="+certFile+"&cert="+certFile+"&key="+keyFile)
+
+	// 没有客户端证书时连接失败
+	client, err := edge.Open("https://" + addr + "?ca=" + certFile)
+	assert.NoError(t, err)
+	_, ok := client.Get("test")
+	assert.False(t, ok)
+}
+
+func TestEdgeListenTLSWithoutCert(t *testing.T) {
+	var serve = &edgeserve.EdgeServer{}
+	serve.SetEdgeID(testEdgeID)
+	serve.SetStore(memstore.OpenMapStore())
+	mq, _ := memory.OpenMemoryMQ("memory://nocert/edgekv")
+	serve.SetMessageQueue(mq)
+	defer mq.Close()
+
+	assert.NoError(t, serve.Listen("https://"+freeAddr(t)))
+	assert.Error(t, serve.Start())
+}
+
+func TestEdgeOverGRPC(t *testing.T) {
+	addr := freeAddr(t)
+	env := listenEdge(t, "grpc://"+addr)
+	defer env.Close()
+
+	testEdgeClient(t, env, "grpc://"+addr)
+}
+
+func TestEdgeOverGRPCUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "edgekv-grpc")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "grpc.sock")
+	env := listenEdge(t, "grpc+unix://"+sock)
+	defer env.Close()
+
+	client, err := edge.Open("grpc+unix://" + sock)
+	assert.NoError(t, err)
+	defer client.(*edge.GRPCStore).Close()
+
+	var ch = make(chan string, 16)
+	client.Watch("test", func(key string, old, new interface{}) error {
+		ch <- key
+		return nil
+	})
+
+	// Watch 在后台连接，修改直到收到变更
+	db := env.center.OpenEdge(testEdgeID)
+	var i int
+	eventually(t, func() bool {
+		i++
+		db.Set("test", map[string]interface{}{"id": i})
+		select {
+		case key := <-ch:
+			assert.Equal(t, key, "test")
+			return true
+		case <-time.After(20 * time.Millisecond):
+			return false
+		}
+	})
+}
+
+// selfSigned 生成 127.0.0.1 的自签名证书
+func selfSigned(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "edgekv"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	assert.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certFile, keyFile
+}
+
+func TestCenterHTTP(t *testing.T) {
+	env := openEnv(t)
+	defer env.Close()
+
+	var reg = openapi.NewRegistry()
+	reg.Register("test", &openapi.Schema{Type: "object"})
+	env.center.SetModels(reg)
+
+	ts := httptest.NewServer(env.center.Handler())
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/"+testEdgeID+"/test", edgekv.JSONMimeType, strings.NewReader(`{"on": true}`))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	eventually(t, func() bool {
+		return env.edgeStore.GetBool("test.on")
+	})
+
+	resp, err = http.Get(ts.URL + "/" + testEdgeID + "/test.on")
+	assert.NoError(t, err)
+	var ret HTTPResponse
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&ret))
+	resp.Body.Close()
+	assert.Equal(t, HTTPResponse{Status: "success", Data: true}, ret)
+
+	resp, err = http.Get(ts.URL + "/" + testEdgeID + "/missing")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Get(ts.URL + "/openapi.json")
+	assert.NoError(t, err)
+	var doc openapi.Document
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&doc))
+	resp.Body.Close()
+	assert.Contains(t, doc.Paths, "/{edgeID}/{key}")
+	assert.Contains(t, doc.Paths, "/{edgeID}/test")
+	assert.Contains(t, doc.Components.Schemas, "HTTPError")
+}
@@ -58,6 +58,8 @@ func (center *CenterDatabase) Set(key string, val interface{}, opts ...edgekv.Se
 		log.Errorf("center_database: set '%s' error: %s", center.Fullkey(key), err)
 		return
 	}
+
+	center.master.publishDesired(center.ID, key)
 }
 
 func (center *CenterDatabase) Sync(old, val interface{}, key string) error {
@@ -89,15 +91,11 @@ func (center *CenterDatabase) Sync(old, val interface{}, key string) error {
 		return nil
 	}
 
-	topic := center.Fullkey("sync")
-	return center.master.mq.Publish(topic, edgekv.Message{
-		From: string(center.ID),
-		Type: edgekv.CmdChangelog,
-		Payload: edgekv.MessageChangelog{
-			Key:     key,
-			Changes: changes,
-		},
-	})
+	topic := center.ID.DownTopic(edgekv.TopicSync)
+	return center.master.mq.Publish(topic, edgekv.NewMessage(string(center.ID), edgekv.CmdChangelog, edgekv.MessageChangelog{
+		Key:     key,
+		Changes: changes,
+	}))
 }
 
 func (center *CenterDatabase) Watch(pattern string, fn edgekv.ChangeFunc) {
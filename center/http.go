@@ -0,0 +1,186 @@
+package center
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/openapi"
+	"github.com/hysios/log"
+	. "github.com/hysios/utils/response"
+)
+
+// APIVersion Center HTTP API 的版本
+const APIVersion = "1.0.0"
+
+// HTTPResponse Center HTTP API 成功时的响应
+type HTTPResponse struct {
+	Status string      `json:"status"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+// HTTPError Center HTTP API 失败时的响应
+type HTTPError struct {
+	Status  string `json:"status"`
+	ErrCode int    `json:"errCode"`
+	Errors  string `json:"errors"`
+}
+
+// Handler 返回 Center 的 HTTP API
+//
+//	GET  /{edgeID}/{key}   读取边缘节点的键值
+//	POST /{edgeID}/{key}   设置边缘节点的键值，请求体为 JSON 值，并同步到边缘节点
+//	GET  /openapi.json     OpenAPI 文档
+func (serve *CenterServer) Handler() http.Handler {
+	r := mux.NewRouter()
+	openapi.Register(r, serve.routes())
+	return r
+}
+
+// SetModels 设置生成文档使用的模型注册表，没有设置时使用 openapi.DefaultRegistry
+func (serve *CenterServer) SetModels(reg *openapi.Registry) {
+	serve.models = reg
+}
+
+// OpenAPI 生成 Center HTTP API 的文档，注册表中的每个模型生成带有类型的 /{edgeID}/{model} 路径
+func (serve *CenterServer) OpenAPI() *openapi.Document {
+	doc := openapi.New("EdgeKV Center API", APIVersion)
+	doc.Info.Description = "读写边缘节点的配置，写入的值通过消息队列同步到边缘节点"
+	doc.AddRoutes("", serve.routes())
+	serve.addModels(doc)
+	return doc
+}
+
+func (serve *CenterServer) routes() []openapi.Route {
+	return []openapi.Route{
+		{Method: http.MethodGet, Path: "/openapi.json", Handler: openapi.Handler(serve.OpenAPI).ServeHTTP, Doc: docOpenAPI},
+		{Method: http.MethodGet, Path: "/{edgeID}/{key}", Handler: serve.GetKey, Doc: func(doc *openapi.Document) *openapi.Operation {
+			return docGetKey(doc, &openapi.Schema{})
+		}},
+		{Method: http.MethodPost, Path: "/{edgeID}/{key}", Handler: serve.SetKey, Doc: func(doc *openapi.Document) *openapi.Operation {
+			return docSetKey(doc, &openapi.Schema{})
+		}},
+	}
+}
+
+// GetKey 读取边缘节点的键值
+func (serve *CenterServer) GetKey(w http.ResponseWriter, r *http.Request) {
+	var (
+		params = mux.Vars(r)
+		key    = params["key"]
+		edgeID = params["edgeID"]
+		db     = serve.OpenEdge(edgekv.EdgeID(edgeID))
+	)
+
+	w.Header().Set("Content-Type", edgekv.JSONMimeType)
+	if val, ok := db.Get(key); ok {
+		log.Debugf("get '%s' value => %v", key, val)
+		Jsonify(w, &map[string]interface{}{"data": val})
+	} else {
+		AbortErr(w, http.StatusNotFound, fmt.Errorf("not found key '%s'", key))
+	}
+}
+
+// SetKey 设置边缘节点的键值
+func (serve *CenterServer) SetKey(w http.ResponseWriter, r *http.Request) {
+	var (
+		params = mux.Vars(r)
+		key    = params["key"]
+		edgeID = params["edgeID"]
+		val    = new(interface{})
+		db     = serve.OpenEdge(edgekv.EdgeID(edgeID))
+	)
+
+	w.Header().Set("Content-Type", edgekv.JSONMimeType)
+	var dec = json.NewDecoder(r.Body)
+	if err := dec.Decode(val); err != nil {
+		AbortErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	db.Set(key, *val)
+	log.Debugf("set '%s' value => %v", key, *val)
+
+	Jsonify(w, nil)
+}
+
+func (serve *CenterServer) registry() *openapi.Registry {
+	if serve.models == nil {
+		return openapi.DefaultRegistry
+	}
+	return serve.models
+}
+
+// addModels 为每个模型添加读写的路径，值的类型为模型的 Schema
+func (serve *CenterServer) addModels(doc *openapi.Document) {
+	reg := serve.registry()
+	for _, model := range reg.Models() {
+		s, _ := reg.Lookup(model)
+		ref := doc.AddSchema("model."+model, s)
+
+		get := docGetKey(doc, ref)
+		get.Summary, get.OperationID, get.Tags = "读取模型 "+model, "get_"+model, []string{"model"}
+		doc.Add(http.MethodGet, "/{edgeID}/"+model, get)
+
+		set := docSetKey(doc, ref)
+		set.Summary, set.OperationID, set.Tags = "写入模型 "+model, "set_"+model, []string{"model"}
+		doc.Add(http.MethodPost, "/{edgeID}/"+model, set)
+	}
+}
+
+func edgeIDParam() *openapi.Parameter {
+	return &openapi.Parameter{
+		Name: "edgeID", In: "path", Required: true, Description: "边缘节点的 ID",
+		Schema: &openapi.Schema{Type: "string"},
+	}
+}
+
+func errorResponse(doc *openapi.Document, code int) *openapi.Response {
+	return &openapi.Response{
+		Description: http.StatusText(code),
+		Content:     openapi.JSON(doc.SchemaFor(HTTPError{})),
+	}
+}
+
+func docGetKey(doc *openapi.Document, value *openapi.Schema) *openapi.Operation {
+	return &openapi.Operation{
+		Summary:     "读取边缘节点的键值",
+		OperationID: "get",
+		Tags:        []string{"edge"},
+		Parameters:  []*openapi.Parameter{edgeIDParam()},
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "OK", Content: openapi.JSON(&openapi.Schema{AllOf: []*openapi.Schema{
+				doc.SchemaFor(HTTPResponse{}),
+				{Type: "object", Properties: map[string]*openapi.Schema{"data": value}},
+			}})},
+			"404": errorResponse(doc, http.StatusNotFound),
+		},
+	}
+}
+
+func docSetKey(doc *openapi.Document, value *openapi.Schema) *openapi.Operation {
+	return &openapi.Operation{
+		Summary:     "设置边缘节点的键值",
+		Description: "值保存在 Center 并通过消息队列同步到边缘节点",
+		OperationID: "set",
+		Tags:        []string{"edge"},
+		Parameters:  []*openapi.Parameter{edgeIDParam()},
+		RequestBody: &openapi.RequestBody{Required: true, Content: openapi.JSON(value)},
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "OK", Content: openapi.JSON(doc.SchemaFor(HTTPResponse{}))},
+			"400": errorResponse(doc, http.StatusBadRequest),
+		},
+	}
+}
+
+func docOpenAPI(doc *openapi.Document) *openapi.Operation {
+	return &openapi.Operation{
+		Summary:     "OpenAPI 文档",
+		OperationID: "openapi",
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "OpenAPI 3 文档", Content: openapi.JSON(&openapi.Schema{Type: "object"})},
+		},
+	}
+}
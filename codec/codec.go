@@ -0,0 +1,154 @@
+// Package codec 定义消息在队列上传输时的编码，每个队列通过 uri 中的 codec 参数选择，例如
+//
+//	mqtt://127.0.0.1:1883/edgekv?codec=json
+//
+// 默认的 gob 编码只能在 Go 程序之间使用，其他语言实现的网关应使用 json 编码，
+// json 编码的消息是一个带版本号的信封:
+//
+//	{
+//	  "v": 1,
+//	  "id": "5f0c1b7e2a9d4c3b8e6f1a2b3c4d5e6f",
+//	  "ts": 1620000000000,
+//	  "from": "EDGE1",
+//	  "type": "changelog",
+//	  "payload": {"key": "test", "changes": [{"type": "update", "path": ["on"], "from": false, "to": true}]}
+//	}
+//
+// v 为信封的版本号，当前为 1, 解码时拒绝更高的版本; id 为消息的唯一标识，接收方据此去重,
+// ts 为消息创建的时间 (Unix 毫秒), id 与 ts 可以省略; type 为 edgekv.Command,
+// payload 的结构由 type 决定，字段名与 edgekv.Message* 结构体的 json 标签一致。
+// 新的命令通过 edgekv.RegisterCommand 注册载荷类型后即可被所有编码解码,
+// 解码后的 Payload 是具体类型的指针，例如 *edgekv.MessageChangelog,
+// 其中 interface{} 类型的值按 json 的规则解码，数字为 float64, 对象为 map[string]interface{}。
+//
+// msgpack 与 protobuf 编码使用相同的信封结构，分别在子包 codec/msgpack 与 codec/protobuf 中注册。
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hysios/edgekv"
+)
+
+// Version 信封结构的当前版本
+const Version = 1
+
+// Default 队列 uri 中没有指定 codec 时使用的编码
+var Default = "gob"
+
+var (
+	ErrUnknownCodec = errors.New("codec: unknown codec")
+	// ErrUnknownCommand 消息的命令没有通过 edgekv.RegisterCommand 注册
+	ErrUnknownCommand = edgekv.ErrUnknownCommand
+)
+
+// Codec 把 edgekv.Message 编码为队列上传输的字节
+type Codec interface {
+	Name() string
+	Marshal(msg edgekv.Message) ([]byte, error)
+	Unmarshal(b []byte, msg *edgekv.Message) error
+}
+
+var (
+	codecs = make(map[string]Codec)
+	mu     sync.RWMutex
+)
+
+// Register 注册编码，同名的编码只注册第一次
+func Register(c Codec) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := codecs[c.Name()]; ok {
+		return
+	}
+	codecs[c.Name()] = c
+}
+
+// Get 返回名为 name 的编码, name 为空时返回 Default
+func Get(name string) (Codec, error) {
+	if len(name) == 0 {
+		name = Default
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if c, ok := codecs[name]; ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("%w '%s'", ErrUnknownCodec, name)
+}
+
+// Names 返回所有已注册的编码名称
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	var names = make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Header 信封中除载荷以外的字段
+type Header struct {
+	V    int            `json:"v"`
+	ID   string         `json:"id,omitempty"`
+	TS   int64          `json:"ts,omitempty"`
+	From string         `json:"from"`
+	Type edgekv.Command `json:"type"`
+}
+
+// Envelope 与语言无关的编码使用的信封结构
+type Envelope struct {
+	Header
+	Payload interface{} `json:"payload"`
+}
+
+// Wrap 把消息包装成当前版本的信封
+func Wrap(msg edgekv.Message) Envelope {
+	var h = Header{
+		V:    Version,
+		ID:   msg.ID,
+		From: msg.From,
+		Type: msg.Type,
+	}
+
+	if !msg.Time.IsZero() {
+		h.TS = msg.Time.UnixNano() / int64(time.Millisecond)
+	}
+	return Envelope{Header: h, Payload: msg.Payload}
+}
+
+// Unwrap 检查信封的版本，并用 decode 把载荷解码为 h.Type 对应的具体类型
+func Unwrap(h Header, decode func(payload interface{}) error, msg *edgekv.Message) error {
+	if h.V < 1 || h.V > Version {
+		return fmt.Errorf("codec: unsupported envelope version %d", h.V)
+	}
+
+	payload, err := edgekv.NewPayload(h.Type)
+	if err != nil {
+		return err
+	}
+
+	if err = decode(payload); err != nil {
+		return fmt.Errorf("codec: decode %s payload error: %w", h.Type, err)
+	}
+
+	msg.ID = h.ID
+	msg.From = h.From
+	msg.Type = h.Type
+	msg.Payload = payload
+	msg.Time = time.Time{}
+	if h.TS > 0 {
+		msg.Time = time.Unix(0, h.TS*int64(time.Millisecond))
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package codec
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hysios/edgekv"
+	"github.com/r3labs/diff/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+var testMessages = []edgekv.Message{
+	{
+		From: "EDGE1",
+		Type: edgekv.CmdChangelog,
+		Payload: edgekv.MessageChangelog{
+			Key:     "test",
+			Changes: diff.Changelog{{Type: diff.UPDATE, Path: []string{"on"}, From: false, To: true}},
+		},
+	},
+	{From: "EDGE1", Type: edgekv.CmdDeclareBinder, Payload: edgekv.MessageDeclareBinder{Pattern: "device.*"}},
+	{From: "CENTER", Type: edgekv.CmdGetBind, Payload: edgekv.MessageGetBind{Key: "device.on", SessionID: "s1"}},
+	{From: "CENTER", Type: edgekv.CmdSetBind, Payload: edgekv.MessageSetBind{Key: "device.on", Value: "yes"}},
+	{From: "CENTER", Type: edgekv.CmdDeleteBind, Payload: edgekv.MessageDeleteBind{Key: "device.on"}},
+	{From: "EDGE1", Type: edgekv.CmdRetBind, Payload: edgekv.MessageRetBind{Key: "device.on", SessionID: "s1", Value: 1.5, Found: true}},
+}
+
+type testReboot struct {
+	Delay int `json:"delay"`
+}
+
+const cmdReboot edgekv.Command = "codectest_reboot"
+
+func init() {
+	edgekv.RegisterCommand(cmdReboot, func() interface{} { return new(testReboot) })
+}
+
+func TestCodec_RegisteredCommand(t *testing.T) {
+	for _, name := range []string{"gob", "json"} {
+		c, _ := Get(name)
+		b, err := c.Marshal(edgekv.Message{From: "CENTER", Type: cmdReboot, Payload: testReboot{Delay: 5}})
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+
+		var msg edgekv.Message
+		assert.NoError(t, c.Unmarshal(b, &msg), name)
+		if reboot, ok := msg.Payload.(*testReboot); assert.True(t, ok, "%s payload %T", name, msg.Payload) {
+			assert.Equal(t, reboot.Delay, 5)
+		}
+	}
+}
+
+func TestCodec_RoundTrip(t *testing.T) {
+	for _, name := range []string{"gob", "json"} {
+		c, err := Get(name)
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		for _, msg := range testMessages {
+			b, err := c.Marshal(msg)
+			if !assert.NoError(t, err, "%s %s", name, msg.Type) {
+				continue
+			}
+
+			var got edgekv.Message
+			if !assert.NoError(t, c.Unmarshal(b, &got), "%s %s", name, msg.Type) {
+				continue
+			}
+
+			assert.Equal(t, msg.From, got.From)
+			assert.Equal(t, msg.Type, got.Type)
+			// 载荷总是解码为具体类型的指针
+			want, _ := edgekv.NewPayload(msg.Type)
+			assert.IsType(t, want, got.Payload, "%s %s", name, msg.Type)
+		}
+	}
+}
+
+func TestCodec_MessageID(t *testing.T) {
+	var sent = edgekv.NewMessage("EDGE1", edgekv.CmdDeleteBind, edgekv.MessageDeleteBind{Key: "device.on"})
+	for _, name := range []string{"gob", "json"} {
+		c, _ := Get(name)
+		b, err := c.Marshal(sent)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+
+		var msg edgekv.Message
+		assert.NoError(t, c.Unmarshal(b, &msg), name)
+		assert.Equal(t, msg.ID, sent.ID, name)
+		// 信封中的时间戳精确到毫秒
+		assert.WithinDuration(t, msg.Time, sent.Time, time.Millisecond, name)
+	}
+}
+
+func TestJSON_Envelope(t *testing.T) {
+	c, _ := Get("json")
+	b, err := c.Marshal(testMessages[0])
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"v": 1,
+		"from": "EDGE1",
+		"type": "changelog",
+		"payload": {"key": "test", "changes": [{"type": "update", "path": ["on"], "from": false, "to": true}]}
+	}`, string(b))
+
+	var msg edgekv.Message
+	assert.NoError(t, c.Unmarshal(b, &msg))
+	cmdMsg, ok := msg.Payload.(*edgekv.MessageChangelog)
+	if assert.True(t, ok) {
+		assert.Equal(t, cmdMsg.Key, "test")
+		assert.Equal(t, cmdMsg.Changes[0].To, true)
+	}
+}
+
+func TestJSON_Errors(t *testing.T) {
+	var (
+		c, _ = Get("json")
+		msg  edgekv.Message
+	)
+
+	assert.Error(t, c.Unmarshal([]byte(`{"v": 2, "type": "changelog", "payload": {}}`), &msg))
+	assert.Error(t, c.Unmarshal([]byte(`{"type": "changelog", "payload": {}}`), &msg))
+	assert.ErrorIs(t, c.Unmarshal([]byte(`{"v": 1, "type": "reboot", "payload": {}}`), &msg), ErrUnknownCommand)
+	assert.Error(t, c.Unmarshal([]byte(`{"v": 1, "type": "changelog", "payload": []}`), &msg))
+}
+
+func TestGet(t *testing.T) {
+	c, err := Get("")
+	assert.NoError(t, err)
+	assert.Equal(t, Default, c.Name())
+
+	_, err = Get("xml")
+	assert.ErrorIs(t, err, ErrUnknownCodec)
+	assert.Contains(t, Names(), "json")
+}
+
+func TestWrap(t *testing.T) {
+	b, _ := json.Marshal(Wrap(testMessages[1]))
+	assert.JSONEq(t, `{"v": 1, "from": "EDGE1", "type": "declarebinder", "payload": {"pattern": "device.*"}}`, string(b))
+
+	var msg = testMessages[1]
+	msg.ID = "8f14e45fceea167a5a36dedd4bea2543"
+	msg.Time = time.Unix(1600000000, 123*int64(time.Millisecond))
+	b, _ = json.Marshal(Wrap(msg))
+	assert.JSONEq(t, `{
+		"v": 1, "id": "8f14e45fceea167a5a36dedd4bea2543", "ts": 1600000000123,
+		"from": "EDGE1", "type": "declarebinder", "payload": {"pattern": "device.*"}
+	}`, string(b))
+}
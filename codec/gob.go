@@ -0,0 +1,27 @@
+package codec
+
+import (
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/utils"
+)
+
+// gobCodec 默认的编码，与之前版本的消息兼容
+type gobCodec struct{}
+
+func (gobCodec) Name() string { return "gob" }
+
+func (gobCodec) Marshal(msg edgekv.Message) ([]byte, error) {
+	msg.Topic, msg.Retained = "", false
+	return utils.Marshal(msg)
+}
+
+func (gobCodec) Unmarshal(b []byte, msg *edgekv.Message) error {
+	if err := utils.Unmarshal(b, msg); err != nil {
+		return err
+	}
+	return msg.Normalize()
+}
+
+func init() {
+	Register(gobCodec{})
+}
@@ -0,0 +1,38 @@
+package codec
+
+import (
+	"encoding/json"
+
+	"github.com/hysios/edgekv"
+)
+
+type jsonCodec struct{}
+
+type jsonEnvelope struct {
+	Header
+	Payload json.RawMessage `json:"payload"`
+}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(msg edgekv.Message) ([]byte, error) {
+	return json.Marshal(Wrap(msg))
+}
+
+func (jsonCodec) Unmarshal(b []byte, msg *edgekv.Message) error {
+	var env jsonEnvelope
+	if err := json.Unmarshal(b, &env); err != nil {
+		return err
+	}
+
+	return Unwrap(env.Header, func(payload interface{}) error {
+		if len(env.Payload) == 0 {
+			return nil
+		}
+		return json.Unmarshal(env.Payload, payload)
+	}, msg)
+}
+
+func init() {
+	Register(jsonCodec{})
+}
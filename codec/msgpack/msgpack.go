@@ -0,0 +1,62 @@
+// Package msgpack 注册 MessagePack 编码, 使用时在程序中导入
+//
+//	import _ "github.com/hysios/edgekv/codec/msgpack"
+//
+// 然后在队列 uri 中指定 codec=msgpack, 信封结构与 json 编码相同，字段名取自 json 标签
+package msgpack
+
+import (
+	"bytes"
+
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/codec"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type msgpackCodec struct{}
+
+type envelope struct {
+	codec.Header
+	Payload msgpack.RawMessage `json:"payload"`
+}
+
+func (msgpackCodec) Name() string { return "msgpack" }
+
+func (msgpackCodec) Marshal(msg edgekv.Message) ([]byte, error) {
+	var (
+		buf bytes.Buffer
+		enc = msgpack.NewEncoder(&buf)
+	)
+
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(codec.Wrap(msg)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(b []byte, msg *edgekv.Message) error {
+	var env envelope
+	if err := decode(b, &env); err != nil {
+		return err
+	}
+
+	return codec.Unwrap(env.Header, func(payload interface{}) error {
+		if len(env.Payload) == 0 {
+			return nil
+		}
+		return decode(env.Payload, payload)
+	}, msg)
+}
+
+func decode(b []byte, val interface{}) error {
+	var dec = msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetCustomStructTag("json")
+	// interface{} 中的整数统一解码为 int64, 浮点数为 float64
+	dec.UseLooseInterfaceDecoding(true)
+	return dec.Decode(val)
+}
+
+func init() {
+	codec.Register(msgpackCodec{})
+}
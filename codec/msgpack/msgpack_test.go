@@ -0,0 +1,47 @@
+package msgpack
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/codec"
+	"github.com/r3labs/diff/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodec(t *testing.T) {
+	c, err := codec.Get("msgpack")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	sent := edgekv.NewMessage("EDGE1", edgekv.CmdChangelog, edgekv.MessageChangelog{
+		Key:     "test",
+		Changes: diff.Changelog{{Type: diff.UPDATE, Path: []string{"count"}, From: 1, To: 2}},
+	})
+	b, err := c.Marshal(sent)
+	assert.NoError(t, err)
+
+	var msg edgekv.Message
+	assert.NoError(t, c.Unmarshal(b, &msg))
+	assert.Equal(t, msg.From, "EDGE1")
+	assert.Equal(t, msg.Type, edgekv.CmdChangelog)
+	assert.Equal(t, msg.ID, sent.ID)
+	assert.Equal(t, msg.Time.UnixNano()/int64(time.Millisecond), sent.Time.UnixNano()/int64(time.Millisecond))
+
+	cmdMsg, ok := msg.Payload.(*edgekv.MessageChangelog)
+	if assert.True(t, ok, "payload type %T", msg.Payload) {
+		assert.Equal(t, cmdMsg.Key, "test")
+		assert.Equal(t, cmdMsg.Changes[0].Path, []string{"count"})
+		assert.EqualValues(t, cmdMsg.Changes[0].To, 2)
+	}
+
+	assert.ErrorIs(t, c.Unmarshal(mustMarshal(t, c, edgekv.Message{Type: "reboot"}), &msg), codec.ErrUnknownCommand)
+}
+
+func mustMarshal(t *testing.T, c codec.Codec, msg edgekv.Message) []byte {
+	b, err := c.Marshal(msg)
+	assert.NoError(t, err)
+	return b
+}
@@ -0,0 +1,75 @@
+// Package protobuf 注册 Protobuf 编码, 使用时在程序中导入
+//
+//	import _ "github.com/hysios/edgekv/codec/protobuf"
+//
+// 然后在队列 uri 中指定 codec=protobuf, 消息编码为 google.protobuf.Struct,
+// 字段与 json 编码的信封相同 (v, id, ts, from, type, payload), 其他语言可直接使用 struct.proto 解码
+package protobuf
+
+import (
+	"encoding/json"
+
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/codec"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string { return "protobuf" }
+
+func (protobufCodec) Marshal(msg edgekv.Message) ([]byte, error) {
+	// 先经过 json 得到只包含基本类型的值，再转换为 Struct
+	b, err := json.Marshal(codec.Wrap(msg))
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]interface{}
+	if err = json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+
+	s, err := structpb.NewStruct(m)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(s)
+}
+
+func (protobufCodec) Unmarshal(b []byte, msg *edgekv.Message) error {
+	var s structpb.Struct
+	if err := proto.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	var (
+		fields = s.GetFields()
+		h      = codec.Header{
+			V:    int(fields["v"].GetNumberValue()),
+			ID:   fields["id"].GetStringValue(),
+			TS:   int64(fields["ts"].GetNumberValue()),
+			From: fields["from"].GetStringValue(),
+			Type: edgekv.Command(fields["type"].GetStringValue()),
+		}
+	)
+
+	return codec.Unwrap(h,
+		func(payload interface{}) error {
+			raw, ok := fields["payload"]
+			if !ok {
+				return nil
+			}
+
+			b, err := json.Marshal(raw.AsInterface())
+			if err != nil {
+				return err
+			}
+			return json.Unmarshal(b, payload)
+		}, msg)
+}
+
+func init() {
+	codec.Register(protobufCodec{})
+}
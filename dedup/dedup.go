@@ -0,0 +1,187 @@
+// Package dedup 提供有界的消息去重窗口，记录最近处理过的消息 ID,
+// 重复投递的消息 (QoS 1、重连后重发等) 不会被再次应用。
+// 窗口按数量先进先出，不检查消息的时间，不能防止移出窗口之后的重放。
+//
+// 使用 OpenWindow 时窗口保存在文件中，每处理一条消息追加一行，
+// 文件超过窗口大小的两倍时压缩，重启后窗口中的 ID 仍然有效。
+package dedup
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DefaultSize 去重窗口默认保留的消息 ID 数量
+var DefaultSize = 4096
+
+// Window 保留最近 Size 个消息 ID 的去重窗口，先进先出
+type Window struct {
+	Size int
+
+	mu       sync.Mutex
+	ids      map[string]struct{}
+	order    []string
+	filename string
+	file     *os.File
+	lines    int
+}
+
+// NewWindow 创建只保存在内存中的去重窗口, size <= 0 时使用 DefaultSize
+func NewWindow(size int) *Window {
+	if size <= 0 {
+		size = DefaultSize
+	}
+
+	return &Window{
+		Size: size,
+		ids:  make(map[string]struct{}, size),
+	}
+}
+
+// OpenWindow 打开保存在 filename 中的去重窗口，文件不存在时创建
+func OpenWindow(filename string, size int) (*Window, error) {
+	var w = NewWindow(size)
+	w.filename = filename
+
+	if err := w.load(); err != nil {
+		return nil, err
+	}
+
+	if err := w.compact(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Window) load() error {
+	f, err := os.Open(w.filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("dedup: open window error: %w", err)
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if id := strings.TrimSpace(s.Text()); len(id) > 0 {
+			w.add(id)
+		}
+	}
+
+	// 最后一行可能只写入了一半，忽略读取错误
+	return nil
+}
+
+// Seen 判断消息 ID 是否已经处理过
+func (w *Window) Seen(id string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, ok := w.ids[id]
+	return ok
+}
+
+// Add 记录已经处理的消息 ID, 应在消息成功处理之后调用，处理失败的消息重新投递时仍会被处理
+func (w *Window) Add(id string) error {
+	if len(id) == 0 || strings.ContainsAny(id, "\r\n") {
+		return fmt.Errorf("dedup: invalid message id '%s'", id)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.ids[id]; ok {
+		return nil
+	}
+	w.add(id)
+
+	if w.file == nil {
+		return nil
+	}
+
+	if _, err := w.file.WriteString(id + "\n"); err != nil {
+		return fmt.Errorf("dedup: write window error: %w", err)
+	}
+
+	w.lines++
+	if w.lines > 2*w.Size {
+		return w.compact()
+	}
+	return nil
+}
+
+func (w *Window) add(id string) {
+	if _, ok := w.ids[id]; ok {
+		return
+	}
+
+	w.ids[id] = struct{}{}
+	w.order = append(w.order, id)
+	for len(w.order) > w.Size {
+		delete(w.ids, w.order[0])
+		w.order = w.order[1:]
+	}
+}
+
+// compact 用窗口中当前的 ID 重写文件
+func (w *Window) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(w.filename), filepath.Base(w.filename)+".*")
+	if err != nil {
+		return fmt.Errorf("dedup: create window file error: %w", err)
+	}
+
+	var buf = bufio.NewWriter(tmp)
+	for _, id := range w.order {
+		buf.WriteString(id + "\n")
+	}
+
+	if err = buf.Flush(); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), w.filename)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("dedup: compact window error: %w", err)
+	}
+
+	if w.file != nil {
+		w.file.Close()
+	}
+
+	if w.file, err = os.OpenFile(w.filename, os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return fmt.Errorf("dedup: open window error: %w", err)
+	}
+	w.lines = len(w.order)
+	return nil
+}
+
+// Len 返回窗口中的 ID 数量
+func (w *Window) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.order)
+}
+
+// Close 关闭窗口文件，之后窗口只在内存中记录
+func (w *Window) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
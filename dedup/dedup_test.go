@@ -0,0 +1,86 @@
+package dedup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindow_Bounded(t *testing.T) {
+	w := NewWindow(3)
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, w.Add(fmt.Sprintf("id%d", i)))
+	}
+	// 重复记录不占用窗口
+	assert.NoError(t, w.Add("id4"))
+
+	assert.Equal(t, w.Len(), 3)
+	assert.False(t, w.Seen("id0"))
+	assert.False(t, w.Seen("id1"))
+	for _, id := range []string{"id2", "id3", "id4"} {
+		assert.True(t, w.Seen(id), id)
+	}
+
+	assert.Error(t, w.Add(""))
+	assert.Error(t, w.Add("a\nb"))
+}
+
+func TestWindow_Persisted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatalf("create temp dir error %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "window")
+	w, err := OpenWindow(filename, 3)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, w.Add(fmt.Sprintf("id%d", i)))
+	}
+	assert.NoError(t, w.Close())
+
+	// 重启之后窗口中的消息仍然是重复的
+	w, err = OpenWindow(filename, 3)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer w.Close()
+
+	assert.False(t, w.Seen("id0"))
+	for _, id := range []string{"id1", "id2", "id3"} {
+		assert.True(t, w.Seen(id), id)
+	}
+}
+
+func TestWindow_Compact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatalf("create temp dir error %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "window")
+	w, err := OpenWindow(filename, 2)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer w.Close()
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, w.Add(fmt.Sprintf("id%d", i)))
+	}
+
+	b, _ := ioutil.ReadFile(filename)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	assert.LessOrEqual(t, len(lines), 4)
+	assert.Equal(t, lines[len(lines)-1], "id9")
+}
@@ -0,0 +1,100 @@
+package edge
+
+import (
+	"strings"
+	"sync"
+)
+
+// cache EdgeStore 的本地读缓存，由后台的 Watch 连接失效。
+// Watch 连接第一次就绪之前不缓存; 断线期间继续使用缓存的值，
+// 重连后服务端补发断线期间的变更，无法补发时清空缓存
+type cache struct {
+	mu     sync.RWMutex
+	values map[string]interface{}
+	// gen 每次失效时增加，读取期间发生变化的值不写入缓存
+	gen   uint64
+	ready bool
+}
+
+func newCache() *cache {
+	return &cache{values: make(map[string]interface{})}
+}
+
+func (c *cache) get(key string) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	val, ok := c.values[key]
+	if !ok {
+		return nil, false
+	}
+	return clone(val), true
+}
+
+// generation 返回读取之前的代数，没有就绪时返回 false
+func (c *cache) generation() (uint64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.gen, c.ready
+}
+
+// put 保存在 gen 时开始读取的值，之后有过失效时丢弃
+func (c *cache) put(key string, val interface{}, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ready && c.gen == gen {
+		c.values[key] = clone(val)
+	}
+}
+
+// invalidate 删除 key 及其上下级的键，例如 net.eth0 的变更使 net 与 net.eth0.ip 失效
+func (c *cache) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	for k := range c.values {
+		if k == key || strings.HasPrefix(k, key+".") || strings.HasPrefix(key, k+".") {
+			delete(c.values, k)
+		}
+	}
+}
+
+// resume Watch 连接就绪，reset 为 true 时断线期间的变更无法补发，清空缓存
+func (c *cache) resume(reset bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if reset {
+		c.gen++
+		c.values = make(map[string]interface{})
+	}
+	c.ready = true
+}
+
+func (c *cache) len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.values)
+}
+
+// clone 复制对象与数组，调用者修改返回的值不影响缓存
+func clone(val interface{}) interface{} {
+	switch x := val.(type) {
+	case map[string]interface{}:
+		var out = make(map[string]interface{}, len(x))
+		for k, v := range x {
+			out[k] = clone(v)
+		}
+		return out
+	case []interface{}:
+		var out = make([]interface{}, len(x))
+		for i, v := range x {
+			out[i] = clone(v)
+		}
+		return out
+	default:
+		return val
+	}
+}
@@ -0,0 +1,146 @@
+package edge
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hysios/edgekv/sse"
+	"github.com/hysios/edgekv/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_Invalidate(t *testing.T) {
+	c := newCache()
+	gen, ready := c.generation()
+	c.put("net", map[string]interface{}{"eth0": "up"}, gen)
+	assert.False(t, ready)
+	assert.Equal(t, 0, c.len(), "not cached before the watch is ready")
+
+	c.resume(true)
+	gen, _ = c.generation()
+	c.put("net", map[string]interface{}{"eth0": "up"}, gen)
+	c.put("net.eth0.ip", "10.0.0.2", gen)
+	c.put("network", 1, gen)
+
+	// 修改返回的值不影响缓存
+	val, _ := c.get("net")
+	val.(map[string]interface{})["eth0"] = "down"
+	val, _ = c.get("net")
+	assert.Equal(t, map[string]interface{}{"eth0": "up"}, val)
+
+	// 上下级的键都失效，network 不受影响
+	c.invalidate("net.eth0")
+	assert.Equal(t, 1, c.len())
+	_, ok := c.get("network")
+	assert.True(t, ok)
+
+	// 读取期间发生过失效的值不写入
+	c.put("net", "stale", gen)
+	_, ok = c.get("net")
+	assert.False(t, ok)
+
+	c.resume(false)
+	assert.Equal(t, 1, c.len())
+	c.resume(true)
+	assert.Equal(t, 0, c.len())
+}
+
+// cacheServer 模拟 Edge 服务的 /key 与 /watch, 每次 Watch 连接发送 readies 中的 ready 事件
+type cacheServer struct {
+	hits    int32
+	down    int32
+	readies chan string
+	events  chan EdgeEvent
+	drop    chan struct{}
+}
+
+func (s *cacheServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/key/a" {
+		atomic.AddInt32(&s.hits, 1)
+		if atomic.LoadInt32(&s.down) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		b, _ := utils.Marshal(EdgeData{Status: "success", Data: "1"})
+		w.Write(b)
+		return
+	}
+
+	sw, err := sse.NewWriter(w)
+	if err != nil {
+		return
+	}
+	sw.Retry(10 * time.Millisecond)
+	sw.Send(sse.Event{Event: EventReady, Data: []byte(<-s.readies)})
+
+	for {
+		select {
+		case ev := <-s.events:
+			b, _ := utils.Marshal(ev)
+			sw.Send(sse.Event{ID: "1-1", Event: EventChange, Data: []byte(base64.StdEncoding.EncodeToString(b))})
+		case <-s.drop:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func TestEdgeStore_Cache(t *testing.T) {
+	var s = &cacheServer{readies: make(chan string, 2), events: make(chan EdgeEvent), drop: make(chan struct{})}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	s.readies <- ReadyReset
+	db, err := Open(ts.URL + "?cache=true")
+	assert.NoError(t, err)
+	store := db.(*EdgeStore)
+	defer store.Close()
+
+	waitFor(t, func() bool {
+		_, ready := store.cache.generation()
+		return ready
+	})
+
+	// 第一次读取之后使用缓存
+	assert.Equal(t, "1", store.GetString("a"))
+	assert.Equal(t, "1", store.GetString("a"))
+	assert.EqualValues(t, 1, atomic.LoadInt32(&s.hits))
+
+	s.events <- EdgeEvent{Key: "a", Change: "2"}
+	waitFor(t, func() bool { return store.cache.len() == 0 })
+	assert.Equal(t, "1", store.GetString("a"))
+	assert.EqualValues(t, 2, atomic.LoadInt32(&s.hits))
+
+	// Edge 服务重启期间继续使用缓存的值
+	atomic.StoreInt32(&s.down, 1)
+	s.drop <- struct{}{}
+	assert.Equal(t, "1", store.GetString("a"))
+	assert.EqualValues(t, 2, atomic.LoadInt32(&s.hits))
+
+	// 重连之后无法补发时清空缓存
+	s.readies <- ReadyReset
+	waitFor(t, func() bool { return store.cache.len() == 0 })
+	_, ok := store.Get("a")
+	assert.False(t, ok)
+}
+
+func TestOpen_InvalidCache(t *testing.T) {
+	_, err := Open("tcp://gw:7070?cache=maybe")
+	assert.Error(t, err)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("condition not satisfied in time")
+}
@@ -6,51 +6,120 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io/ioutil"
-	"net"
 	"net/http"
 	"net/url"
 	"path"
-	"path/filepath"
-	"strings"
+	"strconv"
 
+	"github.com/gorilla/websocket"
 	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/sse"
+	"github.com/hysios/edgekv/stream"
 	"github.com/hysios/edgekv/utils"
 	"github.com/hysios/log"
 )
 
+// UnixSock 默认的 Edge 服务 unix socket 文件
 var UnixSock = "/var/run/edgekv.sock"
 
 type EdgeStore struct {
 	edgekv.Accessor
 
 	client http.Client
-	q      url.Values
-	_host  string
+	base   url.URL
+	dialer *websocket.Dialer
+	cache  *cache
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-func Open() (edgekv.Database, error) {
-	var store = &EdgeStore{}
-	client := http.Client{
-		Transport: &http.Transport{
-			DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
-				return net.Dial("unix", UnixSock)
-			},
-		},
+// Open 连接到 dsn 指定的 Edge 服务，例如 unix:///run/edgekv.sock 或 https://gw:7070,
+// 没有指定时连接本机的 UnixSock; grpc://gw:7071 与 grpc+unix:///run/edgekv-grpc.sock
+// 使用 gRPC 接口，返回 *GRPCStore, 不支持任何参数; cache=true 时开启本地读缓存，见 EnableCache
+func Open(args ...string) (edgekv.Database, error) {
+	var dsn = DefaultDSN()
+	if len(args) > 0 && len(args[0]) > 0 {
+		dsn = args[0]
 	}
 
+	ep, err := ParseEndpoint(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if ep.GRPC {
+		return openGRPC(ep)
+	}
+
+	transport, err := ep.Transport()
+	if err != nil {
+		return nil, err
+	}
+
+	dialer, err := ep.Dialer()
+	if err != nil {
+		return nil, err
+	}
+
+	var store = &EdgeStore{
+		client: http.Client{Transport: transport},
+		base:   ep.URL(),
+		dialer: dialer,
+	}
+	store.ctx, store.cancel = context.WithCancel(context.Background())
 	store.Accessor = edgekv.MakeAccessor(&EdgeWrap{store})
-	store.client = client
 
+	if s := ep.Query.Get("cache"); len(s) > 0 {
+		enable, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("edge: invalid cache '%s'", s)
+		}
+		if enable {
+			store.EnableCache()
+		}
+	}
 	return store, nil
 }
 
+// EnableCache 开启本地读缓存，Get 与 Accessor 读到的值保存在内存中，
+// 由后台订阅所有键的 Watch 连接在变更时失效。Edge 服务短暂重启期间继续返回缓存的值,
+// 重连后无法补发断线期间的变更时清空缓存
+func (edge *EdgeStore) EnableCache() {
+	if edge.cache != nil {
+		return
+	}
+
+	var (
+		c      = newCache()
+		uri    = edge.parseKey(path.Join("watch", "*")) + "?format=gob"
+		client = &sse.Client{HTTP: &edge.client}
+	)
+	edge.cache = c
+
+	go client.Stream(edge.ctx, uri, func(ev sse.Event) {
+		switch ev.Event {
+		case EventReady:
+			c.resume(string(ev.Data) != ReadyResumed)
+		case EventChange:
+			event, err := decodeEvent(ev.Data)
+			if err != nil {
+				// 无法确定失效的键
+				log.Errorf("edge: decode cache event error %s", err)
+				c.resume(true)
+				return
+			}
+			c.invalidate(event.Key)
+		}
+	})
+}
+
+// SetHost 设置请求的主机名，TCP 连接时同时改变连接的地址
 func (edge *EdgeStore) SetHost(host string) {
-	edge._host = host
+	edge.base.Host = host
 }
 
 func (edge *EdgeStore) host(path string) string {
-	name := filepath.Base(UnixSock)
-	return fmt.Sprintf("http://%s/%s", name, path)
+	return fmt.Sprintf("%s/%s", edge.base.String(), path)
 }
 
 type EdgeData struct {
@@ -59,11 +128,21 @@ type EdgeData struct {
 	Error  string      `json:"error,omitempty"`
 }
 
+// Watch 事件流中的事件名称，EventReady 在补发之后发送，数据为 ReadyResumed 或 ReadyReset,
+// ReadyReset 表示 Last-Event-ID 之后的变更已经无法补发 (服务重启或超出保留的数量),
+// 客户端应丢弃据此缓存的数据
+const (
+	EventChange  = "change"
+	EventReady   = "ready"
+	ReadyResumed = "resumed"
+	ReadyReset   = "reset"
+)
+
 type EdgeEvent struct {
-	Method    string
-	SessionID string
-	Key       string
-	Change    interface{}
+	Method    string      `json:"method,omitempty"`
+	SessionID string      `json:"sessionID,omitempty"`
+	Key       string      `json:"key"`
+	Change    interface{} `json:"change"`
 }
 
 type EdgeWrap struct {
@@ -79,6 +158,23 @@ func (wrap *EdgeWrap) Keys() []string {
 }
 
 func (edge *EdgeStore) Get(key string, opts ...edgekv.GetOpt) (interface{}, bool) {
+	if edge.cache == nil {
+		return edge.fetch(key)
+	}
+
+	if val, ok := edge.cache.get(key); ok {
+		return val, true
+	}
+
+	gen, _ := edge.cache.generation()
+	val, ok := edge.fetch(key)
+	if ok {
+		edge.cache.put(key, val, gen)
+	}
+	return val, ok
+}
+
+func (edge *EdgeStore) fetch(key string) (interface{}, bool) {
 	var (
 		path                                      = edge.host(path.Join("key", key))
 		decoder func([]byte) (interface{}, error) = edge.decodeGob
@@ -89,6 +185,7 @@ func (edge *EdgeStore) Get(key string, opts ...edgekv.GetOpt) (interface{}, bool
 	if err != nil {
 		return nil, false
 	}
+	defer resp.Body.Close()
 
 	b := edge.readBody(resp)
 	if val, err = decoder(b); err != nil {
@@ -110,6 +207,7 @@ func (edge *EdgeStore) Keys(opts ...edgekv.GetOpt) []string {
 	if err != nil {
 		return nil
 	}
+	defer resp.Body.Close()
 
 	b := edge.readBody(resp)
 	if val, err = decoder(b); err != nil {
@@ -144,38 +242,47 @@ func (edge *EdgeStore) Set(key string, val interface{}, opts ...edgekv.SetOpt) {
 		return
 	}
 	req.Header.Add("Content-Type", edgekv.BinaryMimeType)
-	edge.client.Do(req)
+	if resp, err := edge.client.Do(req); err == nil {
+		resp.Body.Close()
+	}
+
+	if edge.cache != nil {
+		edge.cache.invalidate(key)
+	}
 }
 
-func (edge *EdgeStore) Watch(prefix string, fn edgekv.ChangeFunc) {
+// Watch 在后台订阅 Edge 服务上匹配 pattern 的变更，断开后自动重连并补发断线期间的变更
+func (edge *EdgeStore) Watch(pattern string, fn edgekv.ChangeFunc) {
 	var (
-		path = edge.host(path.Join("watch", prefix))
-		u    *url.URL
-		req  *http.Request
-		err  error
+		uri    = edge.parseKey(path.Join("watch", pattern)) + "?format=gob"
+		client = &sse.Client{HTTP: &edge.client}
 	)
 
-	if u, err = url.Parse(path); err != nil {
-		log.Debugf("parse key '%s' error %s", path, err)
-		return
-	}
+	go client.Stream(edge.ctx, uri, func(ev sse.Event) {
+		if ev.Event != EventChange {
+			return
+		}
 
-	if req, err = http.NewRequest(http.MethodGet, u.String(), nil); err != nil {
-		log.Debugf("new req error %s", err)
-		return
-	}
+		event, err := decodeEvent(ev.Data)
+		if err != nil {
+			log.Errorf("edge: decode watch event error %s", err)
+			return
+		}
+		fn(event.Key, nil, event.Change)
+	})
+}
 
-	req.Header.Add("Content-Type", edgekv.BinaryMimeType)
-	resp, err := edge.client.Do(req)
+func decodeEvent(data []byte) (*EdgeEvent, error) {
+	b, err := base64.StdEncoding.DecodeString(string(data))
 	if err != nil {
-		log.Debugf("req error %s", err)
-		return
+		return nil, fmt.Errorf("edge: decode base64 error %w", err)
 	}
 
-	s := NewFrameScanner(resp.Body)
-	for event := range s.DecodeFrame() {
-		fn(event.Key, nil, event.Change)
+	var event EdgeEvent
+	if err = utils.Unmarshal(b, &event); err != nil {
+		return nil, fmt.Errorf("edge: unmarshal event error %w", err)
 	}
+	return &event, nil
 }
 
 func (edge *EdgeStore) Bind(key string, fn edgekv.BindHandler) error {
@@ -186,52 +293,50 @@ func (edge *EdgeStore) Bind(key string, fn edgekv.BindHandler) error {
 		path = edge.parseKey(path.Join("bind_observer", key))
 	)
 
-	msgsend, err := Connect(path)
+	client, err := dial(path, edge.dialer)
 	if err != nil {
 		return err
 	}
 
-	msgsend.MessageMsg(func(msg edgekv.Message) {
-		switch msg.Type {
-		case edgekv.CmdGetBind:
-			if getmsg, ok := msg.Payload.(edgekv.MessageGetBind); ok {
-				getVal, found := fn(edgekv.BindGet, getmsg.Key, nil)
-				msgsend.SendMsg(edgekv.Message{
-					Type: edgekv.CmdRetBind,
-					Payload: edgekv.MessageRetBind{
-						Key:   getmsg.Key,
-						Value: getVal,
-						Found: found,
-					},
-				})
-			}
-		case edgekv.CmdSetBind:
-		case edgekv.CmdDeleteBind:
+	rpc := stream.NewRPC(client)
+
+	rpc.Handle(MethodBindGet, func(ctx context.Context, req *stream.Request) (interface{}, error) {
+		var get edgekv.MessageGetBind
+		if err := req.Decode(&get); err != nil {
+			return nil, err
 		}
+
+		val, found := fn(edgekv.BindGet, get.Key, nil)
+		return edgekv.MessageRetBind{Key: get.Key, SessionID: get.SessionID, Value: val, Found: found}, nil
+	})
+
+	rpc.Handle(MethodBindSet, func(ctx context.Context, req *stream.Request) (interface{}, error) {
+		var set edgekv.MessageSetBind
+		if err := req.Decode(&set); err != nil {
+			return nil, err
+		}
+
+		fn(edgekv.BindSet, set.Key, set.Value)
+		return nil, nil
+	})
+
+	rpc.Handle(MethodBindDelete, func(ctx context.Context, req *stream.Request) (interface{}, error) {
+		var del edgekv.MessageDeleteBind
+		if err := req.Decode(&del); err != nil {
+			return nil, err
+		}
+
+		fn(edgekv.BindDelete, del.Key, nil)
+		return nil, nil
 	})
 
-	// if req, err = http.NewRequest(http.MethodGet, path, nil); err != nil {
-	// 	return fmt.Errorf("new req error %w", err)
-	// }
-
-	// req.Header.Add("Content-Type", edgekv.BinaryMimeType)
-	// if resp, err = edge.client.Do(req); err != nil {
-	// 	return fmt.Errorf("req error %s", err)
-	// }
-
-	// s := NewFrameScanner(resp.Body)
-	// for event := range s.DecodeFrame() {
-	// 	meth := edgekv.BindMethod(event.Method)
-	// 	switch meth {
-	// 	case edgekv.BindGet:
-	// 		readVal, ok := fn(meth, key, nil)
-	// 		edge.upstreamSync(event.SessionID, readVal, ok)
-	// 	case edgekv.BindSet:
-	// 		fn(meth, key, event.Change)
-	// 	case edgekv.BindDelete:
-	// 		// TODO: Bind Delete
-	// 	}
-	// }
+	return nil
+}
+
+// Close 停止后台的 Watch 与缓存的连接
+func (edge *EdgeStore) Close() error {
+	edge.cancel()
+	edge.client.CloseIdleConnections()
 	return nil
 }
 
@@ -249,31 +354,12 @@ func (edge *EdgeStore) upstreamSync(sessID string, val interface{}, ok bool) {
 	}
 
 	req.Header.Add("Content-Type", edgekv.BinaryMimeType)
-	if _, err = edge.client.Do(req); err != nil {
+	resp, err := edge.client.Do(req)
+	if err != nil {
 		log.Debugf("req error %s", err)
 		return
 	}
-}
-
-func (edge *EdgeStore) decodeFrame(frame string) (*EdgeEvent, error) {
-	var (
-		ss    = strings.Split(frame, "change:")
-		event = &EdgeEvent{}
-		b     []byte
-		err   error
-	)
-
-	raw := strings.TrimSpace(ss[1])
-	log.Infof("ss: %v", raw)
-	if b, err = base64.StdEncoding.DecodeString(raw); err != nil {
-		return nil, fmt.Errorf("edge: decoder base64 error %s", err)
-	}
-
-	if err = utils.Unmarshal(b, event); err != nil {
-		return nil, fmt.Errorf("edge: unmarshal error %s", err)
-	}
-
-	return event, nil
+	resp.Body.Close()
 }
 
 func (edge *EdgeStore) parseKey(key string) string {
@@ -291,15 +377,6 @@ func (edge *EdgeStore) parseKey(key string) string {
 	return u.String()
 }
 
-func (edge *EdgeStore) watchSplit(data []byte, atEOF bool) (advance int, token []byte, err error) {
-	p := bytes.IndexAny(data, "\n\n")
-	if p > 0 {
-		return p, data[:p], nil
-	}
-
-	return 0, nil, nil
-}
-
 func (edge *EdgeStore) readBody(resp *http.Response) []byte {
 	b, _ := ioutil.ReadAll(resp.Body)
 	return b
@@ -0,0 +1,306 @@
+package edgeserve
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/openapi"
+	"github.com/hysios/log"
+)
+
+// APIPrefix JSON API 的路径前缀
+const APIPrefix = "/api/v1"
+
+// MaxBodySize JSON API 请求体的最大长度
+var MaxBodySize int64 = 1 << 20
+
+// JSON API 响应的状态
+const (
+	StatusSuccess = "success"
+	StatusError   = "error"
+)
+
+// APIResponse JSON API 的响应，成功时 data 为结果，失败时 code 为 HTTP 状态码，error 为错误信息
+type APIResponse struct {
+	Status string      `json:"status"`
+	Data   interface{} `json:"data,omitempty"`
+	Code   int         `json:"code,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// KeyValue 键值, 请求 ?schema=true 时带有值的 Schema
+type KeyValue struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Schema *Schema     `json:"schema,omitempty"`
+}
+
+// SetItem 写入的键值，value 按 schema 解码，PUT /keys/{key} 时 key 取自路径
+type SetItem struct {
+	Key    string          `json:"key,omitempty"`
+	Value  json.RawMessage `json:"value"`
+	Schema *Schema         `json:"schema,omitempty"`
+}
+
+type BulkGetRequest struct {
+	Keys []string `json:"keys"`
+}
+
+// BulkGetResult 批量读取的结果，不存在的键在 missing 中
+type BulkGetResult struct {
+	Items   []KeyValue `json:"items"`
+	Missing []string   `json:"missing"`
+}
+
+type BulkSetRequest struct {
+	Items []SetItem `json:"items"`
+}
+
+type BulkSetResult struct {
+	Keys []string `json:"keys"`
+}
+
+// apiError 带有 HTTP 状态码的错误
+type apiError struct {
+	code int
+	err  error
+}
+
+func (e *apiError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &apiError{code: http.StatusBadRequest, err: fmt.Errorf(format, args...)}
+}
+
+// routeAPI 注册 JSON API, 嵌套的键可以写作 net.eth0.ip 或 net/eth0/ip
+//
+//	GET  /api/v1/keys             所有的键
+//	GET  /api/v1/keys/{key}       读取键值
+//	PUT  /api/v1/keys/{key}       写入键值，请求为 {"value": ..., "schema": {...}}
+//	POST /api/v1/bulk/get         批量读取，请求为 {"keys": [...]}
+//	POST /api/v1/bulk/set         批量写入，请求为 {"items": [{"key": ..., "value": ..., "schema": {...}}]}
+//	GET  /api/v1/openapi.json     OpenAPI 文档
+//
+// 读取时加上 ?schema=true 返回值的 Schema
+func (serve *EdgeServer) routeAPI(r *mux.Router) {
+	api := r.PathPrefix(APIPrefix).Subrouter()
+	openapi.Register(api, serve.apiRoutes())
+
+	api.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiAbort(w, &apiError{code: http.StatusNotFound, err: fmt.Errorf("not found '%s'", r.URL.Path)})
+	})
+	api.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiAbort(w, &apiError{code: http.StatusMethodNotAllowed, err: fmt.Errorf("method %s not allowed", r.Method)})
+	})
+}
+
+// APIKeys 返回所有的键
+func (serve *EdgeServer) APIKeys(w http.ResponseWriter, r *http.Request) {
+	keys := serve.store.AllKeys()
+	if keys == nil {
+		keys = []string{}
+	}
+	apiJSON(w, keys)
+}
+
+// APIGet 读取键值
+func (serve *EdgeServer) APIGet(w http.ResponseWriter, r *http.Request) {
+	key, err := apiKey(mux.Vars(r)["key"])
+	if err != nil {
+		apiAbort(w, err)
+		return
+	}
+
+	kv, ok := serve.getValue(key, withSchema(r))
+	if !ok {
+		apiAbort(w, &apiError{code: http.StatusNotFound, err: fmt.Errorf("not found key '%s'", key)})
+		return
+	}
+	apiJSON(w, kv)
+}
+
+// APISet 写入键值，并同步到 Center
+func (serve *EdgeServer) APISet(w http.ResponseWriter, r *http.Request) {
+	var item SetItem
+	if err := decodeRequest(w, r, &item); err != nil {
+		apiAbort(w, err)
+		return
+	}
+	item.Key = mux.Vars(r)["key"]
+
+	key, val, err := decodeItem(item)
+	if err != nil {
+		apiAbort(w, err)
+		return
+	}
+
+	if err = serve.setValue(key, val); err != nil {
+		apiAbort(w, err)
+		return
+	}
+	apiJSON(w, KeyValue{Key: key, Value: EncodeValue(val)})
+}
+
+// APIBulkGet 批量读取键值
+func (serve *EdgeServer) APIBulkGet(w http.ResponseWriter, r *http.Request) {
+	var req BulkGetRequest
+	if err := decodeRequest(w, r, &req); err != nil {
+		apiAbort(w, err)
+		return
+	}
+
+	var (
+		result = BulkGetResult{Items: []KeyValue{}, Missing: []string{}}
+		schema = withSchema(r)
+	)
+	for _, k := range req.Keys {
+		key, err := apiKey(k)
+		if err != nil {
+			apiAbort(w, err)
+			return
+		}
+
+		if kv, ok := serve.getValue(key, schema); ok {
+			result.Items = append(result.Items, kv)
+		} else {
+			result.Missing = append(result.Missing, key)
+		}
+	}
+	apiJSON(w, result)
+}
+
+// APIBulkSet 批量写入键值，所有的值都解码成功后才开始写入
+func (serve *EdgeServer) APIBulkSet(w http.ResponseWriter, r *http.Request) {
+	var req BulkSetRequest
+	if err := decodeRequest(w, r, &req); err != nil {
+		apiAbort(w, err)
+		return
+	}
+
+	var (
+		keys = make([]string, len(req.Items))
+		vals = make([]interface{}, len(req.Items))
+		err  error
+	)
+	for i, item := range req.Items {
+		if keys[i], vals[i], err = decodeItem(item); err != nil {
+			apiAbort(w, err)
+			return
+		}
+	}
+
+	for i, key := range keys {
+		if err = serve.setValue(key, vals[i]); err != nil {
+			apiAbort(w, fmt.Errorf("set '%s' error %w, %d of %d keys written", key, err, i, len(keys)))
+			return
+		}
+	}
+	apiJSON(w, BulkSetResult{Keys: keys})
+}
+
+func (serve *EdgeServer) getValue(key string, schema bool) (KeyValue, bool) {
+	val, ok := serve.store.Get(key)
+	if !ok {
+		return KeyValue{}, false
+	}
+
+	var kv = KeyValue{Key: key, Value: EncodeValue(val)}
+	if schema {
+		kv.Schema = SchemaOf(val)
+	}
+	return kv, true
+}
+
+// setValue 保存本地的修改，推送给 Watch 连接并同步到 Center
+func (serve *EdgeServer) setValue(key string, val interface{}) error {
+	old, err := serve.store.Set(key, val)
+	if err != nil {
+		return err
+	}
+
+	serve.notify(key, val)
+	return serve.Sync(old, val, key)
+}
+
+func decodeItem(item SetItem) (string, interface{}, error) {
+	key, err := apiKey(item.Key)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if item.Value == nil {
+		return "", nil, badRequest("missing value of '%s'", key)
+	}
+
+	val, err := DecodeValue(item.Value, item.Schema)
+	if err != nil {
+		return "", nil, badRequest("decode '%s' %s", key, err)
+	}
+	return key, val, nil
+}
+
+// apiKey 把路径形式的 net/eth0/ip 转换为 net.eth0.ip
+func apiKey(key string) (string, error) {
+	key = strings.Trim(strings.ReplaceAll(key, "/", "."), ".")
+	if len(key) == 0 {
+		return "", badRequest("empty key")
+	}
+	return key, nil
+}
+
+func withSchema(r *http.Request) bool {
+	ok, _ := strconv.ParseBool(r.URL.Query().Get("schema"))
+	return ok
+}
+
+// decodeRequest 解码 JSON 请求体，Content-Type 为空时按 JSON 处理
+func decodeRequest(w http.ResponseWriter, r *http.Request, val interface{}) error {
+	if ct := r.Header.Get("Content-Type"); len(ct) > 0 {
+		if mediaType(ct) != edgekv.JSONMimeType {
+			return &apiError{code: http.StatusUnsupportedMediaType, err: fmt.Errorf("unsupported content type '%s'", ct)}
+		}
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(val); err != nil {
+		return badRequest("invalid request %s", err)
+	}
+	return nil
+}
+
+func apiJSON(w http.ResponseWriter, data interface{}) {
+	apiWrite(w, http.StatusOK, APIResponse{Status: StatusSuccess, Data: data})
+}
+
+func apiAbort(w http.ResponseWriter, err error) {
+	var (
+		code = http.StatusInternalServerError
+		ae   *apiError
+	)
+	if errors.As(err, &ae) {
+		code = ae.code
+	}
+	apiWrite(w, code, APIResponse{Status: StatusError, Code: code, Error: err.Error()})
+}
+
+func apiWrite(w http.ResponseWriter, code int, resp APIResponse) {
+	b, err := json.Marshal(resp)
+	if err != nil {
+		log.Errorf("edge_server: marshal response error %s", err)
+		code = http.StatusInternalServerError
+		b, _ = json.Marshal(APIResponse{Status: StatusError, Code: code, Error: err.Error()})
+	}
+
+	w.Header().Set("Content-Type", edgekv.JSONMimeType)
+	w.WriteHeader(code)
+	w.Write(b)
+}
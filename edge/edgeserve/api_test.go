@@ -0,0 +1,196 @@
+package edgeserve
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/mq/memory"
+	"github.com/hysios/edgekv/openapi"
+	memstore "github.com/hysios/edgekv/store/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func openAPI(t *testing.T) (*EdgeServer, *httptest.Server) {
+	mq, err := memory.OpenMemoryMQ("memory://api/edgekv")
+	assert.NoError(t, err)
+
+	var serve = &EdgeServer{ID: "API", store: memstore.OpenMapStore(), mq: mq, hub: newWatchHub()}
+	serve.binds = newBindHub(serve)
+	ts := httptest.NewServer(serve.router())
+	t.Cleanup(func() {
+		ts.Close()
+		mq.Close()
+	})
+	return serve, ts
+}
+
+func request(t *testing.T, ts *httptest.Server, method, path, contentType, body string) (int, APIResponse) {
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	assert.NoError(t, err)
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if !assert.NoError(t, err) {
+		return 0, APIResponse{}
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, resp.Header.Get("Content-Type"), edgekv.JSONMimeType)
+
+	var ret APIResponse
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	assert.NoError(t, dec.Decode(&ret))
+	return resp.StatusCode, ret
+}
+
+func TestAPI_GetSet(t *testing.T) {
+	serve, ts := openAPI(t)
+
+	code, resp := request(t, ts, http.MethodPut, "/api/v1/keys/net/eth0", edgekv.JSONMimeType,
+		`{"value": {"ip": "10.0.0.2", "lease": "12h"}, "schema": {"type": "object", "properties": {"lease": {"type": "string", "format": "duration"}}}}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusSuccess, resp.Status)
+
+	// 嵌套的键按 net.eth0.ip 读取，值按 Schema 保存为 time.Duration
+	val, ok := serve.store.Get("net.eth0.lease")
+	assert.True(t, ok)
+	assert.Equal(t, 12*time.Hour, val)
+
+	code, resp = request(t, ts, http.MethodGet, "/api/v1/keys/net.eth0.ip", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]interface{}{"key": "net.eth0.ip", "value": "10.0.0.2"}, resp.Data)
+
+	code, resp = request(t, ts, http.MethodGet, "/api/v1/keys/net.eth0?schema=true", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	data := resp.Data.(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"ip": "10.0.0.2", "lease": "12h0m0s"}, data["value"])
+	assert.Equal(t, map[string]interface{}{"type": "string", "format": "duration"},
+		data["schema"].(map[string]interface{})["properties"].(map[string]interface{})["lease"])
+
+	code, resp = request(t, ts, http.MethodGet, "/api/v1/keys", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []interface{}{"net"}, resp.Data)
+}
+
+func TestAPI_Errors(t *testing.T) {
+	_, ts := openAPI(t)
+
+	var tests = []struct {
+		method, path, contentType, body string
+		code                            int
+	}{
+		{http.MethodGet, "/api/v1/keys/missing", "", "", http.StatusNotFound},
+		{http.MethodPut, "/api/v1/keys/a", "text/plain", `{"value": 1}`, http.StatusUnsupportedMediaType},
+		{http.MethodPut, "/api/v1/keys/a", "", `{"value": 1`, http.StatusBadRequest},
+		{http.MethodPut, "/api/v1/keys/a", "", `{"val": 1}`, http.StatusBadRequest},
+		{http.MethodPut, "/api/v1/keys/a", "", `{}`, http.StatusBadRequest},
+		{http.MethodPut, "/api/v1/keys/a", "", `{"value": "x", "schema": {"type": "integer"}}`, http.StatusBadRequest},
+		{http.MethodDelete, "/api/v1/keys/a", "", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api/v1/unknown", "", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		code, resp := request(t, ts, tt.method, tt.path, tt.contentType, tt.body)
+		assert.Equal(t, tt.code, code, tt.method+" "+tt.path+" "+tt.body)
+		assert.Equal(t, StatusError, resp.Status)
+		assert.Equal(t, tt.code, resp.Code)
+		assert.NotEmpty(t, resp.Error)
+	}
+}
+
+func TestAPI_Bulk(t *testing.T) {
+	serve, ts := openAPI(t)
+
+	code, resp := request(t, ts, http.MethodPost, "/api/v1/bulk/set", edgekv.JSONMimeType+"; charset=utf-8",
+		`{"items": [{"key": "a.b", "value": 1, "schema": {"type": "integer"}}, {"key": "b/c", "value": "on"}]}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]interface{}{"keys": []interface{}{"a.b", "b.c"}}, resp.Data)
+
+	val, _ := serve.store.Get("a.b")
+	assert.Equal(t, int64(1), val)
+
+	code, resp = request(t, ts, http.MethodPost, "/api/v1/bulk/get", "", `{"keys": ["a.b", "b.c", "d"]}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"key": "a.b", "value": json.Number("1")},
+			map[string]interface{}{"key": "b.c", "value": "on"},
+		},
+		"missing": []interface{}{"d"},
+	}, resp.Data)
+
+	// 任何一个值解码失败时不写入
+	code, _ = request(t, ts, http.MethodPost, "/api/v1/bulk/set", "",
+		`{"items": [{"key": "e.f", "value": 1}, {"key": "f.g", "value": "x", "schema": {"type": "boolean"}}]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	_, ok := serve.store.Get("e.f")
+	assert.False(t, ok)
+}
+
+func TestLegacy_SetKeyContentType(t *testing.T) {
+	_, ts := openAPI(t)
+
+	resp, err := http.Post(ts.URL+"/key/a", "text/plain", bytes.NewBufferString("1"))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+
+	resp, err = http.Get(ts.URL + "/keys")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, edgekv.JSONMimeType, resp.Header.Get("Content-Type"))
+}
+
+func TestOpenAPI(t *testing.T) {
+	serve, ts := openAPI(t)
+
+	var reg = openapi.NewRegistry()
+	reg.Register("net", &openapi.Schema{
+		Type:       "object",
+		Properties: map[string]*openapi.Schema{"ip": {Type: "string", Format: "ipv4"}},
+	})
+	serve.SetModels(reg)
+
+	resp, err := http.Get(ts.URL + "/api/v1/openapi.json")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	var doc openapi.Document
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&doc))
+
+	// 所有有处理函数的路由都在文档中，除了没有实现的 /bind/{sessID}
+	r := serve.router()
+	r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		tpl, err := route.GetPathTemplate()
+		if err != nil || route.GetHandler() == nil || strings.HasPrefix(tpl, "/bind/") {
+			return nil
+		}
+
+		methods, _ := route.GetMethods()
+		path := strings.Replace(tpl, "{key:.+}", "{key}", 1)
+		if assert.Contains(t, doc.Paths, path) {
+			for _, method := range methods {
+				assert.Contains(t, *doc.Paths[path], strings.ToLower(method), path)
+			}
+		}
+		return nil
+	})
+
+	// 模型的路径使用注册的 Schema
+	assert.Contains(t, doc.Paths, "/api/v1/keys/net")
+	assert.Equal(t, "ipv4", doc.Components.Schemas["model.net"].Properties["ip"].Format)
+	assert.Contains(t, doc.Components.Schemas, "APIResponse")
+	assert.Contains(t, doc.Components.Schemas, "EdgeData")
+	assert.Contains(t, (*doc.Paths["/api/v1/keys/{key}"])["get"].Responses, "404")
+}
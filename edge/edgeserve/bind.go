@@ -0,0 +1,166 @@
+package edgeserve
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/edge"
+	"github.com/hysios/edgekv/stream"
+	"github.com/hysios/log"
+)
+
+// binder 一个 bind 观察者，gRPC 的 Bind 流或者 websocket 的 BindObserver 连接
+type binder interface {
+	match(key string) bool
+	get(get *edgekv.MessageGetBind) (edgekv.MessageRetBind, error)
+	set(set *edgekv.MessageSetBind) error
+	del(del *edgekv.MessageDeleteBind) error
+}
+
+// bindHub 管理所有的 bind 观察者，第一个观察者注册时订阅 Center 的 bind 调用,
+// 之后所有的观察者共用这个订阅，调用只交给 pattern 匹配的观察者
+type bindHub struct {
+	serve *EdgeServer
+
+	mu         sync.Mutex
+	subscribed bool
+	binders    map[binder]struct{}
+}
+
+func newBindHub(serve *EdgeServer) *bindHub {
+	return &bindHub{
+		serve:   serve,
+		binders: make(map[binder]struct{}),
+	}
+}
+
+// add 注册观察者，观察者断开后由 remove 移除
+func (hub *bindHub) add(b binder) error {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	if !hub.subscribed {
+		if err := hub.serve.mq.Subscribe(hub.serve.ID.DownTopic(edgekv.TopicBind), hub.dispatch); err != nil {
+			return err
+		}
+		hub.subscribed = true
+	}
+
+	hub.binders[b] = struct{}{}
+	return nil
+}
+
+func (hub *bindHub) remove(b binder) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	delete(hub.binders, b)
+}
+
+// match 返回 pattern 匹配 key 的观察者
+func (hub *bindHub) match(key string) []binder {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	var binders []binder
+	for b := range hub.binders {
+		if b.match(key) {
+			binders = append(binders, b)
+		}
+	}
+	return binders
+}
+
+// dispatch 把 bind 调用交给匹配的观察者，BindGet 回复第一个找到值的观察者的结果,
+// 没有匹配的观察者时不回复，由 Center 的超时处理
+func (hub *bindHub) dispatch(msg edgekv.Message) error {
+	var serve = hub.serve
+
+	switch msg.Type {
+	case edgekv.CmdGetBind:
+		get, ok := msg.Payload.(*edgekv.MessageGetBind)
+		if !ok {
+			return errors.New("edge_server: invalid get bind payload")
+		}
+
+		var (
+			ret     edgekv.MessageRetBind
+			replied bool
+		)
+		for _, b := range hub.match(get.Key) {
+			r, err := b.get(get)
+			if err != nil {
+				hub.logError("get", get.Key, err)
+				continue
+			}
+
+			ret, replied = r, true
+			if ret.Found {
+				break
+			}
+		}
+
+		if !replied {
+			return nil
+		}
+		return serve.mq.Publish(serve.ID.UpTopic(edgekv.TopicBinder), edgekv.NewMessage(string(serve.ID), edgekv.CmdRetBind, ret))
+	case edgekv.CmdSetBind:
+		set, ok := msg.Payload.(*edgekv.MessageSetBind)
+		if !ok {
+			return errors.New("edge_server: invalid set bind payload")
+		}
+
+		for _, b := range hub.match(set.Key) {
+			hub.logError("set", set.Key, b.set(set))
+		}
+		return nil
+	case edgekv.CmdDeleteBind:
+		del, ok := msg.Payload.(*edgekv.MessageDeleteBind)
+		if !ok {
+			return errors.New("edge_server: invalid delete bind payload")
+		}
+
+		for _, b := range hub.match(del.Key) {
+			hub.logError("delete", del.Key, b.del(del))
+		}
+		return nil
+	default:
+		return errors.New("invalid msg type in Bind Get topic")
+	}
+}
+
+// logError 一个观察者的错误不影响其他的观察者，只记录
+func (hub *bindHub) logError(method, key string, err error) {
+	if err = hub.serve.bindError(err); err != nil {
+		log.Errorf("edge_server: bind %s '%s' %s", method, key, err)
+	}
+}
+
+// rpcBinder 一个 websocket 观察者，bind 调用通过连接上的 RPC 转发给客户端的 BindHandler
+type rpcBinder struct {
+	rpc     *stream.RPC
+	matcher edgekv.KeyMatch
+}
+
+func (b *rpcBinder) match(key string) bool {
+	return b.matcher.Match(context.Background(), key)
+}
+
+func (b *rpcBinder) get(get *edgekv.MessageGetBind) (edgekv.MessageRetBind, error) {
+	var ret edgekv.MessageRetBind
+	if err := b.rpc.Call(context.Background(), edge.MethodBindGet, get, &ret); err != nil {
+		return edgekv.MessageRetBind{}, err
+	}
+
+	ret.Key, ret.SessionID = get.Key, get.SessionID
+	return ret, nil
+}
+
+func (b *rpcBinder) set(set *edgekv.MessageSetBind) error {
+	return b.rpc.Call(context.Background(), edge.MethodBindSet, set, nil)
+}
+
+func (b *rpcBinder) del(del *edgekv.MessageDeleteBind) error {
+	return b.rpc.Call(context.Background(), edge.MethodBindDelete, del, nil)
+}
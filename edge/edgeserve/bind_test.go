@@ -0,0 +1,98 @@
+package edgeserve
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/edge"
+	"github.com/hysios/edgekv/stream"
+	"github.com/stretchr/testify/assert"
+)
+
+// bindObserver 连接 BindObserver, 收到的 bind 调用转发到返回的 chan, BindGet 回复 key
+func bindObserver(t *testing.T, url, pattern string) (*stream.Client, chan string) {
+	client, err := stream.NewClient("ws" + strings.TrimPrefix(url, "http") + "/bind_observer/" + pattern)
+	if err != nil {
+		t.Fatalf("connect error %s", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	var (
+		rpc   = stream.NewRPC(client)
+		calls = make(chan string, 100)
+	)
+	rpc.Handle(edge.MethodBindGet, func(ctx context.Context, req *stream.Request) (interface{}, error) {
+		var get edgekv.MessageGetBind
+		if err := req.Decode(&get); err != nil {
+			return nil, err
+		}
+		calls <- edge.MethodBindGet + " " + get.Key
+		return edgekv.MessageRetBind{Value: get.Key, Found: true}, nil
+	})
+	rpc.Handle(edge.MethodBindSet, func(ctx context.Context, req *stream.Request) (interface{}, error) {
+		var set edgekv.MessageSetBind
+		if err := req.Decode(&set); err != nil {
+			return nil, err
+		}
+		calls <- edge.MethodBindSet + " " + set.Key
+		return nil, nil
+	})
+	return client, calls
+}
+
+func TestBindObserver(t *testing.T) {
+	serve, ts := openAPI(t)
+
+	var rets = make(chan *edgekv.MessageRetBind, 10)
+	serve.mq.Subscribe(edgekv.UpWildcard(edgekv.TopicBinder), func(msg edgekv.Message) error {
+		if ret, ok := msg.Payload.(*edgekv.MessageRetBind); ok {
+			rets <- ret
+		}
+		return nil
+	})
+
+	var (
+		devices, deviceCalls = bindObserver(t, ts.URL, "device.*")
+		_, lightCalls        = bindObserver(t, ts.URL, "light.*")
+		bindTopic            = serve.ID.DownTopic(edgekv.TopicBind)
+	)
+
+	assert.Eventually(t, func() bool {
+		return len(serve.binds.match("device.on")) == 1 && len(serve.binds.match("light.on")) == 1
+	}, 3*time.Second, 10*time.Millisecond)
+
+	// 只有匹配的观察者收到调用
+	serve.mq.Publish(bindTopic, edgekv.NewMessage("CENTER", edgekv.CmdSetBind, edgekv.MessageSetBind{Key: "device.on", Value: true}))
+	select {
+	case call := <-deviceCalls:
+		assert.Equal(t, "bind.set device.on", call)
+	case <-time.After(3 * time.Second):
+		t.Fatalf("wait bind set timeout")
+	}
+
+	serve.mq.Publish(bindTopic, edgekv.NewMessage("CENTER", edgekv.CmdGetBind, edgekv.MessageGetBind{Key: "light.on", SessionID: "s1"}))
+	select {
+	case ret := <-rets:
+		assert.Equal(t, "s1", ret.SessionID)
+		assert.Equal(t, "light.on", ret.Key)
+		assert.Equal(t, "light.on", ret.Value)
+		assert.True(t, ret.Found)
+	case <-time.After(3 * time.Second):
+		t.Fatalf("wait bind get timeout")
+	}
+	assert.Equal(t, "bind.get light.on", <-lightCalls)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, deviceCalls, 0)
+	assert.Len(t, lightCalls, 0)
+
+	// 连接断开后移除观察者
+	devices.Close()
+	assert.Eventually(t, func() bool {
+		return len(serve.binds.match("device.on")) == 0
+	}, 3*time.Second, 10*time.Millisecond)
+	assert.Len(t, serve.binds.match("light.on"), 1)
+}
@@ -0,0 +1,262 @@
+package edgeserve
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/edgepb"
+	"github.com/hysios/edgekv/stream"
+	"github.com/hysios/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grpcService 实现 edgepb.EdgeServer, 与 HTTP 接口共用存储、同步与 Watch
+type grpcService struct {
+	edgepb.UnimplementedEdgeServer
+
+	serve *EdgeServer
+}
+
+func (svc *grpcService) Get(ctx context.Context, req *edgepb.GetRequest) (*edgepb.GetResponse, error) {
+	if len(req.Key) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "empty key")
+	}
+
+	val, ok := svc.serve.store.Get(req.Key)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "not found key '%s'", req.Key)
+	}
+
+	v, err := edgepb.NewValue(EncodeValue(val))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &edgepb.GetResponse{Key: req.Key, Value: v}, nil
+}
+
+// Set 按 Schema 解码值后写入，与 JSON API 的 PUT /api/v1/keys/{key} 相同
+func (svc *grpcService) Set(ctx context.Context, req *edgepb.SetRequest) (*edgepb.SetResponse, error) {
+	if len(req.Key) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "empty key")
+	}
+	if req.Value == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "missing value of '%s'", req.Key)
+	}
+
+	var schema *Schema
+	if len(req.Schema) > 0 {
+		if err := json.Unmarshal([]byte(req.Schema), &schema); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid schema %s", err)
+		}
+	}
+
+	raw, err := json.Marshal(req.Value.AsInterface())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	val, err := DecodeValue(raw, schema)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "decode '%s' %s", req.Key, err)
+	}
+
+	if err = svc.serve.setValue(req.Key, val); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &edgepb.SetResponse{}, nil
+}
+
+// Delete 删除键值，Center 上的值同步为 null; 存储没有实现 edgekv.Deleter 时返回 UNIMPLEMENTED
+func (svc *grpcService) Delete(ctx context.Context, req *edgepb.DeleteRequest) (*edgepb.DeleteResponse, error) {
+	deleter, ok := svc.serve.store.(edgekv.Deleter)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "store does not support delete")
+	}
+
+	old, ok := svc.serve.store.Get(req.Key)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "not found key '%s'", req.Key)
+	}
+
+	if err := deleter.Delete(req.Key); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	svc.serve.notify(req.Key, nil)
+
+	if err := svc.serve.Sync(old, nil, req.Key); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &edgepb.DeleteResponse{}, nil
+}
+
+func (svc *grpcService) List(ctx context.Context, req *edgepb.ListRequest) (*edgepb.ListResponse, error) {
+	var keys []string
+	for _, key := range svc.serve.store.AllKeys() {
+		if strings.HasPrefix(key, req.Prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return &edgepb.ListResponse{Keys: keys}, nil
+}
+
+// Watch 与 SSE 的 Watch 相同，事件 ID 可以在两种接口之间续传
+func (svc *grpcService) Watch(req *edgepb.WatchRequest, stream edgepb.Edge_WatchServer) error {
+	var hub = svc.serve.hub
+
+	watcher, replay := hub.subscribe(req.Pattern, req.LastEventId)
+	defer hub.unsubscribe(watcher)
+
+	send := func(ev watchEvent) error {
+		change, err := edgepb.NewValue(EncodeValue(ev.event.Change))
+		if err != nil {
+			log.Errorf("edge_server: watch '%s' %s", ev.event.Key, err)
+			return nil
+		}
+		return stream.Send(&edgepb.WatchEvent{Id: hub.eventID(ev.seq), Key: ev.event.Key, Change: change})
+	}
+
+	for _, ev := range replay {
+		if err := send(ev); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case ev, ok := <-watcher.ch:
+			if !ok {
+				// 跟不上或服务关闭，客户端带着最后的事件 ID 重连
+				return status.Error(codes.Unavailable, "watch closed")
+			}
+
+			if err := send(ev); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// Bind 与 BindObserver 相同，把 Center 的 bind 调用转发给 pattern 匹配的观察者
+func (svc *grpcService) Bind(stream edgepb.Edge_BindServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if len(req.Pattern) == 0 {
+		return status.Error(codes.InvalidArgument, "missing pattern in first bind message")
+	}
+
+	var (
+		serve = svc.serve
+		b     = &bindStream{stream: stream, matcher: edgekv.KeyMatch{Pattern: req.Pattern}}
+	)
+
+	if err = serve.binds.add(b); err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	defer serve.binds.remove(b)
+
+	log.Debugf("Bind: %s", req.Pattern)
+	serve.mq.Publish(serve.ID.UpTopic(edgekv.TopicBinder), edgekv.NewMessage(string(serve.ID), edgekv.CmdDeclareBinder, edgekv.MessageDeclareBinder{
+		Pattern: req.Pattern,
+	}))
+
+	for {
+		ret, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		b.reply(ret)
+	}
+}
+
+// bindStream 一个 gRPC 观察者，回复按 SessionID 交给等待的调用
+type bindStream struct {
+	stream  edgepb.Edge_BindServer
+	matcher edgekv.KeyMatch
+	mu      sync.Mutex
+	pending sync.Map
+}
+
+var (
+	errBindGone    = errors.New("edge_server: bind observer gone")
+	errBindTimeout = errors.New("edge_server: bind get timeout")
+)
+
+// get 发送 BindGet 调用并等待观察者的回复，超过 stream.DefaultCallTimeout 没有回复时返回 errBindTimeout
+func (b *bindStream) get(get *edgekv.MessageGetBind) (edgekv.MessageRetBind, error) {
+	var ch = make(chan *edgepb.BindRequest, 1)
+	b.pending.Store(get.SessionID, ch)
+	defer b.pending.Delete(get.SessionID)
+
+	if err := b.send(&edgepb.BindCall{Method: edgepb.BindMethod_BIND_GET, SessionId: get.SessionID, Key: get.Key}); err != nil {
+		return edgekv.MessageRetBind{}, err
+	}
+
+	select {
+	case ret := <-ch:
+		return edgekv.MessageRetBind{Key: get.Key, SessionID: get.SessionID, Value: ret.Value.AsInterface(), Found: ret.Found}, nil
+	case <-b.stream.Context().Done():
+		return edgekv.MessageRetBind{}, errBindGone
+	case <-time.After(stream.DefaultCallTimeout):
+		return edgekv.MessageRetBind{}, errBindTimeout
+	}
+}
+
+func (b *bindStream) reply(ret *edgepb.BindRequest) {
+	ch, ok := b.pending.Load(ret.SessionId)
+	if !ok {
+		log.Errorf("edge_server: unexpected bind reply '%s'", ret.SessionId)
+		return
+	}
+
+	// 重复的回复丢弃
+	select {
+	case ch.(chan *edgepb.BindRequest) <- ret:
+	default:
+	}
+}
+
+func (b *bindStream) match(key string) bool {
+	return b.matcher.Match(context.Background(), key)
+}
+
+func (b *bindStream) set(set *edgekv.MessageSetBind) error {
+	val, err := edgepb.NewValue(EncodeValue(set.Value))
+	if err != nil {
+		return err
+	}
+	return b.send(&edgepb.BindCall{Method: edgepb.BindMethod_BIND_SET, Key: set.Key, Value: val})
+}
+
+func (b *bindStream) del(del *edgekv.MessageDeleteBind) error {
+	return b.send(&edgepb.BindCall{Method: edgepb.BindMethod_BIND_DELETE, Key: del.Key})
+}
+
+// send 观察者已经断开时返回 errBindGone, grpc 的流不能并发发送
+func (b *bindStream) send(call *edgepb.BindCall) error {
+	if b.stream.Context().Err() != nil {
+		return errBindGone
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.stream.Send(call); err != nil {
+		return errBindGone
+	}
+	return nil
+}
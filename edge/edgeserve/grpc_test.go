@@ -0,0 +1,302 @@
+package edgeserve
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/edge"
+	"github.com/hysios/edgekv/edgepb"
+	"github.com/hysios/edgekv/mq/memory"
+	memstore "github.com/hysios/edgekv/store/memory"
+	"github.com/hysios/edgekv/stream"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func openGRPC(t *testing.T) (*EdgeServer, edgepb.EdgeClient) {
+	svc, client := openGRPCService(t)
+	return svc.serve, client
+}
+
+func openGRPCService(t *testing.T) (*grpcService, edgepb.EdgeClient) {
+	mq, err := memory.OpenMemoryMQ("memory://grpc/edgekv")
+	assert.NoError(t, err)
+
+	var (
+		serve = &EdgeServer{ID: "GRPC", store: memstore.OpenMapStore(), mq: mq, hub: newWatchHub()}
+		ln    = bufconn.Listen(1 << 20)
+		svc   = &grpcService{serve: serve}
+		s     = grpc.NewServer()
+	)
+	serve.binds = newBindHub(serve)
+	edgepb.RegisterEdgeServer(s, svc)
+	go s.Serve(ln)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+
+	t.Cleanup(func() {
+		conn.Close()
+		s.Stop()
+		mq.Close()
+	})
+	return svc, edgepb.NewEdgeClient(conn)
+}
+
+func TestGRPC_GetSet(t *testing.T) {
+	var ctx = context.Background()
+	serve, client := openGRPC(t)
+
+	value, _ := structpb.NewValue(map[string]interface{}{"ip": "10.0.0.2", "lease": "12h"})
+	_, err := client.Set(ctx, &edgepb.SetRequest{
+		Key:    "net.eth0",
+		Value:  value,
+		Schema: `{"type": "object", "properties": {"lease": {"type": "string", "format": "duration"}}}`,
+	})
+	assert.NoError(t, err)
+
+	val, ok := serve.store.Get("net.eth0.lease")
+	assert.True(t, ok)
+	assert.Equal(t, 12*time.Hour, val)
+
+	resp, err := client.Get(ctx, &edgepb.GetRequest{Key: "net.eth0"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]interface{}{"ip": "10.0.0.2", "lease": "12h0m0s"}, resp.Value.AsInterface())
+	}
+
+	list, err := client.List(ctx, &edgepb.ListRequest{Prefix: "n"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"net"}, list.Keys)
+
+	_, err = client.Get(ctx, &edgepb.GetRequest{Key: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.Set(ctx, &edgepb.SetRequest{Key: "a"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Set(ctx, &edgepb.SetRequest{Key: "a", Value: structpb.NewStringValue("x"), Schema: `{"type": "integer"}`})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Delete(ctx, &edgepb.DeleteRequest{Key: "net.eth0.lease"})
+	assert.NoError(t, err)
+	_, err = client.Get(ctx, &edgepb.GetRequest{Key: "net.eth0.lease"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, "10.0.0.2", serve.store.GetString("net.eth0.ip"))
+
+	_, err = client.Delete(ctx, &edgepb.DeleteRequest{Key: "net.eth0.lease"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestGRPC_Watch(t *testing.T) {
+	var ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	serve, client := openGRPC(t)
+
+	stream, err := client.Watch(ctx, &edgepb.WatchRequest{Pattern: "device"})
+	assert.NoError(t, err)
+
+	var events = make(chan *edgepb.WatchEvent, 16)
+	go func() {
+		for {
+			ev, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			events <- ev
+		}
+	}()
+
+	// Watch 在服务端异步订阅，持续发布直到收到
+	var ev *edgepb.WatchEvent
+	for i := 0; ev == nil; i++ {
+		if i == 100 {
+			t.Fatalf("wait watch event timeout")
+		}
+		serve.hub.publish(edge.EdgeEvent{Key: "device", Change: map[string]interface{}{"on": true}})
+		select {
+		case ev = <-events:
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	assert.Equal(t, "device", ev.Key)
+	assert.Equal(t, map[string]interface{}{"on": true}, ev.Change.AsInterface())
+
+	// 带着最后的事件 ID 重连时补发之后的变更
+	serve.hub.publish(edge.EdgeEvent{Key: "other", Change: 1})
+	serve.hub.publish(edge.EdgeEvent{Key: "device", Change: false})
+	cancel()
+
+	resumed, err := client.Watch(context.Background(), &edgepb.WatchRequest{Pattern: "device", LastEventId: ev.Id})
+	assert.NoError(t, err)
+	for {
+		next, err := resumed.Recv()
+		if !assert.NoError(t, err) {
+			return
+		}
+		// 第一次连接时可能多发布了几个事件
+		if next.Change.AsInterface() == false {
+			break
+		}
+	}
+}
+
+func TestGRPC_Bind(t *testing.T) {
+	var ctx = context.Background()
+	serve, client := openGRPC(t)
+
+	stream, err := client.Bind(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&edgepb.BindRequest{Pattern: "device.on"}))
+
+	var rets = make(chan *edgekv.MessageRetBind, 10)
+	serve.mq.Subscribe(edgekv.UpWildcard(edgekv.TopicBinder), func(msg edgekv.Message) error {
+		if ret, ok := msg.Payload.(*edgekv.MessageRetBind); ok {
+			rets <- ret
+		}
+		return nil
+	})
+
+	// 观察者回复 BindGet, 其他调用转发到 calls
+	var calls = make(chan *edgepb.BindCall, 10)
+	go func() {
+		for {
+			call, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			if call.Method == edgepb.BindMethod_BIND_GET {
+				stream.Send(&edgepb.BindRequest{SessionId: call.SessionId, Value: structpb.NewStringValue("yes"), Found: true})
+				continue
+			}
+			calls <- call
+		}
+	}()
+
+	bindTopic := serve.ID.DownTopic(edgekv.TopicBind)
+	var ret *edgekv.MessageRetBind
+	for i := 0; ret == nil; i++ {
+		if i == 100 {
+			t.Fatalf("wait bind reply timeout")
+		}
+		serve.mq.Publish(bindTopic, edgekv.NewMessage("CENTER", edgekv.CmdGetBind, edgekv.MessageGetBind{Key: "device.on", SessionID: "s1"}))
+		select {
+		case ret = <-rets:
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	assert.Equal(t, "s1", ret.SessionID)
+	assert.Equal(t, "yes", ret.Value)
+	assert.True(t, ret.Found)
+
+	serve.mq.Publish(bindTopic, edgekv.NewMessage("CENTER", edgekv.CmdSetBind, edgekv.MessageSetBind{Key: "device.on", Value: false}))
+	select {
+	case call := <-calls:
+		assert.Equal(t, edgepb.BindMethod_BIND_SET, call.Method)
+		assert.Equal(t, false, call.Value.AsInterface())
+	case <-time.After(3 * time.Second):
+		t.Fatalf("wait bind set timeout")
+	}
+}
+
+func TestGRPC_BindDispatch(t *testing.T) {
+	svc, client := openGRPCService(t)
+	serve := svc.serve
+
+	// bind 打开 pattern 的观察者，收到的调用转发到返回的 chan
+	bind := func(ctx context.Context, pattern string) chan *edgepb.BindCall {
+		stream, err := client.Bind(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, stream.Send(&edgepb.BindRequest{Pattern: pattern}))
+
+		var calls = make(chan *edgepb.BindCall, 100)
+		go func() {
+			for {
+				call, err := stream.Recv()
+				if err != nil {
+					return
+				}
+				calls <- call
+			}
+		}()
+		return calls
+	}
+
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		devices     = bind(ctx, "device.*")
+		lights      = bind(context.Background(), "light.*")
+		bindTopic   = serve.ID.DownTopic(edgekv.TopicBind)
+	)
+	defer cancel()
+
+	// Bind 在服务端异步注册，持续发布直到收到
+	setBind := func(key string, calls chan *edgepb.BindCall) *edgepb.BindCall {
+		for i := 0; i < 100; i++ {
+			serve.mq.Publish(bindTopic, edgekv.NewMessage("CENTER", edgekv.CmdSetBind, edgekv.MessageSetBind{Key: key, Value: true}))
+			select {
+			case call := <-calls:
+				return call
+			case <-time.After(20 * time.Millisecond):
+			}
+		}
+		t.Fatalf("wait bind set '%s' timeout", key)
+		return nil
+	}
+
+	assert.Equal(t, "device.on", setBind("device.on", devices).Key)
+	assert.Equal(t, "light.on", setBind("light.on", lights).Key)
+
+	// 只有匹配的观察者收到调用，每个调用只转发一次
+	time.Sleep(50 * time.Millisecond)
+	for len(devices) > 0 {
+		assert.Equal(t, "device.on", (<-devices).Key)
+	}
+	for len(lights) > 0 {
+		assert.Equal(t, "light.on", (<-lights).Key)
+	}
+
+	// 流结束后移除观察者
+	cancel()
+	assert.Eventually(t, func() bool {
+		return len(serve.binds.match("device.on")) == 0
+	}, 3*time.Second, 10*time.Millisecond)
+	assert.Len(t, serve.binds.match("light.on"), 1)
+}
+
+func TestGRPC_BindGetTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { stream.DefaultCallTimeout = timeout }(stream.DefaultCallTimeout)
+	stream.DefaultCallTimeout = 100 * time.Millisecond
+
+	svc, client := openGRPCService(t)
+
+	// 观察者收到调用但不回复
+	bind, err := client.Bind(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, bind.Send(&edgepb.BindRequest{Pattern: "device.*"}))
+	go func() {
+		for {
+			if _, err := bind.Recv(); err != nil {
+				return
+			}
+		}
+	}()
+
+	var binders []binder
+	assert.Eventually(t, func() bool {
+		binders = svc.serve.binds.match("device.on")
+		return len(binders) == 1
+	}, 3*time.Second, 10*time.Millisecond)
+
+	_, err = binders[0].get(&edgekv.MessageGetBind{Key: "device.on", SessionID: "s1"})
+	assert.ErrorIs(t, err, errBindTimeout)
+}
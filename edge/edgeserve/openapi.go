@@ -0,0 +1,340 @@
+package edgeserve
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/edge"
+	"github.com/hysios/edgekv/openapi"
+)
+
+// APIVersion Edge HTTP API 的版本
+const APIVersion = "1.0.0"
+
+// SetModels 设置生成文档使用的模型注册表，没有设置时使用 openapi.DefaultRegistry
+func (serve *EdgeServer) SetModels(reg *openapi.Registry) {
+	serve.models = reg
+}
+
+// OpenAPI 生成 Edge HTTP API 的文档，注册表中的每个模型生成带有类型的 /api/v1/keys/{model} 路径
+func (serve *EdgeServer) OpenAPI() *openapi.Document {
+	doc := openapi.New("EdgeKV Edge API", APIVersion)
+	doc.Info.Description = "Edge 本地的键值 API, 监听在 unix socket 或 Listen 添加的地址上"
+	doc.AddRoutes("", serve.routes())
+	doc.AddRoutes(APIPrefix, serve.apiRoutes())
+	serve.addModels(doc)
+	return doc
+}
+
+func (serve *EdgeServer) registry() *openapi.Registry {
+	if serve.models == nil {
+		return openapi.DefaultRegistry
+	}
+	return serve.models
+}
+
+func (serve *EdgeServer) routes() []openapi.Route {
+	return []openapi.Route{
+		{Method: http.MethodGet, Path: "/key/{key}", Handler: serve.GetKey, Doc: docGetKey},
+		{Method: http.MethodPost, Path: "/key/{key}", Handler: serve.SetKey, Doc: docSetKey},
+		{Method: http.MethodGet, Path: "/keys", Handler: serve.Keys, Doc: docKeys},
+		{Method: http.MethodGet, Path: "/watch/{pattern}", Handler: serve.Watch, Doc: docWatch},
+		{Method: http.MethodGet, Path: "/ws/watch", Handler: serve.WatchSocket, Doc: docWatchSocket},
+		{Method: http.MethodGet, Path: "/bind_observer/{key}", Handler: serve.BindObserver, Doc: docBindObserver},
+		{Method: http.MethodGet, Path: "/bind/{sessID}", Handler: serve.BindRead},
+		{Method: http.MethodPut, Path: "/bind/{sessID}", Handler: serve.BindReceive},
+	}
+}
+
+func (serve *EdgeServer) apiRoutes() []openapi.Route {
+	return []openapi.Route{
+		{Method: http.MethodGet, Path: "/keys", Handler: serve.APIKeys, Doc: docAPIKeys},
+		{Method: http.MethodGet, Path: "/keys/{key:.+}", Handler: serve.APIGet, Doc: docAPIGet},
+		{Method: http.MethodPut, Path: "/keys/{key:.+}", Handler: serve.APISet, Doc: docAPISet},
+		{Method: http.MethodPost, Path: "/bulk/get", Handler: serve.APIBulkGet, Doc: docAPIBulkGet},
+		{Method: http.MethodPost, Path: "/bulk/set", Handler: serve.APIBulkSet, Doc: docAPIBulkSet},
+		{Method: http.MethodGet, Path: "/openapi.json", Handler: openapi.Handler(serve.OpenAPI).ServeHTTP, Doc: docOpenAPI},
+	}
+}
+
+// addModels 为每个模型添加读写的路径，值的类型为模型的 Schema
+func (serve *EdgeServer) addModels(doc *openapi.Document) {
+	reg := serve.registry()
+	for _, model := range reg.Models() {
+		s, _ := reg.Lookup(model)
+		ref := doc.AddSchema("model."+model, s)
+
+		doc.Add(http.MethodGet, APIPrefix+"/keys/"+model, &openapi.Operation{
+			Summary:     "读取模型 " + model,
+			OperationID: "get_" + model,
+			Tags:        []string{"model"},
+			Parameters:  []*openapi.Parameter{schemaParam()},
+			Responses: responses(doc, map[int]*openapi.Schema{
+				http.StatusOK: keyValue(doc, ref),
+			}, http.StatusNotFound),
+		})
+
+		doc.Add(http.MethodPut, APIPrefix+"/keys/"+model, &openapi.Operation{
+			Summary:     "写入模型 " + model,
+			OperationID: "set_" + model,
+			Tags:        []string{"model"},
+			RequestBody: &openapi.RequestBody{
+				Required: true,
+				Content: openapi.JSON(&openapi.Schema{
+					Type:       "object",
+					Properties: map[string]*openapi.Schema{"value": ref, "schema": doc.SchemaFor(Schema{})},
+					Required:   []string{"value"},
+				}),
+			},
+			Responses: responses(doc, map[int]*openapi.Schema{
+				http.StatusOK: keyValue(doc, ref),
+			}, http.StatusBadRequest, http.StatusUnsupportedMediaType, http.StatusInternalServerError),
+		})
+	}
+}
+
+// envelope 成功时 data 为 data 的 APIResponse
+func envelope(doc *openapi.Document, data *openapi.Schema) *openapi.Schema {
+	return &openapi.Schema{AllOf: []*openapi.Schema{
+		doc.SchemaFor(APIResponse{}),
+		{Type: "object", Properties: map[string]*openapi.Schema{"data": data}},
+	}}
+}
+
+func keyValue(doc *openapi.Document, value *openapi.Schema) *openapi.Schema {
+	return &openapi.Schema{AllOf: []*openapi.Schema{
+		doc.SchemaFor(KeyValue{}),
+		{Type: "object", Properties: map[string]*openapi.Schema{"value": value}},
+	}}
+}
+
+// responses 返回 JSON API 的响应，ok 中为成功响应的 data, errs 为可能的错误状态码
+func responses(doc *openapi.Document, ok map[int]*openapi.Schema, errs ...int) map[string]*openapi.Response {
+	var resps = make(map[string]*openapi.Response)
+	for code, data := range ok {
+		resps[strconv.Itoa(code)] = &openapi.Response{
+			Description: http.StatusText(code),
+			Content:     openapi.JSON(envelope(doc, data)),
+		}
+	}
+
+	for _, code := range errs {
+		resps[strconv.Itoa(code)] = &openapi.Response{
+			Description: http.StatusText(code),
+			Content:     openapi.JSON(doc.SchemaFor(APIResponse{})),
+		}
+	}
+	return resps
+}
+
+func schemaParam() *openapi.Parameter {
+	return &openapi.Parameter{
+		Name: "schema", In: "query", Description: "为 true 时返回值的 Schema",
+		Schema: &openapi.Schema{Type: "boolean"},
+	}
+}
+
+func keyParam() *openapi.Parameter {
+	return &openapi.Parameter{
+		Name: "key", In: "path", Required: true, Description: "嵌套的键，net.eth0.ip 或 net/eth0/ip",
+		Schema: &openapi.Schema{Type: "string"},
+	}
+}
+
+func docAPIKeys(doc *openapi.Document) *openapi.Operation {
+	return &openapi.Operation{
+		Summary:     "所有的键",
+		OperationID: "keys",
+		Tags:        []string{"api"},
+		Responses: responses(doc, map[int]*openapi.Schema{
+			http.StatusOK: {Type: "array", Items: &openapi.Schema{Type: "string"}},
+		}),
+	}
+}
+
+func docAPIGet(doc *openapi.Document) *openapi.Operation {
+	return &openapi.Operation{
+		Summary:     "读取键值",
+		OperationID: "get",
+		Tags:        []string{"api"},
+		Parameters:  []*openapi.Parameter{keyParam(), schemaParam()},
+		Responses: responses(doc, map[int]*openapi.Schema{
+			http.StatusOK: doc.SchemaFor(KeyValue{}),
+		}, http.StatusBadRequest, http.StatusNotFound),
+	}
+}
+
+func docAPISet(doc *openapi.Document) *openapi.Operation {
+	return &openapi.Operation{
+		Summary:     "写入键值",
+		Description: "value 按 schema 解码后保存并同步到 Center, 请求中的 key 被忽略",
+		OperationID: "set",
+		Tags:        []string{"api"},
+		Parameters:  []*openapi.Parameter{keyParam()},
+		RequestBody: &openapi.RequestBody{Required: true, Content: openapi.JSON(doc.SchemaFor(SetItem{}))},
+		Responses: responses(doc, map[int]*openapi.Schema{
+			http.StatusOK: doc.SchemaFor(KeyValue{}),
+		}, http.StatusBadRequest, http.StatusUnsupportedMediaType, http.StatusInternalServerError),
+	}
+}
+
+func docAPIBulkGet(doc *openapi.Document) *openapi.Operation {
+	return &openapi.Operation{
+		Summary:     "批量读取键值",
+		OperationID: "bulk_get",
+		Tags:        []string{"api"},
+		Parameters:  []*openapi.Parameter{schemaParam()},
+		RequestBody: &openapi.RequestBody{Required: true, Content: openapi.JSON(doc.SchemaFor(BulkGetRequest{}))},
+		Responses: responses(doc, map[int]*openapi.Schema{
+			http.StatusOK: doc.SchemaFor(BulkGetResult{}),
+		}, http.StatusBadRequest, http.StatusUnsupportedMediaType),
+	}
+}
+
+func docAPIBulkSet(doc *openapi.Document) *openapi.Operation {
+	return &openapi.Operation{
+		Summary:     "批量写入键值",
+		Description: "所有的值都解码成功后才开始写入",
+		OperationID: "bulk_set",
+		Tags:        []string{"api"},
+		RequestBody: &openapi.RequestBody{Required: true, Content: openapi.JSON(doc.SchemaFor(BulkSetRequest{}))},
+		Responses: responses(doc, map[int]*openapi.Schema{
+			http.StatusOK: doc.SchemaFor(BulkSetResult{}),
+		}, http.StatusBadRequest, http.StatusUnsupportedMediaType, http.StatusInternalServerError),
+	}
+}
+
+func docOpenAPI(doc *openapi.Document) *openapi.Operation {
+	return &openapi.Operation{
+		Summary:     "OpenAPI 文档",
+		OperationID: "openapi",
+		Tags:        []string{"api"},
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "OpenAPI 3 文档", Content: openapi.JSON(&openapi.Schema{Type: "object"})},
+		},
+	}
+}
+
+// legacy 旧接口的响应，JSON 或 gob 编码的 edge.EdgeData
+func legacy(doc *openapi.Document, data *openapi.Schema) map[string]openapi.MediaType {
+	return map[string]openapi.MediaType{
+		edgekv.JSONMimeType: {Schema: &openapi.Schema{AllOf: []*openapi.Schema{
+			doc.SchemaFor(edge.EdgeData{}),
+			{Type: "object", Properties: map[string]*openapi.Schema{"data": data}},
+		}}},
+		edgekv.BinaryMimeType: {Schema: &openapi.Schema{Type: "string", Format: "binary"}},
+	}
+}
+
+// abortErr 旧接口的错误响应，由 AbortErr 写入
+func abortErr(code int) *openapi.Response {
+	return &openapi.Response{
+		Description: http.StatusText(code),
+		Content: openapi.JSON(&openapi.Schema{
+			Type: "object",
+			Properties: map[string]*openapi.Schema{
+				"status":  {Type: "string", Enum: []interface{}{StatusError}},
+				"errCode": {Type: "integer"},
+				"errors":  {Type: "string"},
+			},
+		}),
+	}
+}
+
+func docGetKey(doc *openapi.Document) *openapi.Operation {
+	return &openapi.Operation{
+		Summary:     "读取键值 (旧接口)",
+		Description: "请求的 Content-Type 为 application/gob 时返回 gob, 否则返回 JSON",
+		OperationID: "legacy_get",
+		Tags:        []string{"legacy"},
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "OK", Content: legacy(doc, &openapi.Schema{})},
+			"404": abortErr(http.StatusNotFound),
+		},
+	}
+}
+
+func docSetKey(doc *openapi.Document) *openapi.Operation {
+	return &openapi.Operation{
+		Summary:     "写入键值 (旧接口)",
+		OperationID: "legacy_set",
+		Tags:        []string{"legacy"},
+		Parameters: []*openapi.Parameter{{
+			Name: "type", In: "query", Description: "JSON 值的类型，新的客户端使用 JSON API 的 Schema",
+			Schema: &openapi.Schema{Type: "string", Enum: []interface{}{"duration", "time", "bytes"}},
+		}},
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content: map[string]openapi.MediaType{
+				edgekv.JSONMimeType:   {Schema: &openapi.Schema{}},
+				edgekv.BinaryMimeType: {Schema: &openapi.Schema{Type: "string", Format: "binary"}},
+			},
+		},
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "OK", Content: openapi.JSON(&openapi.Schema{
+				Type:       "object",
+				Properties: map[string]*openapi.Schema{"status": {Type: "string", Enum: []interface{}{StatusSuccess}}},
+			})},
+			"415": abortErr(http.StatusUnsupportedMediaType),
+			"500": abortErr(http.StatusInternalServerError),
+		},
+	}
+}
+
+func docKeys(doc *openapi.Document) *openapi.Operation {
+	return &openapi.Operation{
+		Summary:     "所有的键 (旧接口)",
+		OperationID: "legacy_keys",
+		Tags:        []string{"legacy"},
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "OK", Content: legacy(doc, &openapi.Schema{Type: "array", Items: &openapi.Schema{Type: "string"}})},
+		},
+	}
+}
+
+func docWatch(doc *openapi.Document) *openapi.Operation {
+	return &openapi.Operation{
+		Summary:     "以 Server-Sent Events 监听变更",
+		Description: "每个变更为一个 change 事件，data 为 EdgeEvent; 断线后带着 Last-Event-ID 重连时补发之后的变更",
+		OperationID: "watch",
+		Tags:        []string{"watch"},
+		Parameters: []*openapi.Parameter{
+			{Name: "format", In: "query", Description: "data 的编码，gob 时为 base64 编码的 gob",
+				Schema: &openapi.Schema{Type: "string", Enum: []interface{}{"json", "gob"}}},
+			{Name: "Last-Event-ID", In: "header", Description: "最后收到的事件 ID", Schema: &openapi.Schema{Type: "string"}},
+		},
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "事件流", Content: openapi.Content("text/event-stream", doc.SchemaFor(edge.EdgeEvent{}))},
+			"400": abortErr(http.StatusBadRequest),
+		},
+	}
+}
+
+func docWatchSocket(doc *openapi.Document) *openapi.Operation {
+	doc.SchemaFor(SocketRequest{})
+	doc.SchemaFor(SocketMessage{})
+
+	return &openapi.Operation{
+		Summary: "以 websocket 监听变更",
+		Description: "客户端发送 SocketRequest 订阅或取消订阅 pattern, 服务端以 JSON 文本帧发送 SocketMessage, " +
+			"一个连接上可以有多个订阅",
+		OperationID: "watch_socket",
+		Tags:        []string{"watch"},
+		Responses: map[string]*openapi.Response{
+			"101": {Description: "升级为 websocket"},
+		},
+	}
+}
+
+func docBindObserver(doc *openapi.Document) *openapi.Operation {
+	return &openapi.Operation{
+		Summary:     "注册 Bind 观察者",
+		Description: "升级为 websocket 上的 gob RPC, 由 Go 客户端 edge.Bind 使用",
+		OperationID: "bind_observer",
+		Tags:        []string{"bind"},
+		Responses: map[string]*openapi.Response{
+			"101": {Description: "升级为 websocket"},
+		},
+	}
+}
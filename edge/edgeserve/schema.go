@@ -0,0 +1,262 @@
+package edgeserve
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// JSON Schema 的类型
+const (
+	SchemaString  = "string"
+	SchemaInteger = "integer"
+	SchemaNumber  = "number"
+	SchemaBoolean = "boolean"
+	SchemaNull    = "null"
+	SchemaObject  = "object"
+	SchemaArray   = "array"
+)
+
+// Schema JSON Schema 的子集，描述 JSON 值在 Edge 中保存的类型，取代 ?type= 查询参数
+//
+//	{"type": "string", "format": "duration"}        time.Duration, 例如 "1m30s"
+//	{"type": "string", "format": "date-time"}       time.Time, RFC3339
+//	{"type": "string", "contentEncoding": "base64"} []byte
+//	{"type": "integer"}                             int64
+//	{"type": "number"}                              float64
+//	{"type": "object", "properties": {...}}         map[string]interface{}
+//	{"type": "array", "items": {...}}               []interface{}
+//
+// 没有 Schema 或没有 type 时按普通 JSON 解码，数字为 float64
+type Schema struct {
+	Type            string             `json:"type,omitempty"`
+	Format          string             `json:"format,omitempty"`
+	ContentEncoding string             `json:"contentEncoding,omitempty"`
+	Properties      map[string]*Schema `json:"properties,omitempty"`
+	Items           *Schema            `json:"items,omitempty"`
+}
+
+// DecodeValue 按 schema 解码 JSON 值, schema 为 nil 时按普通 JSON 解码
+func DecodeValue(raw json.RawMessage, schema *Schema) (interface{}, error) {
+	var (
+		dec = json.NewDecoder(bytes.NewReader(raw))
+		val interface{}
+	)
+
+	dec.UseNumber()
+	if err := dec.Decode(&val); err != nil {
+		return nil, fmt.Errorf("invalid value %w", err)
+	}
+	return schema.convert(val, "$")
+}
+
+func (s *Schema) convert(val interface{}, path string) (interface{}, error) {
+	if s == nil || len(s.Type) == 0 {
+		return plain(val), nil
+	}
+
+	switch s.Type {
+	case SchemaString:
+		str, ok := val.(string)
+		if !ok {
+			return nil, s.mismatch(path, val)
+		}
+		return s.convertString(str, path)
+	case SchemaInteger:
+		num, ok := val.(json.Number)
+		if !ok {
+			return nil, s.mismatch(path, val)
+		}
+		i, err := num.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid integer '%s'", path, num)
+		}
+		return i, nil
+	case SchemaNumber:
+		num, ok := val.(json.Number)
+		if !ok {
+			return nil, s.mismatch(path, val)
+		}
+		f, err := num.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid number '%s'", path, num)
+		}
+		return f, nil
+	case SchemaBoolean:
+		if _, ok := val.(bool); !ok {
+			return nil, s.mismatch(path, val)
+		}
+		return val, nil
+	case SchemaNull:
+		if val != nil {
+			return nil, s.mismatch(path, val)
+		}
+		return nil, nil
+	case SchemaObject:
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			return nil, s.mismatch(path, val)
+		}
+
+		var out = make(map[string]interface{}, len(m))
+		for k, v := range m {
+			var err error
+			if out[k], err = s.Properties[k].convert(v, path+"."+k); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case SchemaArray:
+		vals, ok := val.([]interface{})
+		if !ok {
+			return nil, s.mismatch(path, val)
+		}
+
+		var out = make([]interface{}, len(vals))
+		for i, v := range vals {
+			var err error
+			if out[i], err = s.Items.convert(v, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("%s: unsupported schema type '%s'", path, s.Type)
+	}
+}
+
+func (s *Schema) convertString(str, path string) (interface{}, error) {
+	if s.ContentEncoding == "base64" {
+		b, err := base64.StdEncoding.DecodeString(str)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid base64 %w", path, err)
+		}
+		return b, nil
+	}
+
+	switch s.Format {
+	case "duration":
+		d, err := time.ParseDuration(str)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid duration '%s'", path, str)
+		}
+		return d, nil
+	case "date-time":
+		t, err := time.Parse(time.RFC3339, str)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid date-time '%s'", path, str)
+		}
+		return t, nil
+	default:
+		return str, nil
+	}
+}
+
+func (s *Schema) mismatch(path string, val interface{}) error {
+	return fmt.Errorf("%s: expected %s, got %s", path, s.Type, jsonType(val))
+}
+
+func jsonType(val interface{}) string {
+	switch val.(type) {
+	case nil:
+		return SchemaNull
+	case bool:
+		return SchemaBoolean
+	case json.Number:
+		return SchemaNumber
+	case string:
+		return SchemaString
+	case []interface{}:
+		return SchemaArray
+	default:
+		return SchemaObject
+	}
+}
+
+// plain 把 json.Number 转换为 float64, 与普通的 JSON 解码一致
+func plain(val interface{}) interface{} {
+	switch x := val.(type) {
+	case json.Number:
+		f, _ := x.Float64()
+		return f
+	case map[string]interface{}:
+		for k, v := range x {
+			x[k] = plain(v)
+		}
+	case []interface{}:
+		for i, v := range x {
+			x[i] = plain(v)
+		}
+	}
+	return val
+}
+
+// SchemaOf 返回保存的值对应的 Schema, 按 SchemaOf 与 EncodeValue 返回的值可以原样写回
+func SchemaOf(val interface{}) *Schema {
+	switch x := val.(type) {
+	case nil:
+		return &Schema{Type: SchemaNull}
+	case bool:
+		return &Schema{Type: SchemaBoolean}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return &Schema{Type: SchemaInteger}
+	case float32, float64:
+		return &Schema{Type: SchemaNumber}
+	case string:
+		return &Schema{Type: SchemaString}
+	case time.Duration:
+		return &Schema{Type: SchemaString, Format: "duration"}
+	case time.Time:
+		return &Schema{Type: SchemaString, Format: "date-time"}
+	case []byte:
+		return &Schema{Type: SchemaString, ContentEncoding: "base64"}
+	case map[string]interface{}:
+		var s = &Schema{Type: SchemaObject, Properties: make(map[string]*Schema, len(x))}
+		for k, v := range x {
+			s.Properties[k] = SchemaOf(v)
+		}
+		return s
+	case []interface{}:
+		// 元素的类型都相同时才有 items
+		var s = &Schema{Type: SchemaArray}
+		for i, v := range x {
+			item := SchemaOf(v)
+			if i == 0 {
+				s.Items = item
+			} else if !reflect.DeepEqual(s.Items, item) {
+				s.Items = nil
+				break
+			}
+		}
+		return s
+	default:
+		return &Schema{}
+	}
+}
+
+// EncodeValue 把保存的值转换为 JSON 中的表示，time.Duration 编码为 "1m30s" 形式的字符串
+func EncodeValue(val interface{}) interface{} {
+	switch x := val.(type) {
+	case time.Duration:
+		return x.String()
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	case map[string]interface{}:
+		var out = make(map[string]interface{}, len(x))
+		for k, v := range x {
+			out[k] = EncodeValue(v)
+		}
+		return out
+	case []interface{}:
+		var out = make([]interface{}, len(x))
+		for i, v := range x {
+			out[i] = EncodeValue(v)
+		}
+		return out
+	default:
+		return val
+	}
+}
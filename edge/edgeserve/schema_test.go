@@ -0,0 +1,89 @@
+package edgeserve
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeValue(t *testing.T) {
+	var tests = []struct {
+		raw    string
+		schema *Schema
+		want   interface{}
+	}{
+		{`1.5`, nil, 1.5},
+		{`{"a": 1}`, nil, map[string]interface{}{"a": float64(1)}},
+		{`"1m30s"`, &Schema{Type: SchemaString, Format: "duration"}, 90 * time.Second},
+		{`"2021-06-01T08:00:00Z"`, &Schema{Type: SchemaString, Format: "date-time"}, time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC)},
+		{`"aGVsbG8="`, &Schema{Type: SchemaString, ContentEncoding: "base64"}, []byte("hello")},
+		{`9007199254740993`, &Schema{Type: SchemaInteger}, int64(9007199254740993)},
+		{`null`, &Schema{Type: SchemaNull}, nil},
+		{
+			`{"timeout": "5s", "retry": 3, "name": "eth0"}`,
+			&Schema{Type: SchemaObject, Properties: map[string]*Schema{
+				"timeout": {Type: SchemaString, Format: "duration"},
+				"retry":   {Type: SchemaInteger},
+			}},
+			map[string]interface{}{"timeout": 5 * time.Second, "retry": int64(3), "name": "eth0"},
+		},
+		{
+			`[1, 2]`,
+			&Schema{Type: SchemaArray, Items: &Schema{Type: SchemaInteger}},
+			[]interface{}{int64(1), int64(2)},
+		},
+	}
+
+	for _, tt := range tests {
+		val, err := DecodeValue(json.RawMessage(tt.raw), tt.schema)
+		if assert.NoError(t, err, tt.raw) {
+			assert.Equal(t, tt.want, val, tt.raw)
+		}
+	}
+}
+
+func TestDecodeValue_Mismatch(t *testing.T) {
+	var tests = []struct {
+		raw    string
+		schema *Schema
+		err    string
+	}{
+		{`"5s"`, &Schema{Type: SchemaInteger}, "$: expected integer, got string"},
+		{`1.5`, &Schema{Type: SchemaInteger}, "$: invalid integer '1.5'"},
+		{`"soon"`, &Schema{Type: SchemaString, Format: "duration"}, "$: invalid duration 'soon'"},
+		{`{"a": [1, "x"]}`, &Schema{Type: SchemaObject, Properties: map[string]*Schema{
+			"a": {Type: SchemaArray, Items: &Schema{Type: SchemaNumber}},
+		}}, "$.a[1]: expected number, got string"},
+		{`1`, &Schema{Type: "tuple"}, "$: unsupported schema type 'tuple'"},
+	}
+
+	for _, tt := range tests {
+		_, err := DecodeValue(json.RawMessage(tt.raw), tt.schema)
+		if assert.Error(t, err, tt.raw) {
+			assert.Equal(t, tt.err, err.Error())
+		}
+	}
+}
+
+func TestSchemaOf_RoundTrip(t *testing.T) {
+	var val = map[string]interface{}{
+		"timeout": 5 * time.Second,
+		"at":      time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC),
+		"raw":     []byte("hello"),
+		"retry":   int64(3),
+		"ratio":   0.5,
+		"tags":    []interface{}{"a", "b"},
+	}
+
+	// 按 SchemaOf 的 Schema 解码 EncodeValue 的结果得到原来的值
+	b, err := json.Marshal(EncodeValue(val))
+	assert.NoError(t, err)
+
+	got, err := DecodeValue(b, SchemaOf(val))
+	assert.NoError(t, err)
+	assert.Equal(t, val, got)
+
+	assert.Nil(t, SchemaOf([]interface{}{"a", 1}).Items)
+}
@@ -2,7 +2,8 @@ package edgeserve
 
 import (
 	"context"
-	"encoding/base64"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"reflect"
 	"strings"
 	"sync"
@@ -19,11 +21,16 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/dedup"
 	"github.com/hysios/edgekv/edge"
+	"github.com/hysios/edgekv/edgepb"
+	"github.com/hysios/edgekv/openapi"
+	"github.com/hysios/edgekv/stream"
 	"github.com/hysios/edgekv/utils"
 	"github.com/hysios/log"
 	. "github.com/hysios/utils/response"
 	"github.com/r3labs/diff/v2"
+	"google.golang.org/grpc"
 )
 
 type Map = map[string]interface{}
@@ -35,27 +42,35 @@ type EdgeServer struct {
 	store        edgekv.Store
 	mq           edgekv.MessageQueue
 	listener     edgekv.Listener
+	dedup        *dedup.Window
+	hub          *watchHub
+	binds        *bindHub
+	listens      []*edge.Endpoint
+	rpc          *grpc.Server
+	models       *openapi.Registry
 	bindSessions sync.Map
 }
 
 var serve = EdgeServer{}
 
+func (serve *EdgeServer) router() *mux.Router {
+	r := mux.NewRouter()
+	openapi.Register(r, serve.routes())
+	serve.routeAPI(r)
+	return r
+}
+
 // Start 启动 Edge 的服务器，服务器主要以下功能
 // 1. 管理与 Center 数据同步，消息推送
 // 2. 提供 socket 客户端调用 API
 func (serve *EdgeServer) Start() error {
 	var err error
 
-	r := mux.NewRouter()
-	r.HandleFunc("/key/{key}", serve.GetKey).Methods(http.MethodGet)
-	r.HandleFunc("/key/{key}", serve.SetKey).Methods(http.MethodPost)
-	r.HandleFunc("/keys", serve.Keys).Methods(http.MethodGet)
-	r.HandleFunc("/watch/{pattern}", serve.Watch).Methods(http.MethodGet)
-	r.HandleFunc("/bind_observer/{key}", serve.BindObserver).Methods(http.MethodGet)
-	r.HandleFunc("/bind/{sessID}", serve.BindRead).Methods(http.MethodGet)
-	r.HandleFunc("/bind/{sessID}", serve.BindReceive).Methods(http.MethodPut)
-
-	serve.Handler = r
+	serve.Handler = serve.router()
+	serve.hub = newWatchHub()
+	serve.binds = newBindHub(serve)
+	serve.rpc = grpc.NewServer()
+	edgepb.RegisterEdgeServer(serve.rpc, &grpcService{serve: serve})
 
 	if serve.mq == nil || serve.store == nil {
 		return errors.New("edge_server: mq or store is missing")
@@ -67,98 +82,155 @@ func (serve *EdgeServer) Start() error {
 
 	go serve.listener.Start()
 
-	topic := edgekv.Edgekey(serve.ID, "sync")
-	if err = serve.mq.Subscribe(topic, func(msg edgekv.Message) error {
-		switch msg.Type {
-		case edgekv.CmdChangelog:
-			var (
-				cmdMsg   = msg.Payload.(*edgekv.MessageChangelog)
-				val      interface{}
-				ok       bool
-				doChange diff.Change
-			)
-			doChange = serve.lastChange(cmdMsg.Changes)
-
-			fullkey := cmdMsg.Key
-			if val, ok = serve.store.Get(fullkey); ok {
-				diff.Patch(cmdMsg.Changes, &val)
-			} else {
-				val = doChange.To
-			}
+	if serve.dedup == nil {
+		serve.dedup = dedup.NewWindow(0)
+	}
 
-			log.Debugf("store => %s Do [%s] change from %v to %v", fullkey, doChange.Type, doChange.From, doChange.To)
-			serve.store.Set(fullkey, val)
-			var event = edgekv.WatchEvent{
-				Key: cmdMsg.Key,
-				Old: val,
-				Val: doChange.To,
-				Done: func(ok bool) {
-					if ok {
-					}
-				},
-			}
+	topic := serve.ID.DownTopic(edgekv.TopicSync)
+	if err = serve.mq.Subscribe(topic, serve.syncProcess); err != nil {
+		return err
+	}
+
+	// 订阅 Center 以保留消息发布的最新配置，(重新) 连接时立即收到
+	desired := serve.ID.DownTopic(path.Join(edgekv.TopicDesired, "#"))
+	if err = serve.mq.Subscribe(desired, serve.desiredProcess); err != nil {
+		return err
+	}
+	return serve.listen()
+}
+
+// syncProcess 应用 Center 的变更，重复投递的消息只应用一次
+func (serve *EdgeServer) syncProcess(msg edgekv.Message) error {
+	if len(msg.ID) > 0 && serve.dedup.Seen(msg.ID) {
+		log.Debugf("edge_server: drop duplicate message '%s'", msg.ID)
+		return nil
+	}
+
+	if err := serve.applySync(msg); err != nil {
+		return err
+	}
+
+	if len(msg.ID) > 0 {
+		if err := serve.dedup.Add(msg.ID); err != nil {
+			log.Errorf("edge_server: record message '%s' error %s", msg.ID, err)
+		}
+	}
+	return nil
+}
 
-			serve.dispatch(fullkey, event)
+func (serve *EdgeServer) applySync(msg edgekv.Message) error {
+	switch msg.Type {
+	case edgekv.CmdChangelog:
+		var (
+			cmdMsg, ok = msg.Payload.(*edgekv.MessageChangelog)
+			val        interface{}
+			doChange   diff.Change
+		)
+		if !ok || len(cmdMsg.Changes) == 0 {
+			return fmt.Errorf("edge_server: invalid changelog payload %T", msg.Payload)
+		}
+		doChange = serve.lastChange(cmdMsg.Changes)
+
+		fullkey := cmdMsg.Key
+		if val, ok = serve.store.Get(fullkey); ok {
+			diff.Patch(cmdMsg.Changes, &val)
+		} else {
+			val = doChange.To
 		}
+
+		log.Debugf("store => %s Do [%s] change from %v to %v", fullkey, doChange.Type, doChange.From, doChange.To)
+		serve.store.Set(fullkey, val)
+		var event = edgekv.WatchEvent{
+			Key: cmdMsg.Key,
+			Old: val,
+			Val: doChange.To,
+			Done: func(ok bool) {
+				if ok {
+				}
+			},
+		}
+
+		serve.dispatch(fullkey, event)
+	}
+	return nil
+}
+
+// desiredProcess 应用订阅时收到的保留配置，连接期间的变化已经通过 sync 频道同步，
+// 忽略非保留的消息避免用较旧的配置覆盖本地刚刚修改的值
+func (serve *EdgeServer) desiredProcess(msg edgekv.Message) error {
+	if msg.Type != edgekv.CmdDesired || !msg.Retained {
 		return nil
-	}); err != nil {
+	}
+
+	cmdMsg, ok := msg.Payload.(*edgekv.MessageDesired)
+	if !ok || cmdMsg.Value == nil {
+		return fmt.Errorf("edge_server: invalid desired payload %T", msg.Payload)
+	}
+
+	old, _ := serve.store.Get(cmdMsg.Key)
+	if reflect.DeepEqual(old, cmdMsg.Value) {
+		return nil
+	}
+
+	log.Infof("edge_server: apply desired config of '%s'", cmdMsg.Key)
+	if _, err := serve.store.Set(cmdMsg.Key, cmdMsg.Value); err != nil {
 		return err
 	}
-	return serve.listenUnix()
+
+	serve.dispatch(cmdMsg.Key, edgekv.WatchEvent{
+		Key:  cmdMsg.Key,
+		Old:  old,
+		Val:  cmdMsg.Value,
+		Done: func(ok bool) {},
+	})
+	return nil
 }
 
-// GetKey 取键值
+// GetKey 取键值，Content-Type 为 edgekv.BinaryMimeType 时返回 gob, 否则返回 JSON
 func (serve *EdgeServer) GetKey(w http.ResponseWriter, r *http.Request) {
 	var (
-		vars    = mux.Vars(r)
-		key     = vars["key"]
-		encoder func(val interface{}, q url.Values) []byte
-		q       = r.URL.Query()
-		val     interface{}
-		ok      bool
+		vars = mux.Vars(r)
+		key  = vars["key"]
+		q    = r.URL.Query()
+		val  interface{}
+		ok   bool
 	)
 
 	log.Debugf("GET: %s", key)
 
-	contentType := r.Header.Get("Content-Type")
-	log.Debugf("context type %s", contentType)
-	encoder = serve.encodeGob
-	switch contentType {
-	case mime.TypeByExtension(".json"), "":
-		encoder = serve.encodeJson
-	case edgekv.BinaryMimeType:
-	}
-
+	contentType, encoder := serve.encoder(r)
 	if val, ok = serve.store.Get(key); !ok {
 		AbortErr(w, http.StatusNotFound, fmt.Errorf("not found key '%s'", key))
 		return
 	}
 
-	b := encoder(edge.EdgeData{Status: "success", Data: val}, q)
-	w.WriteHeader(200)
 	w.Header().Set("Content-Type", contentType)
-	w.Write(b)
+	w.WriteHeader(http.StatusOK)
+	w.Write(encoder(edge.EdgeData{Status: "success", Data: val}, q))
 }
 
-// SetKey 设置键值
+// SetKey 设置键值，JSON 值的类型由 ?type= 指定，新的客户端应使用 JSON API 的 Schema
 func (serve *EdgeServer) SetKey(w http.ResponseWriter, r *http.Request) {
 	var (
-		vars     = mux.Vars(r)
-		key      = vars["key"]
-		err      error
-		decoder  func([]byte, url.Values) interface{}
-		q        = r.URL.Query()
-		b        []byte
-		old, val interface{}
+		vars    = mux.Vars(r)
+		key     = vars["key"]
+		err     error
+		decoder func([]byte, url.Values) interface{}
+		q       = r.URL.Query()
+		b       []byte
+		val     interface{}
 	)
 
 	contentType := r.Header.Get("Content-Type")
 	log.Debugf("context type %s", contentType)
-	switch contentType {
-	case mime.TypeByExtension(".json"), "":
+	switch mediaType(contentType) {
+	case edgekv.JSONMimeType, "":
 		decoder = serve.decodeJson
 	case edgekv.BinaryMimeType:
 		decoder = serve.decodeGob
+	default:
+		AbortErr(w, http.StatusUnsupportedMediaType, fmt.Errorf("unsupported content type '%s'", contentType))
+		return
 	}
 
 	b, _ = ioutil.ReadAll(r.Body)
@@ -167,12 +239,7 @@ func (serve *EdgeServer) SetKey(w http.ResponseWriter, r *http.Request) {
 	val = decoder(b, q)
 
 	log.Debugf("POST: %s with value %v", key, val)
-	if old, err = serve.store.Set(key, val); err != nil {
-		AbortErr(w, http.StatusInternalServerError, err)
-		return
-	}
-
-	if err = serve.Sync(old, val, key); err != nil {
+	if err = serve.setValue(key, val); err != nil {
 		AbortErr(w, http.StatusInternalServerError, err)
 		return
 	}
@@ -182,116 +249,79 @@ func (serve *EdgeServer) SetKey(w http.ResponseWriter, r *http.Request) {
 
 func (serve *EdgeServer) Keys(w http.ResponseWriter, r *http.Request) {
 	var (
-		encoder func(val interface{}, q url.Values) []byte
-		q       = r.URL.Query()
-		b       []byte
+		q    = r.URL.Query()
+		keys = serve.store.AllKeys()
 	)
-	keys := serve.store.AllKeys()
+
 	if keys == nil {
-		AbortErr(w, http.StatusNotFound, fmt.Errorf("not have any keys"))
-		return
-	}
-	log.Infof("keys %v", keys)
-	contentType := r.Header.Get("Content-Type")
-	log.Debugf("context type %s", contentType)
-	encoder = serve.encodeGob
-	switch contentType {
-	case mime.TypeByExtension(".json"), "":
-		encoder = serve.encodeJson
-	case edgekv.BinaryMimeType:
+		keys = []string{}
 	}
 
-	b = encoder(edge.EdgeData{Status: "success", Data: keys}, q)
-	w.WriteHeader(200)
+	contentType, encoder := serve.encoder(r)
 	w.Header().Set("Content-Type", contentType)
-	w.Write(b)
+	w.WriteHeader(http.StatusOK)
+	w.Write(encoder(edge.EdgeData{Status: "success", Data: keys}, q))
 }
 
-// Watch 监听变化的键
-func (sever *EdgeServer) Watch(w http.ResponseWriter, r *http.Request) {
-	var (
-		vars    = mux.Vars(r)
-		pattern = vars["pattern"]
-	)
-
-	type change struct {
-		Key    string
-		Change interface{}
-	}
-	var chEvent = make(chan change)
-
-	serve.watch(pattern, func(key string, old, new interface{}) error {
-		log.Infof("change event key '%s' value => %v", key, new)
-		chEvent <- change{Key: key, Change: new}
-		return nil
-	})
-
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	f, ok := w.(http.Flusher)
-	if ok {
-		f.Flush()
-	} else {
-		log.Infof("Damn, no flush")
-		return
-	}
-
-	for event := range chEvent {
-		log.Infof("event %v", event)
-		b, _ := utils.Marshal(edge.EdgeEvent{Key: event.Key, Change: event.Change})
-		fmt.Fprintf(w, "change: %s\n\n", base64.StdEncoding.EncodeToString(b))
-		f.Flush()
+// encoder 按请求的 Content-Type 选择响应的编码
+func (serve *EdgeServer) encoder(r *http.Request) (string, func(val interface{}, q url.Values) []byte) {
+	if mediaType(r.Header.Get("Content-Type")) == edgekv.BinaryMimeType {
+		return edgekv.BinaryMimeType, serve.encodeGob
 	}
+	return edgekv.JSONMimeType, serve.encodeJson
 }
 
-// BindObserver 的监听服务
-func (sever *EdgeServer) BindObserver(w http.ResponseWriter, r *http.Request) {
+func mediaType(contentType string) string {
+	mt, _, _ := mime.ParseMediaType(contentType)
+	return mt
+}
 
+// Watch 监听变化的键
+// BindObserver 的监听服务，连接断开后移除观察者
+func (serve *EdgeServer) BindObserver(w http.ResponseWriter, r *http.Request) {
 	var (
-		vars   = mux.Vars(r)
-		key    = vars["key"]
-		stream *edge.MsgStream
-		err    error
+		vars = mux.Vars(r)
+		key  = vars["key"]
 	)
 
-	stream, err = edge.Upgrade(w, r)
+	conn, err := stream.Upgrade(w, r)
 	if err != nil {
 		AbortErr(w, http.StatusBadGateway, err)
+		return
 	}
 
-	log.Debugf("Bind: %s", key)
+	var b = &rpcBinder{rpc: stream.NewRPC(conn), matcher: edgekv.KeyMatch{Pattern: key}}
+	if err = serve.binds.add(b); err != nil {
+		log.Errorf("edge_server: bind observer '%s' %s", key, err)
+		conn.Close()
+		return
+	}
 
-	// topic := edgekv.Edgekey(serve.ID, "binder")
-	var msg = edgekv.Message{
-		From: string(serve.ID),
-		Type: edgekv.CmdDeclareBinder,
-		Payload: edgekv.MessageDeclareBinder{
-			Pattern: key,
-		},
-	}
-
-	// msg.Build()
-	serve.mq.Publish("binder", msg) // tell Center observer key binded
-	bindTopic := edgekv.Edgekey(serve.ID, "bind_get")
-
-	// var msgCh = make(chan edgekv.Message)
-	// subscribe bind_get topic, when center to get bind key
-	go serve.mq.Subscribe(bindTopic, func(msg edgekv.Message) error {
-		switch msg.Type {
-		case edgekv.CmdGetBind:
-			stream.SendMsg(msg)
-		case edgekv.CmdSetBind:
-			stream.SendMsg(msg)
-		default:
-			return errors.New("invalid msg type in Bind Get topic")
+	conn.OnState(func(st stream.State) {
+		if st == stream.StateClosed {
+			serve.binds.remove(b)
 		}
-		return nil
 	})
+	if conn.State() == stream.StateClosed {
+		serve.binds.remove(b)
+		return
+	}
 
-	stream.MessageMsg(func(msg edgekv.Message) {
+	log.Debugf("Bind: %s", key)
 
+	var msg = edgekv.NewMessage(string(serve.ID), edgekv.CmdDeclareBinder, edgekv.MessageDeclareBinder{
+		Pattern: key,
 	})
+
+	serve.mq.Publish(serve.ID.UpTopic(edgekv.TopicBinder), msg) // tell Center observer key binded
+}
+
+func (serve *EdgeServer) bindError(err error) error {
+	if errors.Is(err, stream.ErrClosed) || errors.Is(err, stream.ErrDisconnected) || errors.Is(err, errBindGone) {
+		log.Errorf("edge_server: bind observer gone: %s", err)
+		return nil
+	}
+	return err
 }
 
 func (sever *EdgeServer) BindRead(w http.ResponseWriter, r *http.Request) {
@@ -304,9 +334,34 @@ func (sever *EdgeServer) BindReceive(w http.ResponseWriter, r *http.Request) {
 func (serve *EdgeServer) Stop() error {
 	var ctx = context.Background()
 
+	if serve.dedup != nil {
+		serve.dedup.Close()
+	}
+	if serve.hub != nil {
+		serve.hub.close()
+	}
+	if serve.rpc != nil {
+		// Watch 与 Bind 是长连接，不等待结束
+		serve.rpc.Stop()
+	}
 	return serve.Shutdown(ctx)
 }
 
+// EnableDedup 把同步消息的去重窗口保存在 filename 中，最多保留 size 个消息 ID,
+// Edge 重启之后已经应用过的重复消息不会再次应用，没有开启时使用内存中的窗口
+func (serve *EdgeServer) EnableDedup(filename string, size int) error {
+	w, err := dedup.OpenWindow(filename, size)
+	if err != nil {
+		return err
+	}
+
+	if serve.dedup != nil {
+		serve.dedup.Close()
+	}
+	serve.dedup = w
+	return nil
+}
+
 func (serve *EdgeServer) SetEdgeID(id edgekv.EdgeID) {
 	serve.ID = id
 }
@@ -348,14 +403,10 @@ func (serve *EdgeServer) Sync(old, val interface{}, key string) error {
 		return nil
 	}
 
-	return serve.mq.Publish("sync", edgekv.Message{
-		From: string(serve.ID),
-		Type: edgekv.CmdChangelog,
-		Payload: edgekv.MessageChangelog{
-			Key:     key,
-			Changes: changes,
-		},
-	})
+	return serve.mq.Publish(serve.ID.UpTopic(edgekv.TopicSync), edgekv.NewMessage(string(serve.ID), edgekv.CmdChangelog, edgekv.MessageChangelog{
+		Key:     key,
+		Changes: changes,
+	}))
 }
 
 func (serve *EdgeServer) decodeType(val interface{}, b []byte, q url.Values) error {
@@ -423,15 +474,140 @@ func (serve *EdgeServer) decodeGob(b []byte, q url.Values) interface{} {
 	return nil
 }
 
-func (serve *EdgeServer) listenUnix() error {
-	os.Remove(edge.UnixSock)
+// Listen 添加服务监听的地址，例如 unix:///run/edgekv.sock, tcp://:7070 或 https://:7070,
+// https 需要先通过 EnableTLS 或 TLSConfig 设置证书，没有添加时只监听 edge.UnixSock;
+// grpc://:7071 与 grpc+unix:///run/edgekv-grpc.sock 提供 gRPC 接口，见 edgepb.
+//
+// tcp:// 与 grpc:// 没有任何认证，能连接的客户端都可以读写所有的键以及注册 Bind,
+// 只应该监听在可信的网络上; 否则使用 https 并通过 EnableClientAuth 验证客户端证书
+func (serve *EdgeServer) Listen(addr string) error {
+	ep, err := edge.ParseEndpoint(addr)
+	if err != nil {
+		return err
+	}
+
+	serve.listens = append(serve.listens, ep)
+	return nil
+}
+
+// EnableTLS 加载 https 监听使用的证书
+func (serve *EdgeServer) EnableTLS(certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("edge_server: load certificate %w", err)
+	}
+
+	if serve.TLSConfig == nil {
+		serve.TLSConfig = &tls.Config{}
+	}
+	serve.TLSConfig.Certificates = []tls.Certificate{cert}
+	return nil
+}
+
+// EnableClientAuth https 的客户端必须提供由 caFile 中的证书签发的客户端证书
+func (serve *EdgeServer) EnableClientAuth(caFile string) error {
+	b, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return fmt.Errorf("edge_server: read client ca %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return errors.New("edge_server: no certificate found in client ca")
+	}
+
+	if serve.TLSConfig == nil {
+		serve.TLSConfig = &tls.Config{}
+	}
+	serve.TLSConfig.ClientCAs = pool
+	serve.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	return nil
+}
+
+// listen 打开所有监听并开始服务，任何一个监听失败时关闭服务
+func (serve *EdgeServer) listen() error {
+	var (
+		listens   = serve.listens
+		listeners []net.Listener
+	)
+
+	if len(listens) == 0 {
+		listens = []*edge.Endpoint{{Network: "unix", Address: edge.UnixSock}}
+	}
+
+	for _, ep := range listens {
+		ln, err := serve.openListener(ep)
+		if err != nil {
+			for _, ln := range listeners {
+				ln.Close()
+			}
+			return err
+		}
+		listeners = append(listeners, ln)
+	}
+
+	var errs = make(chan error, len(listeners))
+	for i, ln := range listeners {
+		if listens[i].GRPC {
+			go func(ln net.Listener) {
+				// Stop 之后 grpc 的 Serve 返回 nil
+				if err := serve.rpc.Serve(ln); err != nil {
+					errs <- err
+				} else {
+					errs <- http.ErrServerClosed
+				}
+			}(ln)
+			continue
+		}
+
+		go func(ln net.Listener) {
+			errs <- serve.Serve(ln)
+		}(ln)
+	}
+
+	err := <-errs
+	if err != http.ErrServerClosed {
+		serve.Close()
+		serve.rpc.Stop()
+	}
+	return err
+}
+
+func (serve *EdgeServer) openListener(ep *edge.Endpoint) (net.Listener, error) {
+	if ep.Network == "unix" {
+		os.Remove(ep.Address)
+	}
 
-	unixListener, err := net.Listen("unix", edge.UnixSock)
+	ln, err := net.Listen(ep.Network, ep.Address)
 	if err != nil {
-		return fmt.Errorf("edgeServer: listen unix %w", err)
+		return nil, fmt.Errorf("edge_server: listen %s %w", ep.Network, err)
+	}
+
+	if ep.TLS {
+		if serve.TLSConfig == nil || (len(serve.TLSConfig.Certificates) == 0 && serve.TLSConfig.GetCertificate == nil) {
+			ln.Close()
+			return nil, errors.New("edge_server: https listener requires a certificate")
+		}
+		ln = tls.NewListener(ln, serve.TLSConfig)
+	}
+
+	log.Infof("Edgekv EdgeServer listen on %s", serve.listenURL(ep, ln))
+	return ln, nil
+}
+
+func (serve *EdgeServer) listenURL(ep *edge.Endpoint, ln net.Listener) string {
+	switch {
+	case ep.GRPC && ep.Network == "unix":
+		return "grpc+unix://" + ep.Address
+	case ep.GRPC:
+		return "grpc://" + ln.Addr().String()
+	case ep.Network == "unix":
+		return "unix://" + ep.Address
+	case ep.TLS:
+		return "https://" + ln.Addr().String()
+	default:
+		return "tcp://" + ln.Addr().String()
 	}
-	log.Infof("Edgekv EdgeServer listen on %s", edge.UnixSock)
-	return serve.Serve(unixListener)
 }
 
 func (serve *EdgeServer) lastChange(changes diff.Changelog) diff.Change {
@@ -449,9 +625,17 @@ func (serve *EdgeServer) watch(prefix string, fn edgekv.ChangeFunc) {
 
 func (serve *EdgeServer) dispatch(key string, event edgekv.WatchEvent) {
 	log.Infof("dispatch to '%s'", key)
+	serve.hub.publish(edge.EdgeEvent{Key: event.Key, Change: event.Val})
 	serve.listener.Dispatch(key, event)
 }
 
+// notify 把本地的修改推送给 Watch 连接，Edge 的 listener 只处理来自 Center 的变更
+func (serve *EdgeServer) notify(key string, val interface{}) {
+	if serve.hub != nil {
+		serve.hub.publish(edge.EdgeEvent{Key: key, Change: val})
+	}
+}
+
 // func (serve *EdgeServer) pushBind(sessID string, key string, timeout time.Duration) {
 // 	serve.bindSessions.Store(sessID, msg)
 // }
@@ -478,10 +662,30 @@ func StartUnix(filename string) error {
 	return Start()
 }
 
+func Listen(addr string) error {
+	return serve.Listen(addr)
+}
+
+func EnableTLS(certFile, keyFile string) error {
+	return serve.EnableTLS(certFile, keyFile)
+}
+
+func EnableClientAuth(caFile string) error {
+	return serve.EnableClientAuth(caFile)
+}
+
+func SetModels(reg *openapi.Registry) {
+	serve.SetModels(reg)
+}
+
 func SetEdgeID(id edgekv.EdgeID) {
 	serve.SetEdgeID(id)
 }
 
+func EnableDedup(filename string, size int) error {
+	return serve.EnableDedup(filename, size)
+}
+
 func SetStore(store edgekv.Store) {
 	serve.SetStore(store)
 }
@@ -0,0 +1,223 @@
+package edgeserve
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/hysios/edgekv/stream"
+	"github.com/hysios/log"
+)
+
+// websocket Watch 连接上客户端发送的操作
+const (
+	OpSubscribe   = "subscribe"
+	OpUnsubscribe = "unsubscribe"
+)
+
+// websocket Watch 连接上服务端发送的消息类型
+const (
+	SocketChange       = EventChange
+	SocketSubscribed   = "subscribed"
+	SocketUnsubscribed = "unsubscribed"
+	SocketError        = "error"
+)
+
+// SocketRequest 客户端发送的订阅请求，LastEventID 为上次收到的事件 ID 时补发之后的变更
+type SocketRequest struct {
+	Op          string `json:"op"`
+	Pattern     string `json:"pattern"`
+	LastEventID string `json:"lastEventId,omitempty"`
+}
+
+// SocketMessage 服务端发送的消息，变更事件的 Pattern 为匹配到的订阅
+type SocketMessage struct {
+	Type    string      `json:"type"`
+	ID      string      `json:"id,omitempty"`
+	Pattern string      `json:"pattern,omitempty"`
+	Key     string      `json:"key,omitempty"`
+	Change  interface{} `json:"change,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// socketWatch 一个 websocket 连接上的所有订阅
+type socketWatch struct {
+	hub  *watchHub
+	conn *stream.Server
+
+	mu     sync.Mutex
+	subs   map[string]*watcher
+	closed bool
+}
+
+// WatchSocket 以 websocket 推送变更，一个连接上可以订阅多个 pattern, 消息为 JSON 文本帧
+func (serve *EdgeServer) WatchSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := stream.Upgrade(w, r, stream.WithTextMessages())
+	if err != nil {
+		log.Errorf("edge_server: upgrade watch socket error %s", err)
+		return
+	}
+
+	var sw = &socketWatch{hub: serve.hub, conn: conn, subs: make(map[string]*watcher)}
+
+	conn.OnState(func(st stream.State) {
+		if st == stream.StateClosed {
+			sw.close()
+		}
+	})
+	if conn.State() == stream.StateClosed {
+		sw.close()
+		return
+	}
+
+	conn.Message(func(_ stream.MessageType, b []byte) {
+		var req SocketRequest
+		if err := json.Unmarshal(b, &req); err != nil {
+			sw.send(SocketMessage{Type: SocketError, Error: fmt.Sprintf("invalid request %s", err)})
+			return
+		}
+
+		if err := sw.handle(req); err != nil {
+			sw.send(SocketMessage{Type: SocketError, Pattern: req.Pattern, Error: err.Error()})
+		}
+	})
+}
+
+func (sw *socketWatch) handle(req SocketRequest) error {
+	if req.Pattern == "" {
+		return errors.New("empty pattern")
+	}
+
+	switch req.Op {
+	case OpSubscribe:
+		return sw.subscribe(req.Pattern, req.LastEventID)
+	case OpUnsubscribe:
+		return sw.unsubscribe(req.Pattern)
+	default:
+		return fmt.Errorf("unknown op '%s'", req.Op)
+	}
+}
+
+func (sw *socketWatch) subscribe(pattern, lastID string) error {
+	sw.mu.Lock()
+	if sw.closed {
+		sw.mu.Unlock()
+		return stream.ErrClosed
+	}
+	if _, ok := sw.subs[pattern]; ok {
+		sw.mu.Unlock()
+		return fmt.Errorf("pattern '%s' already subscribed", pattern)
+	}
+
+	w, replay := sw.hub.subscribe(pattern, lastID)
+	sw.subs[pattern] = w
+	sw.mu.Unlock()
+
+	sw.send(SocketMessage{Type: SocketSubscribed, Pattern: pattern})
+	go sw.forward(pattern, w, replay)
+	return nil
+}
+
+func (sw *socketWatch) unsubscribe(pattern string) error {
+	sw.mu.Lock()
+	w, ok := sw.subs[pattern]
+	delete(sw.subs, pattern)
+	sw.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("pattern '%s' not subscribed", pattern)
+	}
+
+	sw.hub.unsubscribe(w)
+	sw.send(SocketMessage{Type: SocketUnsubscribed, Pattern: pattern})
+	return nil
+}
+
+// forward 把订阅的事件发送到连接，订阅因为跟不上被断开或者发送队列已满时通知客户端，
+// 客户端可以带着最后的事件 ID 重新订阅
+func (sw *socketWatch) forward(pattern string, w *watcher, replay []watchEvent) {
+	var err error
+	for _, ev := range replay {
+		if err = sw.sendEvent(pattern, ev); err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		for ev := range w.ch {
+			if err = sw.sendEvent(pattern, ev); err != nil {
+				break
+			}
+		}
+	}
+
+	var reason = "watch closed"
+	switch {
+	case err == stream.ErrClosed:
+		// 连接断开，close 取消所有订阅
+		return
+	case err != nil:
+		// 丢失的变更无法补发，与 SSE 一样断开跟不上的订阅
+		sw.hub.unsubscribe(w)
+		reason = err.Error()
+	case sw.hub.isClosed():
+		// 服务关闭时断开连接
+		sw.conn.Close()
+		return
+	}
+
+	sw.mu.Lock()
+	dropped := !sw.closed && sw.subs[pattern] == w
+	if dropped {
+		delete(sw.subs, pattern)
+	}
+	sw.mu.Unlock()
+
+	if !dropped {
+		return
+	}
+
+	// 通知也无法发送时断开连接，客户端重连后重新订阅
+	if err = sw.send(SocketMessage{Type: SocketUnsubscribed, Pattern: pattern, Error: reason}); err != nil && err != stream.ErrClosed {
+		sw.conn.Close()
+	}
+}
+
+func (sw *socketWatch) sendEvent(pattern string, ev watchEvent) error {
+	return sw.send(SocketMessage{
+		Type:    SocketChange,
+		ID:      sw.hub.eventID(ev.seq),
+		Pattern: pattern,
+		Key:     ev.event.Key,
+		Change:  ev.event.Change,
+	})
+}
+
+// send 编码失败的消息记录后跳过，返回发送队列的错误
+func (sw *socketWatch) send(msg SocketMessage) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		log.Errorf("edge_server: marshal watch message error %s", err)
+		return nil
+	}
+
+	if _, err = sw.conn.Send(b); err != nil && err != stream.ErrClosed {
+		log.Errorf("edge_server: send watch message error %s", err)
+	}
+	return err
+}
+
+// close 连接断开后取消所有订阅
+func (sw *socketWatch) close() {
+	sw.mu.Lock()
+	subs := sw.subs
+	sw.subs = make(map[string]*watcher)
+	sw.closed = true
+	sw.mu.Unlock()
+
+	for _, w := range subs {
+		sw.hub.unsubscribe(w)
+	}
+}
@@ -0,0 +1,197 @@
+package edgeserve
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hysios/edgekv/edge"
+	"github.com/hysios/edgekv/stream"
+	"github.com/stretchr/testify/assert"
+)
+
+func openSocket(t *testing.T, serve *EdgeServer) (*stream.Client, chan SocketMessage, func()) {
+	ts := httptest.NewServer(http.HandlerFunc(serve.WatchSocket))
+
+	client, err := stream.NewClient("ws" + strings.TrimPrefix(ts.URL, "http"))
+	if err != nil {
+		ts.Close()
+		t.Fatalf("connect error %s", err)
+	}
+
+	var msgs = make(chan SocketMessage, 16)
+	client.Message(func(mt stream.MessageType, b []byte) {
+		assert.Equal(t, mt, stream.StText)
+
+		var msg SocketMessage
+		assert.NoError(t, json.Unmarshal(b, &msg))
+		msgs <- msg
+	})
+
+	return client, msgs, func() {
+		client.Close()
+		ts.Close()
+	}
+}
+
+func sendRequest(t *testing.T, client *stream.Client, req SocketRequest) {
+	b, _ := json.Marshal(req)
+	_, err := client.Send(b)
+	assert.NoError(t, err)
+}
+
+func recvMessage(t *testing.T, msgs chan SocketMessage) SocketMessage {
+	select {
+	case msg := <-msgs:
+		return msg
+	case <-time.After(3 * time.Second):
+		t.Fatalf("wait socket message timeout")
+		return SocketMessage{}
+	}
+}
+
+func TestWatchSocket(t *testing.T) {
+	var serve = &EdgeServer{hub: newWatchHub()}
+	client, msgs, done := openSocket(t, serve)
+	defer done()
+
+	sendRequest(t, client, SocketRequest{Op: OpSubscribe, Pattern: "test.*"})
+	assert.Equal(t, recvMessage(t, msgs), SocketMessage{Type: SocketSubscribed, Pattern: "test.*"})
+	sendRequest(t, client, SocketRequest{Op: OpSubscribe, Pattern: "other"})
+	assert.Equal(t, recvMessage(t, msgs), SocketMessage{Type: SocketSubscribed, Pattern: "other"})
+
+	// 一个连接上的多个订阅各自收到匹配的变更
+	serve.hub.publish(edge.EdgeEvent{Key: "test.on", Change: true})
+	msg := recvMessage(t, msgs)
+	assert.Equal(t, msg.Type, SocketChange)
+	assert.Equal(t, msg.Pattern, "test.*")
+	assert.Equal(t, msg.Key, "test.on")
+	assert.Equal(t, msg.Change, true)
+	assert.Equal(t, msg.ID, serve.hub.eventID(1))
+
+	serve.hub.publish(edge.EdgeEvent{Key: "other", Change: "val"})
+	msg = recvMessage(t, msgs)
+	assert.Equal(t, msg.Pattern, "other")
+	assert.Equal(t, msg.Change, "val")
+
+	sendRequest(t, client, SocketRequest{Op: OpUnsubscribe, Pattern: "test.*"})
+	assert.Equal(t, recvMessage(t, msgs), SocketMessage{Type: SocketUnsubscribed, Pattern: "test.*"})
+
+	// 取消的订阅不再收到变更
+	serve.hub.publish(edge.EdgeEvent{Key: "test.on", Change: false})
+	serve.hub.publish(edge.EdgeEvent{Key: "other", Change: "next"})
+	msg = recvMessage(t, msgs)
+	assert.Equal(t, msg.Key, "other")
+	assert.Equal(t, msg.Change, "next")
+
+	// 带着事件 ID 重新订阅时补发之后的变更
+	sendRequest(t, client, SocketRequest{Op: OpSubscribe, Pattern: "test.*", LastEventID: serve.hub.eventID(1)})
+	assert.Equal(t, recvMessage(t, msgs).Type, SocketSubscribed)
+	msg = recvMessage(t, msgs)
+	assert.Equal(t, msg.Key, "test.on")
+	assert.Equal(t, msg.Change, false)
+}
+
+func TestWatchSocket_InvalidRequest(t *testing.T) {
+	var serve = &EdgeServer{hub: newWatchHub()}
+	client, msgs, done := openSocket(t, serve)
+	defer done()
+
+	client.Send([]byte("not json"))
+	assert.Equal(t, recvMessage(t, msgs).Type, SocketError)
+
+	sendRequest(t, client, SocketRequest{Op: OpUnsubscribe, Pattern: "test"})
+	msg := recvMessage(t, msgs)
+	assert.Equal(t, msg.Type, SocketError)
+	assert.Equal(t, msg.Pattern, "test")
+
+	sendRequest(t, client, SocketRequest{Op: "watch", Pattern: "test"})
+	assert.Equal(t, recvMessage(t, msgs).Type, SocketError)
+}
+
+func TestWatchSocket_Close(t *testing.T) {
+	var serve = &EdgeServer{hub: newWatchHub()}
+	client, msgs, done := openSocket(t, serve)
+	defer done()
+
+	var states = make(chan stream.State, 16)
+	client.OnState(func(st stream.State) { states <- st })
+
+	sendRequest(t, client, SocketRequest{Op: OpSubscribe, Pattern: "test"})
+	assert.Equal(t, recvMessage(t, msgs).Type, SocketSubscribed)
+
+	// 服务关闭时断开 websocket 连接
+	serve.hub.close()
+	for {
+		select {
+		case st := <-states:
+			if st == stream.StateDisconnected {
+				return
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("wait disconnect timeout")
+		}
+	}
+}
+
+func TestWatchSocket_SendQueueFull(t *testing.T) {
+	var (
+		hub   = newWatchHub()
+		watch = make(chan *socketWatch, 1)
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := stream.Upgrade(w, r, stream.WithTextMessages(), stream.WithSendQueue(1))
+		if err != nil {
+			t.Errorf("upgrade error %s", err)
+			return
+		}
+		watch <- &socketWatch{hub: hub, conn: conn, subs: make(map[string]*watcher)}
+	}))
+	defer ts.Close()
+
+	client, err := stream.NewClient("ws"+strings.TrimPrefix(ts.URL, "http"), stream.WithBackoff(time.Hour, time.Hour))
+	assert.NoError(t, err)
+	defer client.Close()
+
+	var (
+		states  = make(chan stream.State, 16)
+		msgs    = make(chan SocketMessage, 1024)
+		release = make(chan struct{})
+	)
+	client.OnState(func(st stream.State) { states <- st })
+	// 客户端不读取，服务端的发送队列很快就会满
+	client.Message(func(_ stream.MessageType, b []byte) {
+		<-release
+		var msg SocketMessage
+		json.Unmarshal(b, &msg)
+		msgs <- msg
+	})
+
+	sw := <-watch
+	assert.NoError(t, sw.subscribe("test", ""))
+	for i := 0; i < 200; i++ {
+		hub.publish(edge.EdgeEvent{Key: "test", Change: strings.Repeat("x", 16<<10)})
+	}
+	close(release)
+
+	// 丢失变更的订阅被取消，通知客户端或者断开连接
+	for {
+		select {
+		case msg := <-msgs:
+			if msg.Type == SocketUnsubscribed {
+				assert.NotEmpty(t, msg.Error)
+				return
+			}
+		case st := <-states:
+			if st == stream.StateDisconnected {
+				return
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("wait dropped subscription timeout")
+		}
+	}
+}
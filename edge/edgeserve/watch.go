@@ -0,0 +1,263 @@
+package edgeserve
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/edge"
+	"github.com/hysios/edgekv/sse"
+	"github.com/hysios/edgekv/utils"
+	"github.com/hysios/log"
+	. "github.com/hysios/utils/response"
+)
+
+var (
+	// WatchHistory 保留最近的变更事件数量，Watch 重连时据此补发
+	WatchHistory = 1024
+	// WatchBuffer 每个 Watch 连接的事件缓冲，缓冲满时断开连接，客户端重连后补发
+	WatchBuffer = 64
+	// HeartbeatInterval Watch 连接发送心跳的间隔
+	HeartbeatInterval = 15 * time.Second
+	// WatchRetry 客户端断线后重连的间隔
+	WatchRetry = 3 * time.Second
+)
+
+// Watch 事件的名称与 ready 事件的数据，见 edge.EventReady
+const (
+	EventChange  = edge.EventChange
+	EventReady   = edge.EventReady
+	ReadyResumed = edge.ReadyResumed
+	ReadyReset   = edge.ReadyReset
+)
+
+type watchEvent struct {
+	seq   uint64
+	event edge.EdgeEvent
+}
+
+type watcher struct {
+	matcher edgekv.KeyMatch
+	ch      chan watchEvent
+	// resumed 订阅时 lastID 之后的事件全部补发
+	resumed bool
+}
+
+// watchHub 广播变更事件给 Watch 连接，事件 ID 为 {epoch}-{seq},
+// 服务重启后 epoch 改变，旧的 Last-Event-ID 不再补发
+type watchHub struct {
+	mu       sync.Mutex
+	epoch    string
+	seq      uint64
+	history  []watchEvent
+	watchers map[*watcher]struct{}
+	closed   bool
+}
+
+func newWatchHub() *watchHub {
+	return &watchHub{
+		epoch:    strconv.FormatInt(time.Now().UnixNano(), 36),
+		watchers: make(map[*watcher]struct{}),
+	}
+}
+
+func (hub *watchHub) eventID(seq uint64) string {
+	return fmt.Sprintf("%s-%d", hub.epoch, seq)
+}
+
+// parseID 返回 Last-Event-ID 的序号，不是本次运行产生的 ID 时返回 false
+func (hub *watchHub) parseID(id string) (uint64, bool) {
+	i := strings.LastIndexByte(id, '-')
+	if i < 0 || id[:i] != hub.epoch {
+		return 0, false
+	}
+
+	seq, err := strconv.ParseUint(id[i+1:], 10, 64)
+	return seq, err == nil
+}
+
+func (hub *watchHub) publish(event edge.EdgeEvent) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	hub.seq++
+	ev := watchEvent{seq: hub.seq, event: event}
+
+	hub.history = append(hub.history, ev)
+	if len(hub.history) > WatchHistory {
+		hub.history = hub.history[len(hub.history)-WatchHistory:]
+	}
+
+	for w := range hub.watchers {
+		if !w.matcher.Match(context.Background(), event.Key) {
+			continue
+		}
+
+		select {
+		case w.ch <- ev:
+		default:
+			// 跟不上的连接断开，由客户端带着 Last-Event-ID 重连
+			log.Errorf("edge_server: watch '%s' too slow, disconnect", w.matcher.Pattern)
+			delete(hub.watchers, w)
+			close(w.ch)
+		}
+	}
+}
+
+// subscribe 订阅匹配 pattern 的事件，返回 lastID 之后需要补发的历史事件
+func (hub *watchHub) subscribe(pattern, lastID string) (*watcher, []watchEvent) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	var (
+		w      = &watcher{matcher: edgekv.KeyMatch{Pattern: pattern}, ch: make(chan watchEvent, WatchBuffer)}
+		replay []watchEvent
+	)
+
+	if seq, ok := hub.parseID(lastID); ok {
+		var oldest = hub.seq + 1
+		if len(hub.history) > 0 {
+			oldest = hub.history[0].seq
+		}
+		w.resumed = seq <= hub.seq && seq+1 >= oldest
+
+		for _, ev := range hub.history {
+			if ev.seq > seq && w.matcher.Match(context.Background(), ev.event.Key) {
+				replay = append(replay, ev)
+			}
+		}
+	}
+
+	if hub.closed {
+		close(w.ch)
+		return w, nil
+	}
+
+	hub.watchers[w] = struct{}{}
+	return w, replay
+}
+
+func (hub *watchHub) unsubscribe(w *watcher) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	if _, ok := hub.watchers[w]; ok {
+		delete(hub.watchers, w)
+		close(w.ch)
+	}
+}
+
+// close 断开所有 Watch 连接，服务关闭时调用，否则 Shutdown 会一直等待长连接结束
+func (hub *watchHub) close() {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	hub.closed = true
+	for w := range hub.watchers {
+		delete(hub.watchers, w)
+		close(w.ch)
+	}
+}
+
+func (hub *watchHub) isClosed() bool {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	return hub.closed
+}
+
+// Watch 以 Server-Sent Events 推送匹配的变更，format=gob 时数据为 base64 编码的 gob, 默认为 JSON
+func (serve *EdgeServer) Watch(w http.ResponseWriter, r *http.Request) {
+	var (
+		pattern = mux.Vars(r)["pattern"]
+		format  = r.URL.Query().Get("format")
+		encode  func(edge.EdgeEvent) ([]byte, error)
+	)
+
+	switch format {
+	case "", "json":
+		encode = encodeEventJSON
+	case "gob":
+		encode = encodeEventGob
+	default:
+		AbortErr(w, http.StatusBadRequest, fmt.Errorf("unsupported format '%s'", format))
+		return
+	}
+
+	sw, err := sse.NewWriter(w)
+	if err != nil {
+		AbortErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	watcher, replay := serve.hub.subscribe(pattern, r.Header.Get("Last-Event-ID"))
+	defer serve.hub.unsubscribe(watcher)
+
+	send := func(ev watchEvent) error {
+		b, err := encode(ev.event)
+		if err != nil {
+			return err
+		}
+		return sw.Send(sse.Event{ID: serve.hub.eventID(ev.seq), Event: EventChange, Data: b})
+	}
+
+	if err = sw.Retry(WatchRetry); err != nil {
+		return
+	}
+
+	for _, ev := range replay {
+		if err = send(ev); err != nil {
+			return
+		}
+	}
+
+	var ready = ReadyReset
+	if watcher.resumed {
+		ready = ReadyResumed
+	}
+	if err = sw.Send(sse.Event{Event: EventReady, Data: []byte(ready)}); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(HeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case ev, ok := <-watcher.ch:
+			if !ok {
+				return
+			}
+
+			if err = send(ev); err != nil {
+				log.Errorf("edge_server: watch '%s' send error %s", pattern, err)
+				return
+			}
+		case <-heartbeat.C:
+			if err = sw.Comment("ping"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func encodeEventJSON(event edge.EdgeEvent) ([]byte, error) {
+	return json.Marshal(event)
+}
+
+func encodeEventGob(event edge.EdgeEvent) ([]byte, error) {
+	b, err := utils.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(base64.StdEncoding.EncodeToString(b)), nil
+}
@@ -0,0 +1,69 @@
+package edgeserve
+
+import (
+	"testing"
+
+	"github.com/hysios/edgekv/edge"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchHub_Replay(t *testing.T) {
+	hub := newWatchHub()
+	first, _ := hub.subscribe("test.*", "")
+
+	hub.publish(edge.EdgeEvent{Key: "test.a", Change: 1})
+	hub.publish(edge.EdgeEvent{Key: "other.b", Change: 2})
+	hub.publish(edge.EdgeEvent{Key: "test.c", Change: 3})
+
+	ev := <-first.ch
+	assert.Equal(t, ev.event.Key, "test.a")
+	lastID := hub.eventID(ev.seq)
+	hub.unsubscribe(first)
+
+	// 用最后收到的 ID 重新订阅，补发之后匹配的事件
+	w, replay := hub.subscribe("test.*", lastID)
+	defer hub.unsubscribe(w)
+	if assert.Len(t, replay, 1) {
+		assert.Equal(t, replay[0].event.Key, "test.c")
+	}
+
+	assert.True(t, w.resumed)
+
+	// 其他运行产生的 ID 不补发
+	other, replay := hub.subscribe("test.*", "other-1")
+	assert.Empty(t, replay)
+	assert.False(t, other.resumed)
+}
+
+func TestWatchHub_HistoryOverflow(t *testing.T) {
+	hub := newWatchHub()
+	hub.publish(edge.EdgeEvent{Key: "test", Change: 0})
+	lastID := hub.eventID(1)
+
+	w, _ := hub.subscribe("*", lastID)
+	assert.True(t, w.resumed)
+
+	// lastID 之后的事件超出保留的数量，无法全部补发
+	for i := 0; i <= WatchHistory; i++ {
+		hub.publish(edge.EdgeEvent{Key: "test", Change: i})
+	}
+	w, replay := hub.subscribe("*", lastID)
+	assert.False(t, w.resumed)
+	assert.Len(t, replay, WatchHistory)
+}
+
+func TestWatchHub_SlowWatcher(t *testing.T) {
+	hub := newWatchHub()
+	w, _ := hub.subscribe("*", "")
+
+	for i := 0; i <= WatchBuffer; i++ {
+		hub.publish(edge.EdgeEvent{Key: "test", Change: i})
+	}
+
+	// 缓冲满之后连接被关闭
+	var n int
+	for range w.ch {
+		n++
+	}
+	assert.Equal(t, n, WatchBuffer)
+}
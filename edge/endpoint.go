@@ -0,0 +1,172 @@
+package edge
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// Endpoint Edge 服务的地址，由 DSN 解析得到
+//
+//	unix:///run/edgekv.sock
+//	tcp://gw:7070 或 http://gw:7070
+//	https://gw:7070?ca=/etc/edgekv/ca.pem&insecure=false
+//	https://gw:7070?ca=/etc/edgekv/ca.pem&cert=/etc/edgekv/client.pem&key=/etc/edgekv/client-key.pem
+//	grpc://gw:7071 或 grpc+unix:///run/edgekv-grpc.sock
+type Endpoint struct {
+	// Network 为 unix 或 tcp
+	Network string
+	// Address socket 文件路径或 host:port
+	Address string
+	TLS     bool
+	// GRPC 为 true 时使用 gRPC 接口，见 edgepb
+	GRPC bool
+	// Path 请求路径的前缀，例如通过反向代理访问时的 /edgekv
+	Path  string
+	Query url.Values
+}
+
+// DefaultDSN 没有指定地址时使用的 DSN, 连接本机的 UnixSock
+func DefaultDSN() string {
+	return "unix://" + UnixSock
+}
+
+// ParseEndpoint 解析 Edge 服务的 DSN
+func ParseEndpoint(dsn string) (*Endpoint, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("edge: invalid dsn '%s' %w", dsn, err)
+	}
+
+	var ep = &Endpoint{Query: u.Query()}
+	switch u.Scheme {
+	case "unix":
+		ep.Network = "unix"
+		ep.Address = u.Host + u.Path
+	case "tcp", "http":
+		ep.Network = "tcp"
+		ep.Address = u.Host
+		ep.Path = u.Path
+	case "https":
+		ep.Network = "tcp"
+		ep.Address = u.Host
+		ep.Path = u.Path
+		ep.TLS = true
+	case "grpc":
+		ep.Network = "tcp"
+		ep.Address = u.Host
+		ep.GRPC = true
+	case "grpc+unix":
+		ep.Network = "unix"
+		ep.Address = u.Host + u.Path
+		ep.GRPC = true
+	default:
+		return nil, fmt.Errorf("edge: unsupported dsn scheme '%s'", u.Scheme)
+	}
+
+	if len(ep.Address) == 0 {
+		return nil, fmt.Errorf("edge: missing address in dsn '%s'", dsn)
+	}
+	ep.Path = strings.TrimSuffix(ep.Path, "/")
+	return ep, nil
+}
+
+// URL 返回请求的 URL 前缀，unix socket 使用文件名作为主机名
+func (ep *Endpoint) URL() url.URL {
+	var u = url.URL{Scheme: "http", Host: ep.Address, Path: ep.Path}
+	if ep.Network == "unix" {
+		u.Host = filepath.Base(ep.Address)
+	}
+	if ep.TLS {
+		u.Scheme = "https"
+	}
+	return u
+}
+
+// TLSConfig 返回客户端的 TLS 设置，ca 为信任的根证书文件，insecure 为 true 时不验证证书，
+// cert 与 key 为服务端要求验证客户端时使用的证书
+func (ep *Endpoint) TLSConfig() (*tls.Config, error) {
+	if !ep.TLS {
+		return nil, nil
+	}
+
+	var cfg = &tls.Config{}
+	if s := ep.Query.Get("insecure"); len(s) > 0 {
+		insecure, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("edge: invalid insecure '%s'", s)
+		}
+		cfg.InsecureSkipVerify = insecure
+	}
+
+	if ca := ep.Query.Get("ca"); len(ca) > 0 {
+		b, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, fmt.Errorf("edge: read ca %w", err)
+		}
+
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(b) {
+			return nil, errors.New("edge: no certificate found in ca")
+		}
+	}
+
+	if certFile, keyFile := ep.Query.Get("cert"), ep.Query.Get("key"); len(certFile) > 0 || len(keyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("edge: load client certificate %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// dialContext 连接 unix socket, TCP 时返回 nil, 按请求的主机名连接
+func (ep *Endpoint) dialContext() func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if ep.Network != "unix" {
+		return nil
+	}
+
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", ep.Address)
+	}
+}
+
+// Transport 返回连接到 Edge 服务的 http.Transport
+func (ep *Endpoint) Transport() (*http.Transport, error) {
+	cfg, err := ep.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Transport{
+		DialContext:     ep.dialContext(),
+		TLSClientConfig: cfg,
+	}, nil
+}
+
+// Dialer 返回连接到 Edge 服务消息流的 websocket.Dialer
+func (ep *Endpoint) Dialer() (*websocket.Dialer, error) {
+	cfg, err := ep.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &websocket.Dialer{
+		NetDialContext:   ep.dialContext(),
+		TLSClientConfig:  cfg,
+		HandshakeTimeout: websocket.DefaultDialer.HandshakeTimeout,
+	}, nil
+}
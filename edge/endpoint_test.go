@@ -0,0 +1,60 @@
+package edge
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	var tests = []struct {
+		dsn     string
+		network string
+		address string
+		url     string
+		tls     bool
+		grpc    bool
+	}{
+		{"unix:///run/edgekv.sock", "unix", "/run/edgekv.sock", "http://edgekv.sock", false, false},
+		{"tcp://gw:7070", "tcp", "gw:7070", "http://gw:7070", false, false},
+		{"http://gw:7070/edgekv/", "tcp", "gw:7070", "http://gw:7070/edgekv", false, false},
+		{"https://gw:7070?insecure=true", "tcp", "gw:7070", "https://gw:7070", true, false},
+		{"grpc://gw:7071", "tcp", "gw:7071", "http://gw:7071", false, true},
+		{"grpc+unix:///run/edgekv-grpc.sock", "unix", "/run/edgekv-grpc.sock", "http://edgekv-grpc.sock", false, true},
+	}
+
+	for _, tt := range tests {
+		ep, err := ParseEndpoint(tt.dsn)
+		if !assert.NoError(t, err, tt.dsn) {
+			continue
+		}
+
+		u := ep.URL()
+		assert.Equal(t, ep.Network, tt.network, tt.dsn)
+		assert.Equal(t, ep.Address, tt.address, tt.dsn)
+		assert.Equal(t, u.String(), tt.url, tt.dsn)
+		assert.Equal(t, ep.TLS, tt.tls, tt.dsn)
+		assert.Equal(t, ep.GRPC, tt.grpc, tt.dsn)
+	}
+
+	for _, dsn := range []string{"ftp://gw:21", "tcp://", "unix://", "grpc://"} {
+		_, err := ParseEndpoint(dsn)
+		assert.Error(t, err, dsn)
+	}
+}
+
+func TestEndpoint_TLSConfig(t *testing.T) {
+	ep, _ := ParseEndpoint("https://gw:7070?insecure=true")
+	cfg, err := ep.TLSConfig()
+	assert.NoError(t, err)
+	assert.True(t, cfg.InsecureSkipVerify)
+
+	ep, _ = ParseEndpoint("https://gw:7070?ca=/not/exists.pem")
+	_, err = ep.TLSConfig()
+	assert.Error(t, err)
+
+	ep, _ = ParseEndpoint("tcp://gw:7070")
+	cfg, err = ep.TLSConfig()
+	assert.NoError(t, err)
+	assert.Nil(t, cfg)
+}
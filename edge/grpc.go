@@ -0,0 +1,234 @@
+package edge
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/edgepb"
+	"github.com/hysios/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCRetry gRPC 的 Watch 与 Bind 流断开后重连的间隔
+var GRPCRetry = 3 * time.Second
+
+// GRPCStore 通过 gRPC 接口访问 Edge 服务，由 Open 打开 grpc:// 或 grpc+unix:// 时返回。
+// 值以 google.protobuf.Value 传输，读取的数字为 float64
+type GRPCStore struct {
+	edgekv.Accessor
+
+	conn   *grpc.ClientConn
+	client edgepb.EdgeClient
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+type grpcWrap struct {
+	*GRPCStore
+}
+
+func (wrap *grpcWrap) Get(key string) (interface{}, bool) {
+	return wrap.GRPCStore.Get(key)
+}
+
+func (wrap *grpcWrap) Keys() []string {
+	return wrap.GRPCStore.Keys()
+}
+
+// openGRPC 创建到 ep 的连接，连接在第一次调用时建立。
+// gRPC 接口不支持 TLS 与本地缓存，DSN 带有任何参数时返回错误，避免 ca 或 cache 等参数被静默忽略
+func openGRPC(ep *Endpoint) (*GRPCStore, error) {
+	if len(ep.Query) > 0 {
+		var keys []string
+		for key := range ep.Query {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return nil, fmt.Errorf("edge: unsupported grpc option '%s'", keys[0])
+	}
+
+	var (
+		target = ep.Address
+		opts   = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	)
+
+	if ep.Network == "unix" {
+		target = "passthrough:///" + ep.Address
+		opts = append(opts, grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", ep.Address)
+		}))
+	}
+
+	conn, err := grpc.Dial(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	var store = &GRPCStore{conn: conn, client: edgepb.NewEdgeClient(conn)}
+	store.ctx, store.cancel = context.WithCancel(context.Background())
+	store.Accessor = edgekv.MakeAccessor(&grpcWrap{store})
+	return store, nil
+}
+
+func (edge *GRPCStore) Get(key string, opts ...edgekv.GetOpt) (interface{}, bool) {
+	resp, err := edge.client.Get(edge.ctx, &edgepb.GetRequest{Key: key})
+	if err != nil {
+		if status.Code(err) != codes.NotFound {
+			log.Infof("edge: grpc get '%s' error %s", key, err)
+		}
+		return nil, false
+	}
+	return resp.Value.AsInterface(), true
+}
+
+func (edge *GRPCStore) Keys(opts ...edgekv.GetOpt) []string {
+	resp, err := edge.client.List(edge.ctx, &edgepb.ListRequest{})
+	if err != nil {
+		log.Infof("edge: grpc list error %s", err)
+		return nil
+	}
+	return resp.Keys
+}
+
+func (edge *GRPCStore) Set(key string, val interface{}, opts ...edgekv.SetOpt) {
+	v, err := edgepb.NewValue(val)
+	if err != nil {
+		log.Errorf("edge: grpc set '%s' %s", key, err)
+		return
+	}
+
+	if _, err = edge.client.Set(edge.ctx, &edgepb.SetRequest{Key: key, Value: v}); err != nil {
+		log.Errorf("edge: grpc set '%s' error %s", key, err)
+	}
+}
+
+// Delete 删除键值，Edge 服务的存储不支持删除时返回 codes.Unimplemented 的错误
+func (edge *GRPCStore) Delete(key string) error {
+	_, err := edge.client.Delete(edge.ctx, &edgepb.DeleteRequest{Key: key})
+	return err
+}
+
+// Watch 在后台订阅匹配 pattern 的变更，断开后自动重连并补发断线期间的变更
+func (edge *GRPCStore) Watch(pattern string, fn edgekv.ChangeFunc) {
+	go func() {
+		var lastID string
+		for {
+			lastID = edge.watch(pattern, lastID, fn)
+			if !edge.wait() {
+				return
+			}
+		}
+	}()
+}
+
+// watch 接收变更直到流断开，返回最后收到的事件 ID
+func (edge *GRPCStore) watch(pattern, lastID string, fn edgekv.ChangeFunc) string {
+	stream, err := edge.client.Watch(edge.ctx, &edgepb.WatchRequest{Pattern: pattern, LastEventId: lastID})
+	if err != nil {
+		log.Infof("edge: grpc watch '%s' error %s", pattern, err)
+		return lastID
+	}
+
+	for {
+		ev, err := stream.Recv()
+		if err != nil {
+			log.Infof("edge: grpc watch '%s' disconnected %s", pattern, err)
+			return lastID
+		}
+
+		lastID = ev.Id
+		fn(ev.Key, nil, ev.Change.AsInterface())
+	}
+}
+
+// Bind 注册 pattern 的观察者，第一次连接失败时返回错误，之后断开时自动重连
+func (edge *GRPCStore) Bind(pattern string, fn edgekv.BindHandler) error {
+	stream, err := edge.bind(pattern)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			edge.serveBind(stream, fn)
+			for {
+				if !edge.wait() {
+					return
+				}
+				if stream, err = edge.bind(pattern); err == nil {
+					break
+				}
+				log.Infof("edge: grpc bind '%s' error %s", pattern, err)
+			}
+		}
+	}()
+	return nil
+}
+
+func (edge *GRPCStore) bind(pattern string) (edgepb.Edge_BindClient, error) {
+	stream, err := edge.client.Bind(edge.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = stream.Send(&edgepb.BindRequest{Pattern: pattern}); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// serveBind 处理 Edge 服务发来的调用直到流断开
+func (edge *GRPCStore) serveBind(stream edgepb.Edge_BindClient, fn edgekv.BindHandler) {
+	for {
+		call, err := stream.Recv()
+		if err != nil {
+			log.Infof("edge: grpc bind disconnected %s", err)
+			return
+		}
+
+		switch call.Method {
+		case edgepb.BindMethod_BIND_GET:
+			var (
+				val, found = fn(edgekv.BindGet, call.Key, nil)
+				ret        = &edgepb.BindRequest{SessionId: call.SessionId, Found: found}
+			)
+			if ret.Value, err = edgepb.NewValue(val); err != nil {
+				log.Errorf("edge: grpc bind get '%s' %s", call.Key, err)
+				ret.Found = false
+			}
+
+			if err = stream.Send(ret); err != nil {
+				log.Infof("edge: grpc bind disconnected %s", err)
+				return
+			}
+		case edgepb.BindMethod_BIND_SET:
+			fn(edgekv.BindSet, call.Key, call.Value.AsInterface())
+		case edgepb.BindMethod_BIND_DELETE:
+			fn(edgekv.BindDelete, call.Key, nil)
+		}
+	}
+}
+
+// wait 等待重连的间隔，连接已经关闭时返回 false
+func (edge *GRPCStore) wait() bool {
+	select {
+	case <-edge.ctx.Done():
+		return false
+	case <-time.After(GRPCRetry):
+		return true
+	}
+}
+
+// Close 关闭连接，停止后台的 Watch 与 Bind
+func (edge *GRPCStore) Close() error {
+	edge.cancel()
+	return edge.conn.Close()
+}
@@ -0,0 +1,24 @@
+package edge
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpen_GRPCOptions(t *testing.T) {
+	for _, dsn := range []string{
+		"grpc://gw:7071?cache=true",
+		"grpc://gw:7071?ca=/etc/edgekv/ca.pem",
+		"grpc+unix:///run/edgekv-grpc.sock?insecure=true",
+	} {
+		_, err := Open(dsn)
+		assert.Error(t, err, dsn)
+	}
+
+	// 连接在第一次调用时建立
+	db, err := Open("grpc://gw:7071")
+	if assert.NoError(t, err) {
+		assert.NoError(t, db.(*GRPCStore).Close())
+	}
+}
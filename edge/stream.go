@@ -3,12 +3,20 @@ package edge
 import (
 	"net/http"
 
+	"github.com/gorilla/websocket"
 	"github.com/hysios/edgekv"
 	"github.com/hysios/edgekv/stream"
 	"github.com/hysios/edgekv/utils"
 	"github.com/hysios/log"
 )
 
+// Bind 观察者连接上的 RPC 方法，由 Edge 服务调用客户端的 BindHandler
+const (
+	MethodBindGet    = "bind.get"
+	MethodBindSet    = "bind.set"
+	MethodBindDelete = "bind.delete"
+)
+
 type MsgFunc func(msg edgekv.Message)
 
 type MsgStream struct {
@@ -29,25 +37,76 @@ func Upgrade(w http.ResponseWriter, r *http.Request) (*MsgStream, error) {
 	return &MsgStream{Streamer: stream}, nil
 }
 
+// UpgradeRPC 把请求升级为消息流，并在其上创建 RPC
+func UpgradeRPC(w http.ResponseWriter, r *http.Request) (*stream.RPC, error) {
+	serve, err := stream.Upgrade(w, r)
+	if err != nil {
+		return nil, err
+	}
+	return stream.NewRPC(serve), nil
+}
+
+// ConnectRPC 通过 UnixSock 连接到 Edge 服务的消息流，并在其上创建 RPC
+func ConnectRPC(uri string) (*stream.RPC, error) {
+	client, err := dial(uri, unixDialer())
+	if err != nil {
+		return nil, err
+	}
+	return stream.NewRPC(client), nil
+}
+
+// Connect 通过 UnixSock 连接到 Edge 服务的消息流，断开后自动重连
 func Connect(uri string) (*MsgStream, error) {
-	client, err := stream.NewClient(uri)
+	client, err := dial(uri, unixDialer())
 	if err != nil {
 		return nil, err
 	}
 	return &MsgStream{Streamer: client}, nil
 }
 
+func unixDialer() *websocket.Dialer {
+	dialer, _ := (&Endpoint{Network: "unix", Address: UnixSock}).Dialer()
+	return dialer
+}
+
+func dial(uri string, dialer *websocket.Dialer) (*stream.Client, error) {
+	client, err := stream.NewClient(uri, stream.WithDialer(dialer))
+	if err != nil {
+		return nil, err
+	}
+
+	client.OnState(func(state stream.State) {
+		log.Infof("msgstream: %s %s", uri, state)
+	})
+	return client, nil
+}
+
 func (rece *MsgStream) MessageMsg(fn MsgFunc) {
 	rece.Message(func(mt stream.MessageType, msg []byte) {
 		var data EdgeData
 		if mt == stream.StBinary {
 			if err := utils.Unmarshal(msg, &data); err != nil {
 				log.Errorf("msgstream: unmarshal gob error %s", err)
+				return
+			}
+
+			// gob 注册的是 *edgekv.Message, 解码得到的是指针
+			var m edgekv.Message
+			switch v := data.Data.(type) {
+			case *edgekv.Message:
+				m = *v
+			case edgekv.Message:
+				m = v
+			default:
+				log.Errorf("msgstream: invalid message %T", data.Data)
+				return
 			}
 
-			if msg, ok := data.Data.(edgekv.Message); ok {
-				fn(msg)
+			if err := m.Normalize(); err != nil {
+				log.Errorf("msgstream: %s", err)
+				return
 			}
+			fn(m)
 		}
 	})
 }
@@ -22,31 +22,34 @@
 package edgekv
 
 import (
-	"html/template"
 	"path"
-	"strings"
 )
 
 type EdgeID string
 
 type Map map[string]interface{}
 
-var topicTpl *template.Template
-
+// Topic 边缘节点的主题命名空间，由 TopicPattern 生成，例如 edgekv/EDGE1
 func (id EdgeID) Topic() string {
-	var sb strings.Builder
-	topicTpl.Execute(&sb, Map{"EdgeID": id})
-	return sb.String()
+	topicMu.RLock()
+	defer topicMu.RUnlock()
+	return topicTpl.execute(id)
 }
 
 func (id EdgeID) SubTopic(name string) string {
 	return path.Join(id.Topic(), name)
 }
 
-func (id EdgeID) IsNil() bool {
-	return len(id) == 0
+// UpTopic 边缘节点发往中心的主题，例如 edgekv/EDGE1/up/sync
+func (id EdgeID) UpTopic(name string) string {
+	return path.Join(id.Topic(), DirUp, name)
 }
 
-func init() {
-	topicTpl = template.Must(template.New("edgekv").Parse(TopicPattern))
+// DownTopic 中心发往边缘节点的主题，例如 edgekv/EDGE1/down/sync
+func (id EdgeID) DownTopic(name string) string {
+	return path.Join(id.Topic(), DirDown, name)
+}
+
+func (id EdgeID) IsNil() bool {
+	return len(id) == 0
 }
@@ -0,0 +1,357 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.19.1
+// source: edgekv.proto
+
+package edgepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// EdgeClient is the client API for Edge service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type EdgeClient interface {
+	// Get 读取键值，键不存在时返回 NOT_FOUND
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
+	// Set 写入键值并同步到 Center
+	Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error)
+	// Delete 删除键值，存储不支持删除时返回 UNIMPLEMENTED
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	// List 列出以 prefix 开头的键
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	// Watch 推送匹配 pattern 的变更，重连时带上最后收到的事件 ID 补发断线期间的变更
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Edge_WatchClient, error)
+	// Bind 注册观察者，客户端先发送带 pattern 的消息，之后回复服务端发来的 BIND_GET 调用
+	Bind(ctx context.Context, opts ...grpc.CallOption) (Edge_BindClient, error)
+}
+
+type edgeClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEdgeClient(cc grpc.ClientConnInterface) EdgeClient {
+	return &edgeClient{cc}
+}
+
+func (c *edgeClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error) {
+	out := new(GetResponse)
+	err := c.cc.Invoke(ctx, "/edgekv.v1.Edge/Get", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *edgeClient) Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error) {
+	out := new(SetResponse)
+	err := c.cc.Invoke(ctx, "/edgekv.v1.Edge/Set", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *edgeClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, "/edgekv.v1.Edge/Delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *edgeClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	out := new(ListResponse)
+	err := c.cc.Invoke(ctx, "/edgekv.v1.Edge/List", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *edgeClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Edge_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Edge_ServiceDesc.Streams[0], "/edgekv.v1.Edge/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &edgeWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Edge_WatchClient interface {
+	Recv() (*WatchEvent, error)
+	grpc.ClientStream
+}
+
+type edgeWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *edgeWatchClient) Recv() (*WatchEvent, error) {
+	m := new(WatchEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *edgeClient) Bind(ctx context.Context, opts ...grpc.CallOption) (Edge_BindClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Edge_ServiceDesc.Streams[1], "/edgekv.v1.Edge/Bind", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &edgeBindClient{stream}
+	return x, nil
+}
+
+type Edge_BindClient interface {
+	Send(*BindRequest) error
+	Recv() (*BindCall, error)
+	grpc.ClientStream
+}
+
+type edgeBindClient struct {
+	grpc.ClientStream
+}
+
+func (x *edgeBindClient) Send(m *BindRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *edgeBindClient) Recv() (*BindCall, error) {
+	m := new(BindCall)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// EdgeServer is the server API for Edge service.
+// All implementations must embed UnimplementedEdgeServer
+// for forward compatibility
+type EdgeServer interface {
+	// Get 读取键值，键不存在时返回 NOT_FOUND
+	Get(context.Context, *GetRequest) (*GetResponse, error)
+	// Set 写入键值并同步到 Center
+	Set(context.Context, *SetRequest) (*SetResponse, error)
+	// Delete 删除键值，存储不支持删除时返回 UNIMPLEMENTED
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	// List 列出以 prefix 开头的键
+	List(context.Context, *ListRequest) (*ListResponse, error)
+	// Watch 推送匹配 pattern 的变更，重连时带上最后收到的事件 ID 补发断线期间的变更
+	Watch(*WatchRequest, Edge_WatchServer) error
+	// Bind 注册观察者，客户端先发送带 pattern 的消息，之后回复服务端发来的 BIND_GET 调用
+	Bind(Edge_BindServer) error
+	mustEmbedUnimplementedEdgeServer()
+}
+
+// UnimplementedEdgeServer must be embedded to have forward compatible implementations.
+type UnimplementedEdgeServer struct {
+}
+
+func (UnimplementedEdgeServer) Get(context.Context, *GetRequest) (*GetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedEdgeServer) Set(context.Context, *SetRequest) (*SetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Set not implemented")
+}
+func (UnimplementedEdgeServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedEdgeServer) List(context.Context, *ListRequest) (*ListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedEdgeServer) Watch(*WatchRequest, Edge_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedEdgeServer) Bind(Edge_BindServer) error {
+	return status.Errorf(codes.Unimplemented, "method Bind not implemented")
+}
+func (UnimplementedEdgeServer) mustEmbedUnimplementedEdgeServer() {}
+
+// UnsafeEdgeServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EdgeServer will
+// result in compilation errors.
+type UnsafeEdgeServer interface {
+	mustEmbedUnimplementedEdgeServer()
+}
+
+func RegisterEdgeServer(s grpc.ServiceRegistrar, srv EdgeServer) {
+	s.RegisterService(&Edge_ServiceDesc, srv)
+}
+
+func _Edge_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EdgeServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/edgekv.v1.Edge/Get",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EdgeServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Edge_Set_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EdgeServer).Set(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/edgekv.v1.Edge/Set",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EdgeServer).Set(ctx, req.(*SetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Edge_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EdgeServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/edgekv.v1.Edge/Delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EdgeServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Edge_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EdgeServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/edgekv.v1.Edge/List",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EdgeServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Edge_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EdgeServer).Watch(m, &edgeWatchServer{stream})
+}
+
+type Edge_WatchServer interface {
+	Send(*WatchEvent) error
+	grpc.ServerStream
+}
+
+type edgeWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *edgeWatchServer) Send(m *WatchEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Edge_Bind_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(EdgeServer).Bind(&edgeBindServer{stream})
+}
+
+type Edge_BindServer interface {
+	Send(*BindCall) error
+	Recv() (*BindRequest, error)
+	grpc.ServerStream
+}
+
+type edgeBindServer struct {
+	grpc.ServerStream
+}
+
+func (x *edgeBindServer) Send(m *BindCall) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *edgeBindServer) Recv() (*BindRequest, error) {
+	m := new(BindRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Edge_ServiceDesc is the grpc.ServiceDesc for Edge service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Edge_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "edgekv.v1.Edge",
+	HandlerType: (*EdgeServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _Edge_Get_Handler,
+		},
+		{
+			MethodName: "Set",
+			Handler:    _Edge_Set_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _Edge_Delete_Handler,
+		},
+		{
+			MethodName: "List",
+			Handler:    _Edge_List_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _Edge_Watch_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Bind",
+			Handler:       _Edge_Bind_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "edgekv.proto",
+}
@@ -0,0 +1,26 @@
+package edgepb
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// NewValue 把 Go 的值转换为 google.protobuf.Value, structpb 不支持的类型先经过 json 转换
+func NewValue(val interface{}) (*structpb.Value, error) {
+	if v, err := structpb.NewValue(val); err == nil {
+		return v, nil
+	}
+
+	b, err := json.Marshal(val)
+	if err != nil {
+		return nil, fmt.Errorf("edgepb: convert %T %w", val, err)
+	}
+
+	var plain interface{}
+	if err = json.Unmarshal(b, &plain); err != nil {
+		return nil, fmt.Errorf("edgepb: convert %T %w", val, err)
+	}
+	return structpb.NewValue(plain)
+}
@@ -0,0 +1,21 @@
+package edgepb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewValue(t *testing.T) {
+	v, err := NewValue(map[string]interface{}{"on": true, "count": 2})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"on": true, "count": float64(2)}, v.AsInterface())
+
+	// structpb 不支持的类型经过 json 转换
+	v, err = NewValue([]string{"a", "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"a", "b"}, v.AsInterface())
+
+	_, err = NewValue(make(chan int))
+	assert.Error(t, err)
+}
@@ -3,9 +3,11 @@ package edgekv
 import "github.com/hysios/utils/errors"
 
 var (
-	ErrNonimpement = errors.New("nonimplement")
+	ErrNonimpement    = errors.New("nonimplement")
+	ErrUnknownCommand = errors.New("unknown command")
 )
 
 func init() {
 	errors.RegisterErrCode(ErrNonimpement, errors.ErrAuto) // 10000
+	errors.RegisterErrCode(ErrUnknownCommand, errors.ErrAuto)
 }
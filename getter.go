@@ -152,7 +152,17 @@ func (a *accessor) GetStringMapStringSlice(key string) map[string][]string {
 }
 
 func (a *accessor) GetSizeInBytes(key string) uint {
-	panic("not implemented") // TODO: Implement
+	v := a.get(key)
+	if s, ok := v.(string); ok {
+		size, _ := parseSizeInBytes(s)
+		return size
+	}
+
+	if v, ok := convert.Uint(v); ok {
+		return v
+	}
+
+	return 0
 }
 
 func (a *accessor) SetDefault(key string, val interface{}) {
@@ -18,6 +18,10 @@ require (
 	github.com/imdario/mergo v0.3.12
 	github.com/jinzhu/copier v0.3.0
 	github.com/kr/pretty v0.2.1
+	github.com/mitchellh/mapstructure v1.2.2
+	github.com/mochi-co/mqtt v1.0.0
+	github.com/nats-io/nats-server/v2 v2.6.0
+	github.com/nats-io/nats.go v1.12.3
 	github.com/r3labs/diff v1.1.0
 	github.com/r3labs/diff/v2 v2.13.0
 	github.com/spf13/afero v1.1.2
@@ -25,9 +29,15 @@ require (
 	github.com/stretchr/testify v1.7.0
 	github.com/tidwall/buntdb v1.2.3
 	github.com/tj/assert v0.0.3
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	go.etcd.io/bbolt v1.3.5
 	go.uber.org/atomic v1.6.0
+	golang.org/x/crypto v0.0.0-20210616213533-5ff15b29337e
 	golang.org/x/exp v0.0.0-20210126221216-84987778548c
-	golang.org/x/oauth2 v0.0.0-20180821212333-d2e6202438be
+	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
+	google.golang.org/grpc v1.43.0
+	google.golang.org/protobuf v1.26.0
+	modernc.org/sqlite v1.10.8
 )
 
 replace github.com/hysios/log => ../log
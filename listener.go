@@ -38,6 +38,9 @@ type Listener struct {
 
 	run        atomic.Bool
 	dispatchCh chan DispatchEvent
+	done       chan struct{}
+	initOnce   sync.Once
+	closeOnce  sync.Once
 	subLock    sync.RWMutex
 	lastID     int
 }
@@ -50,8 +53,13 @@ func NewListner() *Listener {
 	return listen
 }
 
+// init 创建分发与关闭的 channel, Start 在另外的 goroutine 中运行时，
+// Close 与 Dispatch 可能先于 Start 调用
 func (listen *Listener) init() {
-	listen.dispatchCh = make(chan DispatchEvent)
+	listen.initOnce.Do(func() {
+		listen.dispatchCh = make(chan DispatchEvent)
+		listen.done = make(chan struct{})
+	})
 }
 
 func (listen *Listener) Start() error {
@@ -65,11 +73,11 @@ func (listen *Listener) Start() error {
 
 	for listen.run.Load() {
 		select {
-		case event, ok := <-listen.dispatchCh:
-			if !ok {
-				break
-			}
-
+		case <-listen.done:
+			// 已经关闭
+			listen.run.Store(false)
+			return nil
+		case event := <-listen.dispatchCh:
 			func(subscribes []Subscribe) {
 				listen.subLock.RLock()
 				defer listen.subLock.RUnlock()
@@ -86,21 +94,31 @@ func (listen *Listener) Start() error {
 	return nil
 }
 
+// Close 停止分发，可以重复调用; 分发的 channel 不关闭，避免与 Dispatch 的发送竞争
 func (listen *Listener) Close() error {
-	listen.run.Store(false)
-	listen.subLock.Lock()
-	listen.subscribes = nil
-	listen.subLock.Unlock()
-
-	close(listen.dispatchCh)
+	listen.init()
+	listen.closeOnce.Do(func() {
+		listen.run.Store(false)
+		listen.subLock.Lock()
+		listen.subscribes = nil
+		listen.subLock.Unlock()
+
+		close(listen.done)
+	})
 	return nil
 }
 
+// Dispatch 把事件交给 Start 分发，已经关闭时丢弃
 func (listen *Listener) Dispatch(key string, payload interface{}) {
 	if !listen.run.Load() {
 		return
 	}
-	listen.dispatchCh <- DispatchEvent{Key: key, Payload: payload}
+
+	listen.init()
+	select {
+	case listen.dispatchCh <- DispatchEvent{Key: key, Payload: payload}:
+	case <-listen.done:
+	}
 }
 
 func (listen *Listener) Watch(pattern string, fn SubscribeFunc) int {
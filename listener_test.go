@@ -29,3 +29,22 @@ func TestListener_Dispatch(t *testing.T) {
 	})
 	wait()
 }
+
+func TestListener_Close(t *testing.T) {
+	var listen = NewListner()
+	wait()
+
+	// Close 与 Dispatch 并发调用时不会向已经关闭的 channel 发送
+	var done = make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			listen.Dispatch("test.on", i)
+		}
+	}()
+
+	listen.Close()
+	listen.Close()
+	<-done
+	listen.Dispatch("test.on", true)
+}
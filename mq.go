@@ -1,7 +1,13 @@
 package edgekv
 
 import (
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/hex"
 	"fmt"
+	"reflect"
+	"sync"
+	"time"
 
 	"github.com/r3labs/diff/v2"
 )
@@ -20,42 +26,57 @@ const (
 	CmdSetBind       Command = "set_bind"
 	CmdRetBind       Command = "ret_bind"
 	CmdDeleteBind    Command = "delete_bind"
+	CmdDesired       Command = "desired"
 )
 
 type Message struct {
-	From    string
-	Type    Command
-	Payload interface{}
+	// ID 消息的唯一标识，接收方据此去重，由 NewMessage 生成
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+
+	From    string      `json:"from"`
+	Type    Command     `json:"type"`
+	Payload interface{} `json:"payload"`
+	// Topic 收到消息时由消息队列填写的主题 (不含队列的前缀), 发布时忽略
+	Topic string `json:"-"`
+	// Retained 收到的消息是否为订阅时代理发送的保留消息
+	Retained bool `json:"-"`
 }
 
 type MessageChangelog struct {
-	Key     string
-	Changes diff.Changelog
+	Key     string         `json:"key"`
+	Changes diff.Changelog `json:"changes"`
 }
 
 type MessageDeclareBinder struct {
-	Pattern string
+	Pattern string `json:"pattern"`
 }
 
 type MessageGetBind struct {
-	Key       string
-	SessionID string
+	Key       string `json:"key"`
+	SessionID string `json:"sessionID"`
 }
 
 type MessageRetBind struct {
-	Key       string
-	SessionID string
-	Value     interface{}
-	Found     bool
+	Key       string      `json:"key"`
+	SessionID string      `json:"sessionID"`
+	Value     interface{} `json:"value"`
+	Found     bool        `json:"found"`
 }
 
 type MessageSetBind struct {
-	Key   string
-	Value interface{}
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
 }
 
 type MessageDeleteBind struct {
-	Key string
+	Key string `json:"key"`
+}
+
+// MessageDesired Center 上模型的最新值，以保留消息发布
+type MessageDesired struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
 }
 
 type MessageQueue interface {
@@ -64,6 +85,12 @@ type MessageQueue interface {
 	Close() error
 }
 
+// RetainPublisher 支持保留消息的队列，代理为每个主题保存最后一条保留消息，
+// 新的订阅者在订阅时立即收到匹配主题的保留消息
+type RetainPublisher interface {
+	PublishRetained(topic string, msg Message) error
+}
+
 type OpenQueueFunc func(args ...string) (MessageQueue, error)
 
 var mqs = make(map[string]OpenQueueFunc)
@@ -83,20 +110,104 @@ func OpenQueue(name string, args ...string) (MessageQueue, error) {
 	}
 }
 
+// NewMessage 创建带有唯一 ID 与创建时间的消息
+func NewMessage(from string, typ Command, payload interface{}) Message {
+	return Message{
+		ID:      NewMessageID(),
+		Time:    time.Now(),
+		From:    from,
+		Type:    typ,
+		Payload: payload,
+	}
+}
+
+// NewMessageID 生成 128 位随机的消息 ID
+func NewMessageID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// PayloadFunc 返回命令载荷的新指针，例如 new(MessageChangelog)
+type PayloadFunc func() interface{}
+
+var (
+	commands  = make(map[Command]PayloadFunc)
+	commandMu sync.RWMutex
+)
+
+// RegisterCommand 注册命令及其载荷类型，同时注册到 gob, 新的消息类型只需要在这里注册一次
+func RegisterCommand(cmd Command, fn PayloadFunc) {
+	commandMu.Lock()
+	defer commandMu.Unlock()
+
+	if _, ok := commands[cmd]; ok {
+		return
+	}
+
+	gob.Register(fn())
+	commands[cmd] = fn
+}
+
+// NewPayload 返回命令 cmd 的载荷指针，命令未注册时返回 ErrUnknownCommand
+func NewPayload(cmd Command) (interface{}, error) {
+	commandMu.RLock()
+	fn, ok := commands[cmd]
+	commandMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownCommand, cmd)
+	}
+	return fn(), nil
+}
+
+// Build 把 Payload 设置为命令对应的空载荷指针，命令未注册时返回 false
 func (msg *Message) Build() bool {
-	switch msg.Type {
-	case CmdChangelog:
-		msg.Payload = MessageChangelog{}
-	case CmdDeclareBinder:
-		msg.Payload = MessageDeclareBinder{}
-	case CmdGetBind:
-		msg.Payload = MessageGetBind{}
-	case CmdSetBind:
-		msg.Payload = MessageSetBind{}
-	case CmdDeleteBind:
-		msg.Payload = MessageDeleteBind{}
-	default:
+	payload, err := NewPayload(msg.Type)
+	if err != nil {
 		return false
 	}
+
+	msg.Payload = payload
 	return true
 }
+
+// Normalize 检查命令已注册，并把值类型的载荷转换为注册的指针类型，
+// 处理函数总是可以用 msg.Payload.(*MessageXxx) 取得载荷
+func (msg *Message) Normalize() error {
+	payload, err := NewPayload(msg.Type)
+	if err != nil {
+		return err
+	}
+
+	var (
+		want = reflect.TypeOf(payload)
+		val  = reflect.ValueOf(msg.Payload)
+	)
+
+	switch {
+	case msg.Payload == nil:
+		msg.Payload = payload
+	case val.Type() == want:
+	case val.Type() == want.Elem():
+		ptr := reflect.New(want.Elem())
+		ptr.Elem().Set(val)
+		msg.Payload = ptr.Interface()
+	default:
+		return fmt.Errorf("edgekv: invalid payload %T for command '%s'", msg.Payload, msg.Type)
+	}
+
+	return nil
+}
+
+func init() {
+	RegisterCommand(CmdChangelog, func() interface{} { return new(MessageChangelog) })
+	RegisterCommand(CmdDeclareBinder, func() interface{} { return new(MessageDeclareBinder) })
+	RegisterCommand(CmdGetBind, func() interface{} { return new(MessageGetBind) })
+	RegisterCommand(CmdSetBind, func() interface{} { return new(MessageSetBind) })
+	RegisterCommand(CmdRetBind, func() interface{} { return new(MessageRetBind) })
+	RegisterCommand(CmdDeleteBind, func() interface{} { return new(MessageDeleteBind) })
+	RegisterCommand(CmdDesired, func() interface{} { return new(MessageDesired) })
+}
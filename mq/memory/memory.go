@@ -0,0 +1,335 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/codec"
+	"github.com/hysios/log"
+)
+
+// Broker 进程内的消息代理，同名的队列连接到同一个 Broker 上互相通信
+type Broker struct {
+	mu       sync.RWMutex
+	subs     []*subscription
+	retained map[string]delivery
+}
+
+type subscription struct {
+	client *memoryMQ
+	filter string
+	qos    byte
+	fn     func(msg edgekv.Message) error
+	ch     chan delivery
+	done   chan struct{}
+}
+
+type delivery struct {
+	topic    string
+	payload  []byte
+	qos      byte
+	retained bool
+}
+
+var (
+	brokers  = make(map[string]*Broker)
+	brokerMu sync.Mutex
+)
+
+var (
+	// BufferSize 每个订阅者的投递缓冲大小, QoS 0 的消息在缓冲满时丢弃
+	BufferSize = 256
+	// RedeliverInterval QoS 1/2 的消息处理失败后重新投递的间隔
+	RedeliverInterval = 10 * time.Millisecond
+	// MaxRedeliver QoS 1/2 的消息最多重新投递的次数
+	MaxRedeliver = 10
+)
+
+var ErrClosed = errors.New("memory_mq: queue closed")
+
+// NewBroker 创建一个独立的 Broker
+func NewBroker() *Broker {
+	return &Broker{retained: make(map[string]delivery)}
+}
+
+// OpenBroker 返回名为 name 的共享 Broker, 不存在时创建
+func OpenBroker(name string) *Broker {
+	brokerMu.Lock()
+	defer brokerMu.Unlock()
+
+	if broker, ok := brokers[name]; ok {
+		return broker
+	}
+
+	broker := NewBroker()
+	brokers[name] = broker
+	return broker
+}
+
+func (broker *Broker) subscribe(sub *subscription) {
+	broker.mu.Lock()
+	broker.subs = append(broker.subs, sub)
+
+	var retained []delivery
+	for topic, d := range broker.retained {
+		if edgekv.MatchTopic(sub.filter, topic) {
+			retained = append(retained, d)
+		}
+	}
+	broker.mu.Unlock()
+
+	// 与 MQTT 一致，订阅时先收到匹配主题的保留消息
+	for _, d := range retained {
+		if sub.qos < d.qos {
+			d.qos = sub.qos
+		}
+		d.retained = true
+
+		select {
+		case sub.ch <- d:
+		case <-sub.done:
+			return
+		}
+	}
+}
+
+// retain 保存主题的最后一条保留消息，空的载荷清除保留消息
+func (broker *Broker) retain(topic string, payload []byte, qos byte) {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	if len(payload) == 0 {
+		delete(broker.retained, topic)
+		return
+	}
+	broker.retained[topic] = delivery{topic: topic, payload: payload, qos: qos}
+}
+
+func (broker *Broker) unsubscribe(client *memoryMQ) {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	var subs = broker.subs[:0]
+	for _, sub := range broker.subs {
+		if sub.client == client {
+			close(sub.done)
+			continue
+		}
+		subs = append(subs, sub)
+	}
+	broker.subs = subs
+}
+
+func (broker *Broker) publish(topic string, payload []byte, qos byte) {
+	// 投递时不持有锁，订阅者在回调中可以继续发布或订阅
+	broker.mu.RLock()
+	var subs = make([]*subscription, len(broker.subs))
+	copy(subs, broker.subs)
+	broker.mu.RUnlock()
+
+	for _, sub := range subs {
+		if !edgekv.MatchTopic(sub.filter, topic) {
+			continue
+		}
+
+		// 与 MQTT 一致，实际的服务质量取发布与订阅中较低的一方
+		var d = delivery{topic: topic, payload: payload, qos: qos}
+		if sub.qos < d.qos {
+			d.qos = sub.qos
+		}
+
+		if d.qos == 0 {
+			select {
+			case sub.ch <- d:
+			case <-sub.done:
+			default:
+				log.Debugf("memory_mq: drop qos 0 message on topic '%s'", topic)
+			}
+			continue
+		}
+
+		select {
+		case sub.ch <- d:
+		case <-sub.done:
+		}
+	}
+}
+
+type memoryMQ struct {
+	Prefix string
+
+	Q      byte
+	Codec  codec.Codec
+	broker *Broker
+	closed chan struct{}
+	once   sync.Once
+}
+
+// OpenMemoryMQ 打开进程内的消息队列, uri 格式为 memory://<broker>/<prefix>?qos=2&codec=gob
+func OpenMemoryMQ(uri string) (*memoryMQ, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("memory_mq: parse uri error: %w", err)
+	}
+
+	var mq = &memoryMQ{
+		Q:      2,
+		broker: OpenBroker(u.Host),
+		closed: make(chan struct{}),
+	}
+
+	if len(u.Path) > 1 {
+		mq.Prefix = strings.TrimPrefix(u.Path, "/")
+	}
+
+	if q := u.Query().Get("qos"); len(q) > 0 {
+		qos, err := strconv.Atoi(q)
+		if err != nil || qos < 0 || qos > 2 {
+			return nil, fmt.Errorf("memory_mq: invalid qos '%s'", q)
+		}
+		mq.Q = byte(qos)
+	}
+
+	if mq.Codec, err = codec.Get(u.Query().Get("codec")); err != nil {
+		return nil, fmt.Errorf("memory_mq: %w", err)
+	}
+
+	return mq, nil
+}
+
+func (mq *memoryMQ) FullTopic(_topic string) string {
+	return path.Join(mq.Prefix, _topic)
+}
+
+// relTopic 去掉主题的队列前缀
+func (mq *memoryMQ) relTopic(topic string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(topic, mq.Prefix), "/")
+}
+
+func (mq *memoryMQ) Publish(topic string, msg edgekv.Message) error {
+	select {
+	case <-mq.closed:
+		return ErrClosed
+	default:
+	}
+
+	// 与网络传输一样经过编码，保证订阅者拿到的是独立的副本
+	b, err := mq.Codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("memory_mq: publish to topic %s with qos mode %d", mq.FullTopic(topic), mq.Q)
+	mq.broker.publish(mq.FullTopic(topic), b, mq.Q)
+	return nil
+}
+
+// PublishRetained 发布消息并保存为主题的保留消息
+func (mq *memoryMQ) PublishRetained(topic string, msg edgekv.Message) error {
+	select {
+	case <-mq.closed:
+		return ErrClosed
+	default:
+	}
+
+	b, err := mq.Codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("memory_mq: publish retained to topic %s", mq.FullTopic(topic))
+	mq.broker.retain(mq.FullTopic(topic), b, mq.Q)
+	mq.broker.publish(mq.FullTopic(topic), b, mq.Q)
+	return nil
+}
+
+func (mq *memoryMQ) Subscribe(topic string, fn func(msg edgekv.Message) error) error {
+	select {
+	case <-mq.closed:
+		return ErrClosed
+	default:
+	}
+
+	var sub = &subscription{
+		client: mq,
+		filter: mq.FullTopic(topic),
+		qos:    mq.Q,
+		fn:     fn,
+		ch:     make(chan delivery, BufferSize),
+		done:   make(chan struct{}),
+	}
+
+	log.Infof("memory_mq: subscribe topic '%s' with qos mode %d", sub.filter, sub.qos)
+	go sub.run()
+	mq.broker.subscribe(sub)
+	return nil
+}
+
+func (mq *memoryMQ) Close() error {
+	mq.once.Do(func() {
+		close(mq.closed)
+		mq.broker.unsubscribe(mq)
+	})
+	return nil
+}
+
+func (sub *subscription) run() {
+	for {
+		select {
+		case d := <-sub.ch:
+			sub.deliver(d)
+		case <-sub.done:
+			return
+		}
+	}
+}
+
+func (sub *subscription) deliver(d delivery) {
+	for i := 0; ; i++ {
+		var msg edgekv.Message
+		if err := sub.client.Codec.Unmarshal(d.payload, &msg); err != nil {
+			log.Errorf("memory_mq: unmarshal message error %s", err)
+			return
+		}
+
+		msg.Topic = sub.client.relTopic(d.topic)
+		msg.Retained = d.retained
+		err := sub.fn(msg)
+		if err == nil || d.qos == 0 {
+			return
+		}
+
+		// QoS 1/2 的消息在处理失败时没有确认，重新投递
+		if i >= MaxRedeliver {
+			log.Errorf("memory_mq: give up message on topic '%s' error %s", d.topic, err)
+			return
+		}
+
+		select {
+		case <-time.After(RedeliverInterval):
+		case <-sub.done:
+			return
+		}
+	}
+}
+
+func init() {
+	edgekv.RegisterQueue("memory", func(args ...string) (edgekv.MessageQueue, error) {
+		if len(args) < 1 {
+			return nil, errors.New("memory_mq: missing open uri")
+		}
+		return OpenMemoryMQ(args[0])
+	})
+}
+
+var (
+	_ edgekv.MessageQueue    = &memoryMQ{}
+	_ edgekv.RetainPublisher = &memoryMQ{}
+)
@@ -0,0 +1,157 @@
+package memory
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/mq/mqtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryMQ(t *testing.T) {
+	mqtest.TestQueue(t, func() edgekv.MessageQueue {
+		mq, err := OpenMemoryMQ("memory://mqtest/edgekv")
+		if err != nil {
+			t.Fatalf("open memory mq error %s", err)
+		}
+		return mq
+	})
+}
+
+func TestMemoryMQ_JSONCodec(t *testing.T) {
+	mqtest.TestQueue(t, func() edgekv.MessageQueue {
+		mq, err := OpenMemoryMQ("memory://mqtest-json/edgekv?codec=json")
+		if err != nil {
+			t.Fatalf("open memory mq error %s", err)
+		}
+		return mq
+	})
+}
+
+func TestOpenMemoryMQ_UnknownCodec(t *testing.T) {
+	_, err := OpenMemoryMQ("memory://mqtest/edgekv?codec=xml")
+	assert.Error(t, err)
+}
+
+func TestMatchTopic(t *testing.T) {
+	var tests = []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{"edgekv/sync", "edgekv/sync", true},
+		{"edgekv/sync", "edgekv/binder", false},
+		{"edgekv/+/sync", "edgekv/A/sync", true},
+		{"edgekv/+/sync", "edgekv/A/B/sync", false},
+		{"edgekv/#", "edgekv/A/B/sync", true},
+		{"edgekv/#", "edgekv", true},
+		{"edgekv/+", "edgekv", false},
+		{"#", "edgekv/A", true},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, edgekv.MatchTopic(tt.filter, tt.topic), tt.want, "%s %s", tt.filter, tt.topic)
+	}
+}
+
+func TestMemoryMQ_Redeliver(t *testing.T) {
+	pub, _ := OpenMemoryMQ("memory://redeliver/edgekv?qos=1")
+	sub, _ := OpenMemoryMQ("memory://redeliver/edgekv?qos=1")
+	defer pub.Close()
+	defer sub.Close()
+
+	var ch = make(chan int, 10)
+	var n int
+	sub.Subscribe("sync", func(msg edgekv.Message) error {
+		n++
+		ch <- n
+		if n < 3 {
+			return errors.New("not ready")
+		}
+		return nil
+	})
+
+	pub.Publish("sync", edgekv.Message{From: "TEST", Type: edgekv.CmdChangelog, Payload: edgekv.MessageChangelog{Key: "test"}})
+	for i := 1; i <= 3; i++ {
+		select {
+		case got := <-ch:
+			assert.Equal(t, got, i)
+		case <-time.After(time.Second):
+			t.Fatalf("wait redeliver timeout")
+		}
+	}
+
+	select {
+	case got := <-ch:
+		t.Errorf("unexpected delivery %d", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMemoryMQ_QoS0(t *testing.T) {
+	pub, _ := OpenMemoryMQ("memory://qos0/edgekv?qos=0")
+	sub, _ := OpenMemoryMQ("memory://qos0/edgekv?qos=2")
+	defer pub.Close()
+	defer sub.Close()
+
+	var ch = make(chan struct{}, 10)
+	sub.Subscribe("sync", func(msg edgekv.Message) error {
+		ch <- struct{}{}
+		return errors.New("not ready")
+	})
+
+	pub.Publish("sync", edgekv.Message{From: "TEST", Type: edgekv.CmdChangelog, Payload: edgekv.MessageChangelog{Key: "test"}})
+	<-ch
+	select {
+	case <-ch:
+		t.Errorf("qos 0 message should not be redelivered")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMemoryMQ_Retained(t *testing.T) {
+	pub, _ := OpenMemoryMQ("memory://retained/edgekv")
+	defer pub.Close()
+
+	var msg = func(key string) edgekv.Message {
+		return edgekv.Message{From: "TEST", Type: edgekv.CmdDesired, Payload: edgekv.MessageDesired{Key: key}}
+	}
+
+	assert.NoError(t, pub.PublishRetained("desired/a", msg("a1")))
+	assert.NoError(t, pub.PublishRetained("desired/a", msg("a2")))
+	assert.NoError(t, pub.PublishRetained("desired/b", msg("b1")))
+
+	sub, _ := OpenMemoryMQ("memory://retained/edgekv")
+	defer sub.Close()
+
+	var ch = make(chan edgekv.Message, 10)
+	sub.Subscribe("desired/#", func(msg edgekv.Message) error {
+		ch <- msg
+		return nil
+	})
+
+	var keys []string
+	for i := 0; i < 2; i++ {
+		select {
+		case m := <-ch:
+			assert.True(t, m.Retained)
+			keys = append(keys, m.Payload.(*edgekv.MessageDesired).Key)
+		case <-time.After(time.Second):
+			t.Fatalf("wait retained message timeout")
+		}
+	}
+	// 每个主题只保留最后一条消息
+	assert.ElementsMatch(t, keys, []string{"a2", "b1"})
+
+	// 订阅之后发布的消息不是保留消息
+	assert.NoError(t, pub.PublishRetained("desired/a", msg("a3")))
+	select {
+	case m := <-ch:
+		assert.False(t, m.Retained)
+		assert.Equal(t, m.Payload.(*edgekv.MessageDesired).Key, "a3")
+	case <-time.After(time.Second):
+		t.Fatalf("wait message timeout")
+	}
+}
@@ -0,0 +1,222 @@
+// Package mqtest 提供 edgekv.MessageQueue 实现的一致性测试，
+// 每个消息队列后端在自己的测试中调用 TestQueue 即可。
+//
+// 所有实现需要满足以下语义:
+//  1. Subscribe 返回后，发布到匹配主题的消息都会投递给订阅者
+//  2. 订阅支持 MQTT 风格的通配符, + 匹配单层, # 匹配剩余的所有层
+//  3. 订阅者收到的 Payload 是具体类型的指针，例如 *edgekv.MessageChangelog
+//  4. 同一主题上的消息按发布顺序投递
+//  5. 同一主题的多个订阅者都会收到消息
+//  6. Close 之后不再投递消息
+//  7. 订阅者收到的消息 Topic 为实际发布的主题，不含队列的前缀
+package mqtest
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hysios/edgekv"
+	"github.com/r3labs/diff/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// OpenFunc 每次调用返回一个连接到同一个代理的新客户端
+type OpenFunc func() edgekv.MessageQueue
+
+// Timeout 等待消息投递的最长时间
+var Timeout = 3 * time.Second
+
+// TestQueue 对 open 返回的消息队列运行所有一致性测试
+func TestQueue(t *testing.T, open OpenFunc) {
+	t.Run("PublishSubscribe", func(t *testing.T) { testPublishSubscribe(t, open) })
+	t.Run("Wildcard", func(t *testing.T) { testWildcard(t, open) })
+	t.Run("Order", func(t *testing.T) { testOrder(t, open) })
+	t.Run("MultipleSubscribers", func(t *testing.T) { testMultipleSubscribers(t, open) })
+	t.Run("Close", func(t *testing.T) { testClose(t, open) })
+}
+
+// topic 为每个测试生成独立的主题，避免在共享的代理上互相干扰
+func topic(name string) string {
+	return fmt.Sprintf("mqtest/%d/%s", rand.Int63(), name)
+}
+
+func changelog(from, key string, val interface{}) edgekv.Message {
+	return edgekv.Message{
+		From: from,
+		Type: edgekv.CmdChangelog,
+		Payload: edgekv.MessageChangelog{
+			Key:     key,
+			Changes: diff.Changelog{{Type: diff.UPDATE, Path: []string{key}, To: val}},
+		},
+	}
+}
+
+type receiver struct {
+	ch chan edgekv.Message
+}
+
+func newReceiver() *receiver {
+	return &receiver{ch: make(chan edgekv.Message, 64)}
+}
+
+func (r *receiver) handle(msg edgekv.Message) error {
+	r.ch <- msg
+	return nil
+}
+
+func (r *receiver) receive(t *testing.T) (edgekv.Message, bool) {
+	select {
+	case msg := <-r.ch:
+		return msg, true
+	case <-time.After(Timeout):
+		t.Errorf("wait message timeout")
+		return edgekv.Message{}, false
+	}
+}
+
+func (r *receiver) empty(t *testing.T, wait time.Duration) {
+	select {
+	case msg := <-r.ch:
+		t.Errorf("unexpected message %v", msg)
+	case <-time.After(wait):
+	}
+}
+
+func testPublishSubscribe(t *testing.T, open OpenFunc) {
+	var (
+		pub, sub = open(), open()
+		name     = topic("sync")
+		r        = newReceiver()
+	)
+	defer pub.Close()
+	defer sub.Close()
+
+	assert.NoError(t, sub.Subscribe(name, r.handle))
+	assert.NoError(t, pub.Publish(name, changelog("MQTEST", "test.on", true)))
+
+	msg, ok := r.receive(t)
+	if !ok {
+		return
+	}
+
+	assert.Equal(t, msg.From, "MQTEST")
+	assert.Equal(t, msg.Type, edgekv.CmdChangelog)
+	assert.Equal(t, msg.Topic, name)
+
+	cmdMsg, ok := msg.Payload.(*edgekv.MessageChangelog)
+	if assert.True(t, ok, "payload type %T", msg.Payload) {
+		assert.Equal(t, cmdMsg.Key, "test.on")
+		assert.Len(t, cmdMsg.Changes, 1)
+		assert.Equal(t, cmdMsg.Changes[0].To, true)
+	}
+}
+
+func testWildcard(t *testing.T, open OpenFunc) {
+	var (
+		pub, sub = open(), open()
+		base     = topic("edge")
+		single   = newReceiver()
+		multi    = newReceiver()
+	)
+	defer pub.Close()
+	defer sub.Close()
+
+	assert.NoError(t, sub.Subscribe(base+"/+/sync", single.handle))
+	assert.NoError(t, sub.Subscribe(base+"/#", multi.handle))
+
+	assert.NoError(t, pub.Publish(base+"/A/sync", changelog("A", "test.on", true)))
+	assert.NoError(t, pub.Publish(base+"/B/bind/get", changelog("B", "test.on", false)))
+
+	if msg, ok := single.receive(t); ok {
+		assert.Equal(t, msg.From, "A")
+		assert.Equal(t, msg.Topic, base+"/A/sync")
+	}
+	single.empty(t, 100*time.Millisecond)
+
+	var froms []string
+	for i := 0; i < 2; i++ {
+		if msg, ok := multi.receive(t); ok {
+			froms = append(froms, msg.From)
+		}
+	}
+	assert.ElementsMatch(t, froms, []string{"A", "B"})
+}
+
+func testOrder(t *testing.T, open OpenFunc) {
+	const n = 20
+
+	var (
+		pub, sub = open(), open()
+		name     = topic("order")
+		r        = newReceiver()
+	)
+	defer pub.Close()
+	defer sub.Close()
+
+	assert.NoError(t, sub.Subscribe(name, r.handle))
+	for i := 0; i < n; i++ {
+		assert.NoError(t, pub.Publish(name, changelog("MQTEST", fmt.Sprintf("k%d", i), i)))
+	}
+
+	for i := 0; i < n; i++ {
+		msg, ok := r.receive(t)
+		if !ok {
+			return
+		}
+		if cmdMsg, ok := msg.Payload.(*edgekv.MessageChangelog); assert.True(t, ok) {
+			assert.Equal(t, cmdMsg.Key, fmt.Sprintf("k%d", i))
+		}
+	}
+}
+
+func testMultipleSubscribers(t *testing.T, open OpenFunc) {
+	var (
+		pub  = open()
+		subs = []edgekv.MessageQueue{open(), open()}
+		name = topic("fanout")
+		wg   sync.WaitGroup
+	)
+	defer pub.Close()
+
+	for _, sub := range subs {
+		defer sub.Close()
+
+		r := newReceiver()
+		assert.NoError(t, sub.Subscribe(name, r.handle))
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if msg, ok := r.receive(t); ok {
+				assert.Equal(t, msg.From, "MQTEST")
+			}
+		}()
+	}
+
+	assert.NoError(t, pub.Publish(name, changelog("MQTEST", "test.on", true)))
+	wg.Wait()
+}
+
+func testClose(t *testing.T, open OpenFunc) {
+	var (
+		pub, sub = open(), open()
+		name     = topic("close")
+		r        = newReceiver()
+	)
+	defer pub.Close()
+
+	assert.NoError(t, sub.Subscribe(name, r.handle))
+	assert.NoError(t, pub.Publish(name, changelog("MQTEST", "test.on", true)))
+	r.receive(t)
+
+	assert.NoError(t, sub.Close())
+	pub.Publish(name, changelog("MQTEST", "test.on", false))
+	r.empty(t, 200*time.Millisecond)
+}
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
@@ -0,0 +1,96 @@
+// Package broker 提供内嵌在进程中的纯 Go MQTT 代理，
+// 小规模部署时 Center 可以直接承载代理，无需单独运行 mosquitto
+package broker
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"sync"
+
+	"github.com/hysios/log"
+	mqtt "github.com/mochi-co/mqtt/server"
+	"github.com/mochi-co/mqtt/server/listeners"
+	"github.com/mochi-co/mqtt/server/listeners/auth"
+)
+
+// DefaultAddr 内嵌代理默认的监听地址
+var DefaultAddr = ":1883"
+
+// Broker 内嵌的 MQTT 代理
+type Broker struct {
+	Addr string
+	Auth auth.Controller
+
+	server *mqtt.Server
+	mu     sync.Mutex
+}
+
+// NewBroker 创建监听在 addr 上的代理, addr 为空时使用 DefaultAddr
+func NewBroker(addr string) *Broker {
+	if len(addr) == 0 {
+		addr = DefaultAddr
+	}
+
+	return &Broker{Addr: addr}
+}
+
+// Start 开始监听并处理客户端连接，不会阻塞
+func (broker *Broker) Start() error {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	if broker.server != nil {
+		return nil
+	}
+
+	var (
+		server = mqtt.New()
+		ac     = broker.Auth
+	)
+
+	if ac == nil {
+		ac = new(auth.Allow)
+	}
+
+	tcp := listeners.NewTCP("edgekv", broker.Addr)
+	if err := server.AddListener(tcp, &listeners.Config{Auth: ac}); err != nil {
+		return fmt.Errorf("mqtt_broker: listen on %s error: %w", broker.Addr, err)
+	}
+
+	if err := server.Serve(); err != nil {
+		return fmt.Errorf("mqtt_broker: serve error: %w", err)
+	}
+
+	log.Infof("mqtt_broker: embedded broker listen on %s", broker.Addr)
+	broker.server = server
+	return nil
+}
+
+// Close 关闭代理以及所有客户端连接
+func (broker *Broker) Close() error {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	if broker.server == nil {
+		return nil
+	}
+
+	err := broker.server.Close()
+	broker.server = nil
+	return err
+}
+
+// URI 返回连接到本代理的 mqtt 队列地址，可直接用于 edgekv.OpenQueue("mqtt", uri)
+func (broker *Broker) URI(prefix string) string {
+	host, port, err := net.SplitHostPort(broker.Addr)
+	if err != nil {
+		return "mqtt://" + path.Join(broker.Addr, prefix)
+	}
+
+	if len(host) == 0 || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+
+	return "mqtt://" + path.Join(net.JoinHostPort(host, port), prefix)
+}
@@ -1,7 +1,6 @@
 package mqtt
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/url"
 	"path"
@@ -11,7 +10,7 @@ import (
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/hysios/edgekv"
-	"github.com/hysios/edgekv/utils"
+	"github.com/hysios/edgekv/codec"
 	"github.com/hysios/log"
 	"github.com/imdario/mergo"
 	"github.com/kr/pretty"
@@ -21,6 +20,7 @@ type mqttMQ struct {
 	Prefix string
 
 	Q        byte
+	Codec    codec.Codec
 	mqClient mqtt.Client
 }
 
@@ -33,7 +33,11 @@ func SetClientID(clientID string) {
 	ClientID = clientID
 }
 
-// OpenMqttMQ 打开消息队列
+// OpenMqttMQ 打开消息队列, uri 例如
+//
+//	mqtt://127.0.0.1:1883/edgekv
+//	mqtts://broker.example.com:8883/edgekv?ca=/etc/edgekv/ca.pem&cert=/etc/edgekv/edge.pem&key=/etc/edgekv/edge.key
+//	wss://broker.example.com:443/edgekv?ws_path=/mqtt
 func OpenMqttMQ(uri string) (*mqttMQ, error) {
 	var (
 		opts *mqtt.ClientOptions
@@ -49,7 +53,7 @@ func OpenMqttMQ(uri string) (*mqttMQ, error) {
 
 	client := mqtt.NewClient(opts)
 	if token := client.Connect(); token.Wait() && token.Error() != nil {
-		return nil, err
+		return nil, fmt.Errorf("mqtt_mq: connect error: %w", token.Error())
 	}
 	mq.mqClient = client
 
@@ -63,8 +67,23 @@ func (mq *mqttMQ) ParseURI(uri string) (*mqtt.ClientOptions, error) {
 	}
 
 	log.Infof("mqtt: open mqtt at %s", uri)
+	broker, secure, err := brokerURL(u)
+	if err != nil {
+		return nil, err
+	}
+
 	var opts = mqtt.NewClientOptions()
-	opts.AddBroker(fmt.Sprintf("tcp://%s", u.Host))
+	opts.AddBroker(broker)
+	if secure {
+		conf, err := NewTLSConfig(u.Query())
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(conf)
+	} else if hasTLSQuery(u.Query()) {
+		return nil, fmt.Errorf("mqtt_mq: tls options require a tls scheme, got '%s'", u.Scheme)
+	}
+
 	opts.SetUsername(u.User.Username())
 	if pass, ok := u.User.Password(); ok {
 		opts.SetPassword(pass)
@@ -72,6 +91,9 @@ func (mq *mqttMQ) ParseURI(uri string) (*mqtt.ClientOptions, error) {
 	if len(u.Path) > 1 {
 		mq.Prefix = strings.TrimPrefix(u.Path, "/")
 	}
+	if mq.Codec, err = codec.Get(u.Query().Get("codec")); err != nil {
+		return nil, fmt.Errorf("mqtt_mq: %w", err)
+	}
 	opts.SetDefaultPublishHandler(mq.messagePubHandler)
 	opts.OnConnect = mq.connectHandler
 	opts.OnConnectionLost = mq.connectLostHandler
@@ -116,14 +138,8 @@ func (mq *mqttMQ) parseQuery(opts *mqtt.ClientOptions, q url.Values) {
 	}
 }
 
-type sendMsg struct {
-	From    string
-	Type    string
-	Payload json.RawMessage
-}
-
 func (mq *mqttMQ) Publish(topic string, msg edgekv.Message) error {
-	b, err := utils.Marshal(msg)
+	b, err := mq.Codec.Marshal(msg)
 	if err != nil {
 		return err
 	}
@@ -134,6 +150,19 @@ func (mq *mqttMQ) Publish(topic string, msg edgekv.Message) error {
 	return mq.Wait(tok)
 }
 
+// PublishRetained 发布保留消息，代理为主题保存最后一条消息，之后订阅的客户端立即收到
+func (mq *mqttMQ) PublishRetained(topic string, msg edgekv.Message) error {
+	b, err := mq.Codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("mqtt: publish retained to topic %s with qos mode %d", mq.FullTopic(topic), mq.Q)
+	tok := mq.mqClient.Publish(mq.FullTopic(topic), mq.Q, true, b)
+
+	return mq.Wait(tok)
+}
+
 func (mq *mqttMQ) Wait(tok mqtt.Token) error {
 	if tok.Wait() && tok.Error() != nil {
 		return tok.Error()
@@ -154,20 +183,14 @@ func (mq *mqttMQ) Subscribe(topic string, fn func(msg edgekv.Message) error) err
 			err error
 		)
 
-		if err = utils.Unmarshal(rawmsg.Payload(), &msg); err != nil {
-			log.Errorf("mqtt: unmarshal message error %s", err)
-			return
-			// return err
-		}
-
-		msg.Build()
-
-		if err = utils.Unmarshal(rawmsg.Payload(), &msg); err != nil {
+		if err = mq.Codec.Unmarshal(rawmsg.Payload(), &msg); err != nil {
 			log.Errorf("mqtt: unmarshal message error %s", err)
 			return
 			// return err
 		}
 
+		msg.Topic = strings.TrimPrefix(strings.TrimPrefix(rawmsg.Topic(), mq.Prefix), "/")
+		msg.Retained = rawmsg.Retained()
 		log.Debugf("msg % #v", pretty.Formatter(msg))
 		if err = fn(msg); err == nil {
 			rawmsg.Ack()
@@ -199,3 +222,8 @@ func init() {
 		return OpenMqttMQ(args[0])
 	})
 }
+
+var (
+	_ edgekv.MessageQueue    = &mqttMQ{}
+	_ edgekv.RetainPublisher = &mqttMQ{}
+)
@@ -0,0 +1,80 @@
+package mqtt
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/mq/mqtest"
+	"github.com/hysios/edgekv/mq/mqtt/broker"
+	"github.com/stretchr/testify/assert"
+)
+
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error %s", err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestMqttMQ(t *testing.T) {
+	b := broker.NewBroker(freeAddr(t))
+	if err := b.Start(); err != nil {
+		t.Fatalf("start broker error %s", err)
+	}
+	defer b.Close()
+
+	mqtest.TestQueue(t, func() edgekv.MessageQueue {
+		mq, err := OpenMqttMQ(b.URI("edgekv"))
+		if err != nil {
+			t.Fatalf("open mqtt error %s", err)
+		}
+		return mq
+	})
+}
+
+func TestMqttMQ_Retained(t *testing.T) {
+	b := broker.NewBroker(freeAddr(t))
+	if err := b.Start(); err != nil {
+		t.Fatalf("start broker error %s", err)
+	}
+	defer b.Close()
+
+	pub, err := OpenMqttMQ(b.URI("edgekv"))
+	if err != nil {
+		t.Fatalf("open mqtt error %s", err)
+	}
+	defer pub.Close()
+
+	assert.NoError(t, pub.PublishRetained("desired/test", edgekv.Message{
+		From:    "CENTER",
+		Type:    edgekv.CmdDesired,
+		Payload: edgekv.MessageDesired{Key: "test", Value: true},
+	}))
+
+	sub, err := OpenMqttMQ(b.URI("edgekv"))
+	if err != nil {
+		t.Fatalf("open mqtt error %s", err)
+	}
+	defer sub.Close()
+
+	var ch = make(chan edgekv.Message, 1)
+	assert.NoError(t, sub.Subscribe("desired/#", func(msg edgekv.Message) error {
+		ch <- msg
+		return nil
+	}))
+
+	select {
+	case msg := <-ch:
+		assert.True(t, msg.Retained)
+		assert.Equal(t, msg.Topic, "desired/test")
+		if desired, ok := msg.Payload.(*edgekv.MessageDesired); assert.True(t, ok) {
+			assert.Equal(t, desired.Value, true)
+		}
+	case <-time.After(mqtest.Timeout):
+		t.Fatalf("wait retained message timeout")
+	}
+}
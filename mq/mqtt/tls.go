@@ -0,0 +1,157 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hysios/log"
+)
+
+// DefaultWebsocketPath 连接 ws:// 与 wss:// 代理时默认的路径, uri 的路径用作主题前缀，
+// 代理的路径不同时通过 ws_path 参数指定
+var DefaultWebsocketPath = "/mqtt"
+
+// brokerURL 根据 uri 的协议返回 paho 使用的代理地址，以及是否需要 TLS
+//
+//	mqtt://, tcp://          明文 TCP
+//	mqtts://, ssl://, tls:// TLS
+//	ws://, wss://            websocket, wss 使用 TLS
+func brokerURL(u *url.URL) (string, bool, error) {
+	switch u.Scheme {
+	case "mqtt", "tcp":
+		return fmt.Sprintf("tcp://%s", u.Host), false, nil
+	case "mqtts", "ssl", "tls":
+		return fmt.Sprintf("ssl://%s", u.Host), true, nil
+	case "ws", "wss":
+		var wsPath = u.Query().Get("ws_path")
+		if len(wsPath) == 0 {
+			wsPath = DefaultWebsocketPath
+		}
+		return fmt.Sprintf("%s://%s%s", u.Scheme, u.Host, wsPath), u.Scheme == "wss", nil
+	default:
+		return "", false, fmt.Errorf("mqtt_mq: unsupported scheme '%s'", u.Scheme)
+	}
+}
+
+// NewTLSConfig 根据 uri 的查询参数创建 TLS 配置
+//
+//	ca                   校验代理证书的 CA 文件, 为空时使用系统的 CA
+//	cert, key            客户端证书与私钥文件，用于双向认证，文件更新后在下一次连接时生效
+//	server_name          校验代理证书时使用的主机名
+//	insecure_skip_verify 不校验代理的证书，只用于测试
+func NewTLSConfig(q url.Values) (*tls.Config, error) {
+	var conf = &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if ca := q.Get("ca"); len(ca) > 0 {
+		b, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, fmt.Errorf("mqtt_mq: read ca error: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("mqtt_mq: no certificate found in ca '%s'", ca)
+		}
+		conf.RootCAs = pool
+	}
+
+	var cert, key = q.Get("cert"), q.Get("key")
+	switch {
+	case len(cert) > 0 && len(key) > 0:
+		reloader := &certReloader{CertFile: cert, KeyFile: key}
+		if _, err := reloader.load(); err != nil {
+			return nil, err
+		}
+		conf.GetClientCertificate = reloader.GetClientCertificate
+	case len(cert) > 0 || len(key) > 0:
+		return nil, errors.New("mqtt_mq: both cert and key are required for client certificate")
+	}
+
+	conf.ServerName = q.Get("server_name")
+	if v, _ := strconv.ParseBool(q.Get("insecure_skip_verify")); v {
+		conf.InsecureSkipVerify = true
+	}
+
+	return conf, nil
+}
+
+// hasTLSQuery 查询参数中是否包含 TLS 相关的配置
+func hasTLSQuery(q url.Values) bool {
+	for _, key := range []string{"ca", "cert", "key", "server_name", "insecure_skip_verify"} {
+		if _, ok := q[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// certReloader 每次握手时检查证书文件的修改时间，证书轮换后无需重启进程
+type certReloader struct {
+	CertFile string
+	KeyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func (r *certReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.load()
+}
+
+func (r *certReloader) load() (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTime, err := r.lastModified()
+	if err != nil {
+		if r.cert != nil {
+			log.Errorf("mqtt_mq: stat client certificate error %s, keep the loaded one", err)
+			return r.cert, nil
+		}
+		return nil, err
+	}
+
+	if r.cert != nil && !modTime.After(r.modTime) {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.CertFile, r.KeyFile)
+	if err != nil {
+		// 证书与私钥可能正在分别写入，继续使用之前的证书
+		if r.cert != nil {
+			log.Errorf("mqtt_mq: reload client certificate error %s, keep the loaded one", err)
+			return r.cert, nil
+		}
+		return nil, fmt.Errorf("mqtt_mq: load client certificate error: %w", err)
+	}
+
+	if r.cert != nil {
+		log.Infof("mqtt_mq: client certificate '%s' reloaded", r.CertFile)
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	return r.cert, nil
+}
+
+func (r *certReloader) lastModified() (time.Time, error) {
+	var modTime time.Time
+	for _, name := range []string{r.CertFile, r.KeyFile} {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return modTime, fmt.Errorf("mqtt_mq: stat '%s' error: %w", name, err)
+		}
+		if fi.ModTime().After(modTime) {
+			modTime = fi.ModTime()
+		}
+	}
+	return modTime, nil
+}
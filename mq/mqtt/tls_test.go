@@ -0,0 +1,305 @@
+package mqtt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/mq/mqtest"
+	"github.com/hysios/edgekv/mq/mqtt/broker"
+	mqttserver "github.com/mochi-co/mqtt/server"
+	"github.com/mochi-co/mqtt/server/listeners"
+	"github.com/mochi-co/mqtt/server/listeners/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "edgekv test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create ca error %s", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	ca := &testCA{cert: cert, key: key, dir: t.TempDir()}
+	ca.write(t, "ca.pem", "CERTIFICATE", der)
+	return ca
+}
+
+func (ca *testCA) write(t *testing.T, name, typ string, der []byte) string {
+	filename := filepath.Join(ca.dir, name)
+	b := pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+	if err := ioutil.WriteFile(filename, b, 0600); err != nil {
+		t.Fatalf("write %s error %s", name, err)
+	}
+	return filename
+}
+
+// issue 签发证书，返回证书与私钥的 PEM 文件路径
+func (ca *testCA) issue(t *testing.T, name string, serial int64, usage x509.ExtKeyUsage) (string, string) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("issue %s error %s", name, err)
+	}
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+
+	return ca.write(t, name+".pem", "CERTIFICATE", der), ca.write(t, name+".key", "EC PRIVATE KEY", keyDer)
+}
+
+func (ca *testCA) path(name string) string {
+	return filepath.Join(ca.dir, name)
+}
+
+// startTLSServer 启动只接受 TLS 连接的内嵌代理
+func startTLSServer(t *testing.T, ca *testCA, websocket bool) (string, func()) {
+	var (
+		addr          = freeAddr(t)
+		certFile, key = ca.issue(t, "server", 2, x509.ExtKeyUsageServerAuth)
+		certPEM, _    = ioutil.ReadFile(certFile)
+		keyPEM, _     = ioutil.ReadFile(key)
+		server        = mqttserver.New()
+		l             listeners.Listener
+	)
+
+	if websocket {
+		l = listeners.NewWebsocket("wss", addr)
+	} else {
+		l = listeners.NewTCP("tls", addr)
+	}
+
+	err := server.AddListener(l, &listeners.Config{
+		Auth: new(auth.Allow),
+		TLS:  &listeners.TLS{Certificate: certPEM, PrivateKey: keyPEM},
+	})
+	if err != nil {
+		t.Fatalf("add listener error %s", err)
+	}
+
+	if err = server.Serve(); err != nil {
+		t.Fatalf("serve error %s", err)
+	}
+	waitListen(t, addr)
+	return addr, func() { server.Close() }
+}
+
+// startMutualTLSProxy 在明文代理前面启动要求客户端证书的 TLS 代理
+func startMutualTLSProxy(t *testing.T, ca *testCA, upstream string) (string, func()) {
+	certFile, keyFile := ca.issue(t, "proxy", 3, x509.ExtKeyUsageServerAuth)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("load proxy cert error %s", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		t.Fatalf("listen error %s", err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				if err := conn.(*tls.Conn).Handshake(); err != nil {
+					return
+				}
+
+				up, err := net.Dial("tcp", upstream)
+				if err != nil {
+					return
+				}
+				defer up.Close()
+
+				go io.Copy(up, conn)
+				io.Copy(conn, up)
+			}()
+		}
+	}()
+
+	return l.Addr().String(), func() { l.Close() }
+}
+
+func waitListen(t *testing.T, addr string) {
+	for i := 0; i < 50; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("%s is not listening", addr)
+}
+
+func TestMqttMQ_TLS(t *testing.T) {
+	var (
+		ca         = newTestCA(t)
+		addr, stop = startTLSServer(t, ca, false)
+	)
+	defer stop()
+
+	mqtest.TestQueue(t, func() edgekv.MessageQueue {
+		mq, err := OpenMqttMQ("mqtts://" + addr + "/edgekv?ca=" + url.QueryEscape(ca.path("ca.pem")))
+		if err != nil {
+			t.Fatalf("open mqtt error %s", err)
+		}
+		return mq
+	})
+}
+
+func TestMqttMQ_Websocket(t *testing.T) {
+	var (
+		ca         = newTestCA(t)
+		addr, stop = startTLSServer(t, ca, true)
+	)
+	defer stop()
+
+	mq, err := OpenMqttMQ("wss://" + addr + "/edgekv?ca=" + url.QueryEscape(ca.path("ca.pem")))
+	if assert.NoError(t, err) {
+		mq.Close()
+	}
+}
+
+func TestMqttMQ_MutualTLS(t *testing.T) {
+	var (
+		ca       = newTestCA(t)
+		upstream = broker.NewBroker(freeAddr(t))
+	)
+	if err := upstream.Start(); err != nil {
+		t.Fatalf("start broker error %s", err)
+	}
+	defer upstream.Close()
+
+	addr, stop := startMutualTLSProxy(t, ca, upstream.Addr)
+	defer stop()
+
+	var (
+		certFile, keyFile = ca.issue(t, "edge1", 10, x509.ExtKeyUsageClientAuth)
+		q                 = url.Values{"ca": {ca.path("ca.pem")}, "cert": {certFile}, "key": {keyFile}}
+	)
+
+	mq, err := OpenMqttMQ("mqtts://" + addr + "/edgekv?" + q.Encode())
+	if assert.NoError(t, err) {
+		mq.Close()
+	}
+
+	// 没有客户端证书时代理拒绝连接
+	q = url.Values{"ca": {ca.path("ca.pem")}, "connect_retry": {"false"}, "timeout": {"2s"}}
+	_, err = OpenMqttMQ("mqtts://" + addr + "/edgekv?" + q.Encode())
+	assert.Error(t, err)
+}
+
+func TestCertReloader(t *testing.T) {
+	var (
+		ca                = newTestCA(t)
+		certFile, keyFile = ca.issue(t, "edge1", 10, x509.ExtKeyUsageClientAuth)
+		reloader          = &certReloader{CertFile: certFile, KeyFile: keyFile}
+	)
+
+	first, err := reloader.GetClientCertificate(nil)
+	assert.NoError(t, err)
+
+	same, _ := reloader.GetClientCertificate(nil)
+	assert.Same(t, first, same)
+
+	// 轮换证书后重新加载
+	ca.issue(t, "edge1", 11, x509.ExtKeyUsageClientAuth)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+
+	second, err := reloader.GetClientCertificate(nil)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.Certificate[0], second.Certificate[0])
+
+	// 写坏的证书不影响已加载的证书
+	ioutil.WriteFile(keyFile, []byte("broken"), 0600)
+	later = later.Add(time.Minute)
+	os.Chtimes(keyFile, later, later)
+
+	third, err := reloader.GetClientCertificate(nil)
+	assert.NoError(t, err)
+	assert.Same(t, second, third)
+}
+
+func TestParseURI_Scheme(t *testing.T) {
+	var tests = []struct {
+		uri     string
+		broker  string
+		wantErr bool
+	}{
+		{"mqtt://127.0.0.1:1883/edgekv", "tcp://127.0.0.1:1883", false},
+		{"mqtts://127.0.0.1:8883/edgekv", "ssl://127.0.0.1:8883", false},
+		{"ssl://127.0.0.1:8883/edgekv", "ssl://127.0.0.1:8883", false},
+		{"ws://127.0.0.1:8080/edgekv", "ws://127.0.0.1:8080/mqtt", false},
+		{"wss://127.0.0.1:443/edgekv?ws_path=/ws", "wss://127.0.0.1:443/ws", false},
+		{"http://127.0.0.1:1883/edgekv", "", true},
+		{"mqtt://127.0.0.1:1883/edgekv?ca=ca.pem", "", true},
+		{"mqtts://127.0.0.1:8883/edgekv?cert=edge.pem", "", true},
+	}
+
+	for _, tt := range tests {
+		var mq = &mqttMQ{}
+		opts, err := mq.ParseURI(tt.uri)
+		if tt.wantErr {
+			assert.Error(t, err, tt.uri)
+			continue
+		}
+
+		if assert.NoError(t, err, tt.uri) && assert.Len(t, opts.Servers, 1) {
+			assert.Equal(t, tt.broker, opts.Servers[0].String(), tt.uri)
+			assert.Equal(t, "edgekv", mq.Prefix)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package nats
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/codec"
+	"github.com/hysios/log"
+	"github.com/nats-io/nats.go"
+)
+
+// natsMQ 基于 NATS 的消息队列，开启 JetStream 后消息会持久化在流中，
+// 使用持久化的消费者 (durable) 订阅时，重启后可以继续收到离线期间的消息
+type natsMQ struct {
+	Prefix    string
+	JetStream bool
+	Stream    string
+	Durable   string
+	Deliver   string
+	AckWait   time.Duration
+	Codec     codec.Codec
+
+	conn *nats.Conn
+	js   nats.JetStreamContext
+}
+
+var (
+	DefaultStream  = "EDGEKV"
+	DefaultAckWait = 30 * time.Second
+)
+
+// OpenNatsMQ 打开消息队列, uri 例如
+//
+//	nats://127.0.0.1:4222/edgekv
+//	nats://127.0.0.1:4222/edgekv?jetstream=true&durable=center
+func OpenNatsMQ(uri string) (*natsMQ, error) {
+	var (
+		mq = &natsMQ{
+			Stream:  DefaultStream,
+			AckWait: DefaultAckWait,
+		}
+		opts []nats.Option
+		addr string
+		err  error
+	)
+
+	if addr, opts, err = mq.ParseURI(uri); err != nil {
+		return nil, err
+	}
+
+	if mq.conn, err = nats.Connect(addr, opts...); err != nil {
+		return nil, fmt.Errorf("nats_mq: connect error: %w", err)
+	}
+
+	if mq.JetStream {
+		if err = mq.initStream(); err != nil {
+			mq.conn.Close()
+			return nil, err
+		}
+	}
+
+	return mq, nil
+}
+
+func (mq *natsMQ) ParseURI(uri string) (string, []nats.Option, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", nil, fmt.Errorf("nats_mq: parse uri error: %w", err)
+	}
+
+	log.Infof("nats: open nats at %s", uri)
+	var opts []nats.Option
+	if pass, ok := u.User.Password(); ok {
+		opts = append(opts, nats.UserInfo(u.User.Username(), pass))
+	} else if len(u.User.Username()) > 0 {
+		opts = append(opts, nats.Token(u.User.Username()))
+	}
+
+	if len(u.Path) > 1 {
+		mq.Prefix = strings.TrimPrefix(u.Path, "/")
+	}
+
+	if opts, err = mq.parseQuery(opts, u.Query()); err != nil {
+		return "", nil, err
+	}
+
+	return fmt.Sprintf("nats://%s", u.Host), opts, nil
+}
+
+func (mq *natsMQ) parseQuery(opts []nats.Option, q url.Values) ([]nats.Option, error) {
+	for key := range q {
+		switch key {
+		case "jetstream":
+			v, err := strconv.ParseBool(q.Get(key))
+			if err != nil {
+				return nil, fmt.Errorf("nats_mq: invalid jetstream '%s'", q.Get(key))
+			}
+			mq.JetStream = v
+		case "stream":
+			mq.Stream = q.Get(key)
+		case "durable":
+			mq.Durable = q.Get(key)
+		case "deliver":
+			switch v := q.Get(key); v {
+			case "all", "new", "last":
+				mq.Deliver = v
+			default:
+				return nil, fmt.Errorf("nats_mq: invalid deliver policy '%s'", v)
+			}
+		case "ack_wait", "timeout", "reconnect_wait":
+			dt, err := time.ParseDuration(q.Get(key))
+			if err != nil || dt <= 0 {
+				return nil, fmt.Errorf("nats_mq: invalid %s '%s'", key, q.Get(key))
+			}
+
+			switch key {
+			case "ack_wait":
+				mq.AckWait = dt
+			case "timeout":
+				opts = append(opts, nats.Timeout(dt))
+			default:
+				opts = append(opts, nats.ReconnectWait(dt))
+			}
+		case "client_id":
+			opts = append(opts, nats.Name(q.Get(key)))
+		case "max_reconnects":
+			// 负数表示无限重连
+			n, err := strconv.Atoi(q.Get(key))
+			if err != nil {
+				return nil, fmt.Errorf("nats_mq: invalid max_reconnects '%s'", q.Get(key))
+			}
+			opts = append(opts, nats.MaxReconnects(n))
+		}
+	}
+
+	var err error
+	if mq.Codec, err = codec.Get(q.Get("codec")); err != nil {
+		return nil, fmt.Errorf("nats_mq: %w", err)
+	}
+
+	if mq.JetStream && len(mq.Prefix) == 0 {
+		return nil, errors.New("nats_mq: jetstream mode requires a topic prefix")
+	}
+
+	return opts, nil
+}
+
+// initStream 确保前缀下所有的主题都保存在流中，多个前缀共用一个流时把主题加入已有的流
+func (mq *natsMQ) initStream() error {
+	js, err := mq.conn.JetStream()
+	if err != nil {
+		return fmt.Errorf("nats_mq: jetstream error: %w", err)
+	}
+	mq.js = js
+
+	var (
+		subject = Subject(mq.Prefix) + ".>"
+		info    *nats.StreamInfo
+	)
+	if info, err = js.StreamInfo(mq.Stream); err == nil {
+		for _, s := range info.Config.Subjects {
+			if s == subject {
+				return nil
+			}
+		}
+
+		log.Infof("nats: add subjects '%s' to stream %s", subject, mq.Stream)
+		config := info.Config
+		config.Subjects = append(config.Subjects, subject)
+		if _, err = js.UpdateStream(&config); err != nil {
+			return fmt.Errorf("nats_mq: update stream error: %w", err)
+		}
+		return nil
+	} else if !errors.Is(err, nats.ErrStreamNotFound) {
+		return fmt.Errorf("nats_mq: stream info error: %w", err)
+	}
+
+	log.Infof("nats: create stream %s for subjects '%s'", mq.Stream, subject)
+	if _, err = js.AddStream(&nats.StreamConfig{
+		Name:     mq.Stream,
+		Subjects: []string{subject},
+		Storage:  nats.FileStorage,
+	}); err != nil {
+		return fmt.Errorf("nats_mq: add stream error: %w", err)
+	}
+
+	return nil
+}
+
+// Subject 把 MQTT 风格的主题转换成 NATS 的主题, / 转换为 ., 通配符 + 与 # 转换为 * 与 >
+func Subject(topic string) string {
+	var ss = strings.Split(strings.Trim(topic, "/"), "/")
+	for i, s := range ss {
+		switch s {
+		case "+":
+			ss[i] = "*"
+		case "#":
+			ss[i] = ">"
+		}
+	}
+	return strings.Join(ss, ".")
+}
+
+// relTopic 把 NATS 的主题转换回去掉前缀的 MQTT 风格主题
+func (mq *natsMQ) relTopic(subject string) string {
+	var topic = strings.ReplaceAll(subject, ".", "/")
+	return strings.TrimPrefix(strings.TrimPrefix(topic, mq.Prefix), "/")
+}
+
+func (mq *natsMQ) FullTopic(_topic string) string {
+	return path.Join(mq.Prefix, _topic)
+}
+
+func (mq *natsMQ) Publish(topic string, msg edgekv.Message) error {
+	b, err := mq.Codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	subject := Subject(mq.FullTopic(topic))
+	log.Debugf("nats: publish to subject %s", subject)
+	if mq.JetStream {
+		_, err = mq.js.Publish(subject, b)
+		return err
+	}
+
+	return mq.conn.Publish(subject, b)
+}
+
+func (mq *natsMQ) Subscribe(topic string, fn func(msg edgekv.Message) error) error {
+	var (
+		subject = Subject(mq.FullTopic(topic))
+		err     error
+	)
+
+	log.Infof("nats: subscribe subject '%s'", subject)
+	if !mq.JetStream {
+		if _, err = mq.conn.Subscribe(subject, func(rawmsg *nats.Msg) {
+			mq.handle(rawmsg, fn)
+		}); err != nil {
+			return err
+		}
+		// 等待服务器确认订阅，之后其他连接发布的消息都会投递
+		return mq.conn.Flush()
+	}
+
+	var opts = []nats.SubOpt{nats.ManualAck(), nats.AckWait(mq.AckWait)}
+	if len(mq.Durable) > 0 {
+		opts = append(opts, nats.Durable(mq.durableName(subject)))
+	}
+
+	switch mq.deliver() {
+	case "all":
+		opts = append(opts, nats.DeliverAll())
+	case "last":
+		opts = append(opts, nats.DeliverLast())
+	default:
+		opts = append(opts, nats.DeliverNew())
+	}
+
+	_, err = mq.js.Subscribe(subject, func(rawmsg *nats.Msg) {
+		// 处理成功才确认，失败时由服务器重新投递
+		if err := mq.handle(rawmsg, fn); err != nil {
+			rawmsg.Nak()
+			return
+		}
+		rawmsg.Ack()
+	}, opts...)
+	return err
+}
+
+// deliver 持久化的消费者默认从头开始投递，重启后由服务器从上次确认的位置继续
+func (mq *natsMQ) deliver() string {
+	if len(mq.Deliver) > 0 {
+		return mq.Deliver
+	}
+
+	if len(mq.Durable) > 0 {
+		return "all"
+	}
+	return "new"
+}
+
+// durableName 每个主题一个持久化的消费者, 名称中不能包含 . * >
+func (mq *natsMQ) durableName(subject string) string {
+	var name = mq.Durable + "_" + subject
+	return strings.NewReplacer(".", "_", "*", "any", ">", "all").Replace(name)
+}
+
+func (mq *natsMQ) handle(rawmsg *nats.Msg, fn func(msg edgekv.Message) error) error {
+	var msg edgekv.Message
+	if err := mq.Codec.Unmarshal(rawmsg.Data, &msg); err != nil {
+		log.Errorf("nats: unmarshal message error %s", err)
+		// 无法解码的消息重新投递也没有意义
+		return nil
+	}
+
+	msg.Topic = mq.relTopic(rawmsg.Subject)
+	return fn(msg)
+}
+
+func (mq *natsMQ) Close() error {
+	// 直接关闭连接而不是取消订阅，保留服务器上持久化的消费者
+	mq.conn.Close()
+	return nil
+}
+
+func init() {
+	edgekv.RegisterQueue("nats", func(args ...string) (edgekv.MessageQueue, error) {
+		if len(args) < 1 {
+			return nil, errors.New("nats_mq: missing open uri")
+		}
+		return OpenNatsMQ(args[0])
+	})
+}
+
+var _ edgekv.MessageQueue = &natsMQ{}
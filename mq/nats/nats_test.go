@@ -0,0 +1,162 @@
+package nats
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/mq/mqtest"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func runServer(t *testing.T) (*server.Server, func()) {
+	dir, err := ioutil.TempDir("", "edgekv-nats")
+	if err != nil {
+		t.Fatalf("create temp dir error %s", err)
+	}
+
+	s, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  dir,
+	})
+	if err != nil {
+		t.Fatalf("new nats server error %s", err)
+	}
+
+	go s.Start()
+	if !s.ReadyForConnections(3 * time.Second) {
+		t.Fatalf("nats server not ready")
+	}
+
+	return s, func() {
+		s.Shutdown()
+		os.RemoveAll(dir)
+	}
+}
+
+func open(t *testing.T, uri string) edgekv.MessageQueue {
+	mq, err := OpenNatsMQ(uri)
+	if err != nil {
+		t.Fatalf("open nats error %s", err)
+	}
+	return mq
+}
+
+func TestNatsMQ(t *testing.T) {
+	s, shutdown := runServer(t)
+	defer shutdown()
+
+	mqtest.TestQueue(t, func() edgekv.MessageQueue {
+		return open(t, s.ClientURL()+"/edgekv")
+	})
+}
+
+func TestNatsMQ_JetStream(t *testing.T) {
+	s, shutdown := runServer(t)
+	defer shutdown()
+
+	mqtest.TestQueue(t, func() edgekv.MessageQueue {
+		return open(t, s.ClientURL()+"/edgekv?jetstream=true")
+	})
+}
+
+func TestNatsMQ_Replay(t *testing.T) {
+	s, shutdown := runServer(t)
+	defer shutdown()
+
+	var (
+		uri = s.ClientURL() + "/edgekv?jetstream=true&durable=center&ack_wait=100ms"
+		pub = open(t, uri)
+		ch  = make(chan string, 10)
+	)
+	defer pub.Close()
+
+	var subscribe = func(fail bool) edgekv.MessageQueue {
+		sub := open(t, uri)
+		err := sub.Subscribe("sync", func(msg edgekv.Message) error {
+			ch <- msg.Payload.(*edgekv.MessageChangelog).Key
+			if fail {
+				return errors.New("not ready")
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		return sub
+	}
+
+	var receive = func() string {
+		select {
+		case key := <-ch:
+			return key
+		case <-time.After(3 * time.Second):
+			t.Fatalf("wait message timeout")
+			return ""
+		}
+	}
+
+	// 订阅者第一次上线，确认第一条消息后下线
+	sub := subscribe(false)
+	pub.Publish("sync", edgekv.Message{Type: edgekv.CmdChangelog, Payload: edgekv.MessageChangelog{Key: "k1"}})
+	assert.Equal(t, receive(), "k1")
+	time.Sleep(100 * time.Millisecond)
+	sub.Close()
+
+	// 离线期间发布的消息在重新上线后补发
+	pub.Publish("sync", edgekv.Message{Type: edgekv.CmdChangelog, Payload: edgekv.MessageChangelog{Key: "k2"}})
+
+	// 处理失败的消息不会被确认，会重新投递
+	sub = subscribe(true)
+	assert.Equal(t, receive(), "k2")
+	assert.Equal(t, receive(), "k2")
+	sub.Close()
+
+	sub = subscribe(false)
+	defer sub.Close()
+	assert.Equal(t, receive(), "k2")
+}
+
+func TestNatsMQ_SharedStream(t *testing.T) {
+	s, shutdown := runServer(t)
+	defer shutdown()
+
+	// 两个前缀使用默认的流
+	a := open(t, s.ClientURL()+"/edgekv?jetstream=true")
+	defer a.Close()
+	b := open(t, s.ClientURL()+"/other?jetstream=true")
+	defer b.Close()
+
+	var ch = make(chan string, 1)
+	assert.NoError(t, b.Subscribe("sync", func(msg edgekv.Message) error {
+		ch <- msg.Payload.(*edgekv.MessageChangelog).Key
+		return nil
+	}))
+	assert.NoError(t, a.Publish("sync", edgekv.Message{Type: edgekv.CmdChangelog, Payload: edgekv.MessageChangelog{Key: "a"}}))
+	assert.NoError(t, b.Publish("sync", edgekv.Message{Type: edgekv.CmdChangelog, Payload: edgekv.MessageChangelog{Key: "b"}}))
+
+	select {
+	case key := <-ch:
+		assert.Equal(t, "b", key)
+	case <-time.After(3 * time.Second):
+		t.Fatalf("wait message timeout")
+	}
+}
+
+func TestParseURI_Invalid(t *testing.T) {
+	for _, query := range []string{"ack_wait=soon", "timeout=-1s", "reconnect_wait=", "max_reconnects=x", "jetstream=maybe"} {
+		_, _, err := new(natsMQ).ParseURI("nats://127.0.0.1:4222/edgekv?" + query)
+		assert.Error(t, err, query)
+	}
+}
+
+func TestSubject(t *testing.T) {
+	assert.Equal(t, Subject("edgekv/sync"), "edgekv.sync")
+	assert.Equal(t, Subject("edgekv/+/sync"), "edgekv.*.sync")
+	assert.Equal(t, Subject("edgekv/#"), "edgekv.>")
+	assert.Equal(t, Subject("edgekv/E2E:sync"), "edgekv.E2E:sync")
+}
@@ -0,0 +1,532 @@
+// Package redisstream 基于 Redis Streams 的消息队列，适合已经部署了 redis 的场景。
+//
+// 每个主题对应一个 stream, 订阅者通过消费组 (consumer group) 读取消息,
+// 没有指定 group 时每个客户端使用独立的消费组，与 MQTT 一样所有订阅者都会收到消息,
+// 指定相同 group 的客户端共享同一个消费组，每条消息只由其中一个消费者处理。
+// 处理函数返回 nil 时确认 (XACK), 返回错误时消息保留在待处理列表中,
+// 超过 ClaimIdle 仍未确认的消息会被同组的消费者认领 (XCLAIM) 并重新处理,
+// 因此崩溃的消费者未确认的消息不会丢失。
+package redisstream
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/codec"
+	"github.com/hysios/log"
+)
+
+var (
+	// DefaultMaxLen 每个 stream 大约保留的消息条数
+	DefaultMaxLen int64 = 100000
+	// DefaultBlock 每次读取时阻塞等待的最长时间
+	DefaultBlock = time.Second
+	// DefaultClaimIdle 待处理的消息超过这个时间仍未确认时被重新认领
+	DefaultClaimIdle = 30 * time.Second
+	// DefaultScanInterval 通配符订阅发现新 stream 的间隔
+	DefaultScanInterval = time.Second
+	// DefaultMaxDeliver 一条消息最多投递的次数，超过后确认并丢弃
+	DefaultMaxDeliver int64 = 10
+)
+
+var ErrClosed = errors.New("redisstream_mq: queue closed")
+
+const field = "msg"
+
+type streamMQ struct {
+	Prefix       string
+	Group        string
+	Consumer     string
+	MaxLen       int64
+	Block        time.Duration
+	ClaimIdle    time.Duration
+	ScanInterval time.Duration
+	MaxDeliver   int64
+	Codec        codec.Codec
+
+	// ephemeral 没有指定消费组时为每个客户端生成独立的消费组，关闭时删除
+	ephemeral bool
+
+	rdb    *redis.Client
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	subs   []*subscription
+	once   sync.Once
+}
+
+type subscription struct {
+	mq       *streamMQ
+	group    string
+	filter   string
+	wildcard bool
+	fn       func(msg edgekv.Message) error
+
+	mu      sync.Mutex
+	streams []string
+	known   map[string]bool
+}
+
+// OpenStreamMQ 打开消息队列, uri 例如
+//
+//	redisstream://127.0.0.1:6379/edgekv
+//	redisstream://:password@127.0.0.1:6379/edgekv?db=2&group=center&consumer=center-1
+func OpenStreamMQ(uri string) (*streamMQ, error) {
+	var (
+		mq = &streamMQ{
+			MaxLen:       DefaultMaxLen,
+			Block:        DefaultBlock,
+			ClaimIdle:    DefaultClaimIdle,
+			ScanInterval: DefaultScanInterval,
+			MaxDeliver:   DefaultMaxDeliver,
+		}
+		opts *redis.Options
+		err  error
+	)
+
+	if opts, err = mq.ParseURI(uri); err != nil {
+		return nil, err
+	}
+
+	if len(mq.Group) == 0 {
+		mq.Group = "edgekv-" + randomID()
+		mq.ephemeral = true
+	}
+
+	if len(mq.Consumer) == 0 {
+		host, _ := os.Hostname()
+		mq.Consumer = fmt.Sprintf("%s-%d-%s", host, os.Getpid(), randomID())
+	}
+
+	mq.rdb = redis.NewClient(opts)
+	mq.ctx, mq.cancel = context.WithCancel(context.Background())
+	if err = mq.rdb.Ping(mq.ctx).Err(); err != nil {
+		mq.rdb.Close()
+		return nil, fmt.Errorf("redisstream_mq: connect error: %w", err)
+	}
+
+	return mq, nil
+}
+
+func (mq *streamMQ) ParseURI(uri string) (*redis.Options, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("redisstream_mq: parse uri error: %w", err)
+	}
+
+	log.Infof("redisstream: open redis streams at %s", u.Host)
+	var opts = &redis.Options{Addr: u.Host}
+	if pass, ok := u.User.Password(); ok {
+		opts.Password = pass
+	}
+
+	if len(u.Path) > 1 {
+		mq.Prefix = strings.TrimPrefix(u.Path, "/")
+	}
+
+	if err = mq.parseQuery(opts, u.Query()); err != nil {
+		return nil, err
+	}
+
+	return opts, nil
+}
+
+func (mq *streamMQ) parseQuery(opts *redis.Options, q url.Values) error {
+	var durations = map[string]*time.Duration{
+		"block":         &mq.Block,
+		"claim_idle":    &mq.ClaimIdle,
+		"scan_interval": &mq.ScanInterval,
+	}
+
+	var err error
+	if mq.Codec, err = codec.Get(q.Get("codec")); err != nil {
+		return fmt.Errorf("redisstream_mq: %w", err)
+	}
+
+	for key := range q {
+		switch key {
+		case "db":
+			db, err := strconv.Atoi(q.Get(key))
+			if err != nil {
+				return fmt.Errorf("redisstream_mq: invalid db '%s'", q.Get(key))
+			}
+			opts.DB = db
+		case "group":
+			mq.Group = q.Get(key)
+		case "consumer":
+			mq.Consumer = q.Get(key)
+		case "maxlen":
+			n, err := strconv.ParseInt(q.Get(key), 10, 64)
+			if err != nil {
+				return fmt.Errorf("redisstream_mq: invalid maxlen '%s'", q.Get(key))
+			}
+			mq.MaxLen = n
+		case "max_deliver":
+			n, err := strconv.ParseInt(q.Get(key), 10, 64)
+			if err != nil {
+				return fmt.Errorf("redisstream_mq: invalid max_deliver '%s'", q.Get(key))
+			}
+			mq.MaxDeliver = n
+		case "block", "claim_idle", "scan_interval":
+			dt, err := time.ParseDuration(q.Get(key))
+			if err != nil || dt <= 0 {
+				return fmt.Errorf("redisstream_mq: invalid %s '%s'", key, q.Get(key))
+			}
+			*durations[key] = dt
+		}
+	}
+
+	return nil
+}
+
+func (mq *streamMQ) FullTopic(_topic string) string {
+	return path.Join(mq.Prefix, _topic)
+}
+
+func (mq *streamMQ) Publish(topic string, msg edgekv.Message) error {
+	if mq.ctx.Err() != nil {
+		return ErrClosed
+	}
+
+	b, err := mq.Codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	stream := mq.FullTopic(topic)
+	log.Debugf("redisstream: publish to stream %s", stream)
+	return mq.rdb.XAdd(mq.ctx, &redis.XAddArgs{
+		Stream:       stream,
+		MaxLenApprox: mq.MaxLen,
+		Values:       map[string]interface{}{field: b},
+	}).Err()
+}
+
+func (mq *streamMQ) Subscribe(topic string, fn func(msg edgekv.Message) error) error {
+	if mq.ctx.Err() != nil {
+		return ErrClosed
+	}
+
+	var sub = &subscription{
+		mq:       mq,
+		group:    mq.groupName(topic),
+		filter:   mq.FullTopic(topic),
+		wildcard: edgekv.IsWildcardTopic(topic),
+		fn:       fn,
+		known:    make(map[string]bool),
+	}
+
+	// 订阅时已存在的 stream 只接收之后的新消息
+	if sub.wildcard {
+		if err := sub.scan("$"); err != nil {
+			return err
+		}
+	} else if err := sub.add(sub.filter, "$"); err != nil {
+		return err
+	}
+
+	log.Infof("redisstream: subscribe topic '%s' with group %s", sub.filter, sub.group)
+	mq.mu.Lock()
+	mq.subs = append(mq.subs, sub)
+	mq.mu.Unlock()
+
+	mq.wg.Add(1)
+	go sub.run()
+	return nil
+}
+
+// groupName 每个订阅过滤器一个消费组，同一客户端中重叠的订阅各自都能收到消息，
+// 不同客户端使用相同的 group 与过滤器时共享消息
+func (mq *streamMQ) groupName(topic string) string {
+	return mq.Group + ":" + topic
+}
+
+func (mq *streamMQ) Close() error {
+	mq.once.Do(func() {
+		mq.cancel()
+
+		// 临时的消费组只属于这个客户端，关闭后删除避免在 redis 中堆积
+		if mq.ephemeral {
+			var ctx = context.Background()
+			mq.mu.Lock()
+			for _, sub := range mq.subs {
+				for _, stream := range sub.list() {
+					mq.rdb.XGroupDestroy(ctx, stream, sub.group)
+				}
+			}
+			mq.mu.Unlock()
+		}
+
+		// 关闭连接以中断正在阻塞的读取
+		mq.rdb.Close()
+		mq.wg.Wait()
+	})
+	return nil
+}
+
+// add 确保 stream 上存在消费组, start 为 $ 时只接收新消息, 为 0 时从头开始
+func (sub *subscription) add(stream, start string) error {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if sub.known[stream] {
+		return nil
+	}
+
+	err := sub.mq.rdb.XGroupCreateMkStream(sub.mq.ctx, stream, sub.group, start).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("redisstream_mq: create group on '%s' error: %w", stream, err)
+	}
+
+	sub.known[stream] = true
+	sub.streams = append(sub.streams, stream)
+	return nil
+}
+
+func (sub *subscription) list() []string {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	var streams = make([]string, len(sub.streams))
+	copy(streams, sub.streams)
+	return streams
+}
+
+// scan 查找匹配通配符订阅的 stream
+func (sub *subscription) scan(start string) error {
+	var (
+		ctx  = sub.mq.ctx
+		iter = sub.mq.rdb.Scan(ctx, 0, Glob(sub.filter), 0).Iterator()
+	)
+
+	for iter.Next(ctx) {
+		key := iter.Val()
+		if !edgekv.MatchTopic(sub.filter, key) {
+			continue
+		}
+
+		typ, err := sub.mq.rdb.Type(ctx, key).Result()
+		if err != nil || typ != "stream" {
+			continue
+		}
+
+		if err = sub.add(key, start); err != nil {
+			return err
+		}
+	}
+
+	return iter.Err()
+}
+
+// Glob 把 MQTT 风格的订阅过滤器转换为 redis SCAN 使用的模式，匹配结果需要再用 MatchTopic 过滤
+func Glob(filter string) string {
+	var ss = strings.Split(filter, "/")
+	for i, s := range ss {
+		switch s {
+		case "+":
+			ss[i] = "*"
+		case "#":
+			// a/# 同时匹配 a 本身
+			return strings.TrimSuffix(strings.Join(ss[:i], "/"), "/") + "*"
+		default:
+			ss[i] = globEscaper.Replace(s)
+		}
+	}
+	return strings.Join(ss, "/")
+}
+
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+func (sub *subscription) run() {
+	defer sub.mq.wg.Done()
+
+	var (
+		ctx       = sub.mq.ctx
+		lastScan  = time.Now()
+		lastClaim = time.Now()
+	)
+
+	for ctx.Err() == nil {
+		// 订阅之后才出现的 stream 里的消息都是新消息，从头开始读取
+		if sub.wildcard && time.Since(lastScan) >= sub.mq.ScanInterval {
+			if err := sub.scan("0"); err != nil && ctx.Err() == nil {
+				log.Errorf("redisstream: scan streams for '%s' error %s", sub.filter, err)
+			}
+			lastScan = time.Now()
+		}
+
+		if time.Since(lastClaim) >= sub.mq.ClaimIdle/2 {
+			sub.reclaim()
+			lastClaim = time.Now()
+		}
+
+		sub.read()
+	}
+}
+
+func (sub *subscription) read() {
+	var (
+		ctx     = sub.mq.ctx
+		streams = sub.list()
+	)
+
+	if len(streams) == 0 {
+		select {
+		case <-time.After(sub.mq.ScanInterval):
+		case <-ctx.Done():
+		}
+		return
+	}
+
+	var args = make([]string, 0, len(streams)*2)
+	args = append(args, streams...)
+	for range streams {
+		args = append(args, ">")
+	}
+
+	res, err := sub.mq.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    sub.group,
+		Consumer: sub.mq.Consumer,
+		Streams:  args,
+		Count:    100,
+		Block:    sub.mq.Block,
+	}).Result()
+
+	switch {
+	case ctx.Err() != nil, err == redis.Nil:
+		return
+	case err != nil:
+		log.Errorf("redisstream: read group error %s", err)
+		select {
+		case <-time.After(sub.mq.Block):
+		case <-ctx.Done():
+		}
+		return
+	}
+
+	for _, stream := range res {
+		for _, rawmsg := range stream.Messages {
+			if ctx.Err() != nil {
+				return
+			}
+			sub.handle(stream.Stream, rawmsg)
+		}
+	}
+}
+
+// reclaim 认领同组中超过 ClaimIdle 仍未确认的消息，包括自己处理失败的消息
+func (sub *subscription) reclaim() {
+	var ctx = sub.mq.ctx
+
+	for _, stream := range sub.list() {
+		pending, err := sub.mq.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: stream,
+			Group:  sub.group,
+			Start:  "-",
+			End:    "+",
+			Count:  100,
+		}).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Errorf("redisstream: pending of '%s' error %s", stream, err)
+			}
+			continue
+		}
+
+		var ids []string
+		for _, p := range pending {
+			if p.Idle < sub.mq.ClaimIdle {
+				continue
+			}
+
+			if sub.mq.MaxDeliver > 0 && p.RetryCount >= sub.mq.MaxDeliver {
+				log.Errorf("redisstream: give up message %s on '%s' after %d deliveries", p.ID, stream, p.RetryCount)
+				sub.mq.rdb.XAck(ctx, stream, sub.group, p.ID)
+				continue
+			}
+			ids = append(ids, p.ID)
+		}
+
+		if len(ids) == 0 {
+			continue
+		}
+
+		msgs, err := sub.mq.rdb.XClaim(ctx, &redis.XClaimArgs{
+			Stream:   stream,
+			Group:    sub.group,
+			Consumer: sub.mq.Consumer,
+			MinIdle:  sub.mq.ClaimIdle,
+			Messages: ids,
+		}).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Errorf("redisstream: claim messages of '%s' error %s", stream, err)
+			}
+			continue
+		}
+
+		for _, rawmsg := range msgs {
+			if ctx.Err() != nil {
+				return
+			}
+			sub.handle(stream, rawmsg)
+		}
+	}
+}
+
+func (sub *subscription) handle(stream string, rawmsg redis.XMessage) {
+	var (
+		ctx    = sub.mq.ctx
+		msg    edgekv.Message
+		raw, _ = rawmsg.Values[field].(string)
+	)
+
+	if err := sub.mq.Codec.Unmarshal([]byte(raw), &msg); err != nil {
+		log.Errorf("redisstream: unmarshal message %s error %s", rawmsg.ID, err)
+		// 无法解码的消息重新投递也没有意义
+		sub.mq.rdb.XAck(ctx, stream, sub.group, rawmsg.ID)
+		return
+	}
+
+	msg.Topic = strings.TrimPrefix(strings.TrimPrefix(stream, sub.mq.Prefix), "/")
+
+	// 处理失败时不确认，消息留在待处理列表中等待重新认领
+	if err := sub.fn(msg); err != nil {
+		log.Debugf("redisstream: handle message %s on '%s' error %s", rawmsg.ID, stream, err)
+		return
+	}
+
+	if err := sub.mq.rdb.XAck(ctx, stream, sub.group, rawmsg.ID).Err(); err != nil && ctx.Err() == nil {
+		log.Errorf("redisstream: ack message %s error %s", rawmsg.ID, err)
+	}
+}
+
+func randomID() string {
+	var b [6]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func init() {
+	edgekv.RegisterQueue("redisstream", func(args ...string) (edgekv.MessageQueue, error) {
+		if len(args) < 1 {
+			return nil, errors.New("redisstream_mq: missing open uri")
+		}
+		return OpenStreamMQ(args[0])
+	})
+}
+
+var _ edgekv.MessageQueue = &streamMQ{}
@@ -0,0 +1,150 @@
+package redisstream
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/mq/mqtest"
+	"github.com/stretchr/testify/assert"
+)
+
+const testURI = "redisstream://127.0.0.1:6379/streamtest?db=5&block=100ms&scan_interval=100ms"
+
+func openTest(t *testing.T, query string) *streamMQ {
+	mq, err := OpenStreamMQ(testURI + query)
+	if err != nil {
+		t.Skipf("redis is not available: %s", err)
+	}
+	return mq
+}
+
+func testMessage(from string) edgekv.Message {
+	return edgekv.Message{
+		From:    from,
+		Type:    edgekv.CmdChangelog,
+		Payload: edgekv.MessageChangelog{Key: "test.on"},
+	}
+}
+
+func TestStreamMQ_Conformance(t *testing.T) {
+	openTest(t, "").Close()
+
+	mqtest.TestQueue(t, func() edgekv.MessageQueue {
+		return openTest(t, "")
+	})
+}
+
+func TestStreamMQ_Redeliver(t *testing.T) {
+	var (
+		pub   = openTest(t, "")
+		sub   = openTest(t, "&claim_idle=200ms")
+		topic = fmt.Sprintf("redeliver/%d", time.Now().UnixNano())
+		count int32
+		done  = make(chan struct{})
+	)
+	defer pub.Close()
+	defer sub.Close()
+
+	assert.NoError(t, sub.Subscribe(topic, func(msg edgekv.Message) error {
+		if atomic.AddInt32(&count, 1) == 1 {
+			return errors.New("first delivery failed")
+		}
+		close(done)
+		return nil
+	}))
+	assert.NoError(t, pub.Publish(topic, testMessage("A")))
+
+	select {
+	case <-done:
+	case <-time.After(mqtest.Timeout):
+		t.Fatalf("message is not redelivered")
+	}
+}
+
+func TestStreamMQ_Reclaim(t *testing.T) {
+	var (
+		group = fmt.Sprintf("&group=reclaim-%d&claim_idle=200ms", time.Now().UnixNano())
+		pub   = openTest(t, "")
+		a     = openTest(t, group+"&consumer=a")
+		topic = fmt.Sprintf("reclaim/%d", time.Now().UnixNano())
+		got   = make(chan edgekv.Message, 1)
+	)
+	defer pub.Close()
+
+	// a 收到消息后没有确认就退出，模拟崩溃的消费者
+	var received = make(chan struct{}, 1)
+	assert.NoError(t, a.Subscribe(topic, func(msg edgekv.Message) error {
+		received <- struct{}{}
+		return errors.New("crash")
+	}))
+	assert.NoError(t, pub.Publish(topic, testMessage("A")))
+
+	select {
+	case <-received:
+	case <-time.After(mqtest.Timeout):
+		t.Fatalf("consumer a did not receive message")
+	}
+	a.Close()
+
+	b := openTest(t, group+"&consumer=b")
+	defer b.Close()
+	assert.NoError(t, b.Subscribe(topic, func(msg edgekv.Message) error {
+		got <- msg
+		return nil
+	}))
+
+	select {
+	case msg := <-got:
+		assert.Equal(t, msg.From, "A")
+	case <-time.After(mqtest.Timeout):
+		t.Fatalf("pending message is not reclaimed")
+	}
+}
+
+func TestStreamMQ_SharedGroup(t *testing.T) {
+	var (
+		group = fmt.Sprintf("&group=shared-%d", time.Now().UnixNano())
+		pub   = openTest(t, "")
+		subs  = []*streamMQ{openTest(t, group+"&consumer=a"), openTest(t, group+"&consumer=b")}
+		topic = fmt.Sprintf("shared/%d", time.Now().UnixNano())
+		count int32
+	)
+	defer pub.Close()
+
+	for _, sub := range subs {
+		defer sub.Close()
+		assert.NoError(t, sub.Subscribe(topic, func(msg edgekv.Message) error {
+			atomic.AddInt32(&count, 1)
+			return nil
+		}))
+	}
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, pub.Publish(topic, testMessage("A")))
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	// 同一消费组中的消息只投递给其中一个消费者
+	assert.Equal(t, int32(10), atomic.LoadInt32(&count))
+}
+
+func TestGlob(t *testing.T) {
+	var tests = []struct {
+		filter string
+		want   string
+	}{
+		{"edgekv/sync", "edgekv/sync"},
+		{"edgekv/+/sync", "edgekv/*/sync"},
+		{"edgekv/#", "edgekv*"},
+		{"#", "*"},
+		{"edgekv/a*b", `edgekv/a\*b`},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Glob(tt.filter), tt.filter)
+	}
+}
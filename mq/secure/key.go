@@ -0,0 +1,152 @@
+package secure
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// CenterOwner Center 密钥的所有者，边缘节点密钥的所有者为节点的 EdgeID
+const CenterOwner = "center"
+
+// PublicKey 密钥对的公开部分，Sign 用于验证签名, Box 用于加密发给所有者的消息
+type PublicKey struct {
+	ID      string    `json:"id"`
+	Owner   string    `json:"owner"`
+	Sign    []byte    `json:"sign"`
+	Box     []byte    `json:"box"`
+	Created time.Time `json:"created"`
+	Revoked bool      `json:"revoked,omitempty"`
+}
+
+// PrivateKey 所有者保存的密钥对，不应离开所有者所在的节点
+type PrivateKey struct {
+	PublicKey
+	SignKey []byte `json:"signKey"`
+	BoxKey  []byte `json:"boxKey"`
+}
+
+// GenerateKey 为 owner 生成新的 ed25519 签名密钥与 X25519 加密密钥
+func GenerateKey(owner string) (*PrivateKey, error) {
+	signPub, signKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("secure: generate sign key error: %w", err)
+	}
+
+	boxPub, boxKey, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("secure: generate box key error: %w", err)
+	}
+
+	return &PrivateKey{
+		PublicKey: PublicKey{
+			ID:      keyID(signPub, boxPub[:]),
+			Owner:   owner,
+			Sign:    signPub,
+			Box:     boxPub[:],
+			Created: time.Now(),
+		},
+		SignKey: signKey,
+		BoxKey:  boxKey[:],
+	}, nil
+}
+
+// LoadKey 读取 Save 保存的密钥对
+func LoadKey(filename string) (*PrivateKey, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("secure: read key error: %w", err)
+	}
+
+	var key PrivateKey
+	if err = json.Unmarshal(b, &key); err != nil {
+		return nil, fmt.Errorf("secure: decode key error: %w", err)
+	}
+
+	if err = key.validate(); err != nil {
+		return nil, err
+	}
+
+	if len(key.SignKey) != ed25519.PrivateKeySize || len(key.BoxKey) != 32 {
+		return nil, fmt.Errorf("secure: invalid private key '%s'", key.ID)
+	}
+	return &key, nil
+}
+
+// Save 把密钥对保存到 filename, 文件只有所有者可读
+func (key *PrivateKey) Save(filename string) error {
+	b, err := json.MarshalIndent(key, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = ioutil.WriteFile(filename, b, 0600); err != nil {
+		return fmt.Errorf("secure: write key error: %w", err)
+	}
+	return nil
+}
+
+// Public 返回密钥对的公开部分，用于注册到对方的 Registry
+func (key *PrivateKey) Public() PublicKey {
+	return key.PublicKey
+}
+
+func (key *PrivateKey) sign(b []byte) []byte {
+	return ed25519.Sign(ed25519.PrivateKey(key.SignKey), b)
+}
+
+func (key *PrivateKey) open(b []byte) ([]byte, bool) {
+	var pub, priv [32]byte
+	copy(pub[:], key.Box)
+	copy(priv[:], key.BoxKey)
+	return box.OpenAnonymous(nil, b, &pub, &priv)
+}
+
+func (pub *PublicKey) verify(b, sig []byte) bool {
+	return ed25519.Verify(ed25519.PublicKey(pub.Sign), b, sig)
+}
+
+func (pub *PublicKey) seal(b []byte) ([]byte, error) {
+	var key [32]byte
+	copy(key[:], pub.Box)
+	return box.SealAnonymous(nil, b, &key, rand.Reader)
+}
+
+func (pub *PublicKey) validate() error {
+	if len(pub.Owner) == 0 {
+		return fmt.Errorf("secure: key '%s' missing owner", pub.ID)
+	}
+
+	if len(pub.Sign) != ed25519.PublicKeySize || len(pub.Box) != 32 {
+		return fmt.Errorf("secure: invalid public key '%s'", pub.ID)
+	}
+
+	if pub.ID != keyID(pub.Sign, pub.Box) {
+		return fmt.Errorf("secure: key id '%s' mismatch", pub.ID)
+	}
+	return nil
+}
+
+// keyID 公钥的指纹
+func keyID(sign, box []byte) string {
+	h := sha256.New()
+	h.Write(sign)
+	h.Write(box)
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+func writeFile(filename string, b []byte, perm os.FileMode) error {
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
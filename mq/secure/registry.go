@@ -0,0 +1,176 @@
+package secure
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Registry 保存 Center 与边缘节点的公钥，每个所有者最新创建的密钥为当前密钥，
+// 用于加密发给它的消息；轮换之后旧的密钥仍可以验证签名，直到被吊销
+type Registry struct {
+	mu       sync.RWMutex
+	keys     map[string]*PublicKey
+	current  map[string]string
+	filename string
+}
+
+// NewRegistry 创建只保存在内存中的 Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		keys:    make(map[string]*PublicKey),
+		current: make(map[string]string),
+	}
+}
+
+// OpenRegistry 打开保存在 filename 中的 Registry, 文件不存在时创建，每次修改后写回文件
+func OpenRegistry(filename string) (*Registry, error) {
+	var r = NewRegistry()
+	r.filename = filename
+
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return r, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("secure: read registry error: %w", err)
+	}
+
+	var keys []PublicKey
+	if err = json.Unmarshal(b, &keys); err != nil {
+		return nil, fmt.Errorf("secure: decode registry error: %w", err)
+	}
+
+	for _, key := range keys {
+		if err = r.add(key); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Add 注册公钥，比所有者当前密钥新的公钥成为当前密钥
+func (r *Registry) Add(key PublicKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.add(key); err != nil {
+		return err
+	}
+	return r.save()
+}
+
+func (r *Registry) add(key PublicKey) error {
+	if err := key.validate(); err != nil {
+		return err
+	}
+
+	if old, ok := r.keys[key.ID]; ok && old.Revoked {
+		return fmt.Errorf("secure: key '%s' has been revoked", key.ID)
+	}
+
+	r.keys[key.ID] = &key
+	if key.Revoked {
+		return nil
+	}
+
+	if cur, ok := r.keys[r.current[key.Owner]]; !ok || !key.Created.Before(cur.Created) {
+		r.current[key.Owner] = key.ID
+	}
+	return nil
+}
+
+// Revoke 吊销密钥，之后用它签名的消息都被拒绝
+func (r *Registry) Revoke(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[id]
+	if !ok {
+		return fmt.Errorf("secure: not found key '%s'", id)
+	}
+
+	key.Revoked = true
+	if r.current[key.Owner] == id {
+		// 回退到所有者其他未吊销的最新密钥
+		delete(r.current, key.Owner)
+		for _, other := range r.keys {
+			if other.Owner != key.Owner || other.Revoked {
+				continue
+			}
+
+			if cur, ok := r.keys[r.current[key.Owner]]; !ok || cur.Created.Before(other.Created) {
+				r.current[key.Owner] = other.ID
+			}
+		}
+	}
+	return r.save()
+}
+
+// Lookup 返回未吊销的公钥
+func (r *Registry) Lookup(id string) (PublicKey, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key, ok := r.keys[id]
+	if !ok || key.Revoked {
+		return PublicKey{}, false
+	}
+	return *key, true
+}
+
+// Current 返回所有者的当前密钥
+func (r *Registry) Current(owner string) (PublicKey, bool) {
+	r.mu.RLock()
+	id, ok := r.current[owner]
+	r.mu.RUnlock()
+
+	if !ok {
+		return PublicKey{}, false
+	}
+	return r.Lookup(id)
+}
+
+// Owners 返回拥有当前密钥的所有者
+func (r *Registry) Owners() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var owners = make([]string, 0, len(r.current))
+	for owner := range r.current {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+	return owners
+}
+
+func (r *Registry) save() error {
+	if len(r.filename) == 0 {
+		return nil
+	}
+
+	var keys = make([]*PublicKey, 0, len(r.keys))
+	for _, key := range r.keys {
+		keys = append(keys, key)
+	}
+
+	// 按创建时间保存，文件内容保持稳定
+	sort.SliceStable(keys, func(i, j int) bool {
+		if keys[i].Created.Equal(keys[j].Created) {
+			return keys[i].ID < keys[j].ID
+		}
+		return keys[i].Created.Before(keys[j].Created)
+	})
+
+	b, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = writeFile(r.filename, b, 0644); err != nil {
+		return fmt.Errorf("secure: write registry error: %w", err)
+	}
+	return nil
+}
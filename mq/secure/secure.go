@@ -0,0 +1,368 @@
+// Package secure 在消息队列之上提供端到端的签名与加密，代理只能看到密文。
+//
+// 每个所有者 (Center 或边缘节点) 持有自己的密钥对，对方的公钥保存在 Registry 中。
+// 发布时消息用发送方的密钥签名，并用接收方的当前公钥加密：
+// 发往 {ns}/down 主题的消息加密给主题中的边缘节点，发往 {ns}/up 主题的消息加密给 Center;
+// 收到消息时验证签名，并检查签名者就是主题的所有者，边缘节点无法冒充 Center 或其他节点。
+//
+// 签名覆盖主题与原消息 (包括 ID 与 Time), 但不提供重放保护: 去重窗口只记录最近的消息 ID,
+// 已经移出窗口的消息重放时仍会被再次应用; 保留消息重连时可能很旧，也不能按 Time 丢弃。
+package secure
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/codec"
+	"github.com/hysios/log"
+)
+
+const (
+	CmdSealed    edgekv.Command = "sealed"
+	CmdRotateKey edgekv.Command = "rotate_key"
+)
+
+// TopicKeys 密钥轮换的频道
+const TopicKeys = "keys"
+
+// MessageSealed 签名 (与加密) 之后的消息, Data 为原消息的编码
+type MessageSealed struct {
+	Sender    string `json:"sender"`
+	Recipient string `json:"recipient,omitempty"`
+	Data      []byte `json:"data"`
+	Sig       []byte `json:"sig"`
+}
+
+// MessageRotateKey 用旧密钥签名的新公钥
+type MessageRotateKey struct {
+	Key PublicKey `json:"key"`
+}
+
+var (
+	ErrUnsealed   = errors.New("secure: message is not sealed")
+	ErrUnknownKey = errors.New("secure: unknown key")
+	ErrSignature  = errors.New("secure: invalid signature")
+	ErrDecrypt    = errors.New("secure: decrypt message error")
+)
+
+// Queue 包装消息队列，发布时签名加密，订阅时验证解密
+type Queue struct {
+	edgekv.MessageQueue
+	Registry *Registry
+	Codec    codec.Codec
+	// SignOnly 只签名不加密
+	SignOnly bool
+	// AllowPlain 接收未签名的消息，用于逐个节点开启签名的过渡期
+	AllowPlain bool
+	// RevokeAfter 接受对方的密钥轮换之后，等待 RevokeAfter 再吊销被替换的旧密钥，
+	// 期间仍接受旧密钥签名的消息 (例如轮换之前发出、还在队列中的消息); 0 时立即吊销
+	RevokeAfter time.Duration
+
+	mu   sync.RWMutex
+	key  *PrivateKey
+	keys map[string]*PrivateKey
+}
+
+var _ edgekv.MessageQueue = (*Queue)(nil)
+var _ edgekv.RetainPublisher = (*Queue)(nil)
+
+// Wrap 用所有者的密钥 key 与对方公钥的 registry 包装消息队列
+func Wrap(mq edgekv.MessageQueue, key *PrivateKey, registry *Registry) *Queue {
+	c, _ := codec.Get(codec.Default)
+	return &Queue{
+		MessageQueue: mq,
+		Registry:     registry,
+		Codec:        c,
+		key:          key,
+		keys:         map[string]*PrivateKey{key.ID: key},
+	}
+}
+
+// Key 返回当前用于签名的密钥
+func (q *Queue) Key() *PrivateKey {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.key
+}
+
+// AddKey 加入轮换之前的旧密钥，用于解密加密给旧密钥的消息
+func (q *Queue) AddKey(key *PrivateKey) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.keys[key.ID] = key
+}
+
+func (q *Queue) privateKey(id string) (*PrivateKey, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	key, ok := q.keys[id]
+	return key, ok
+}
+
+func (q *Queue) Publish(topic string, msg edgekv.Message) error {
+	sealed, err := q.Seal(topic, msg)
+	if err != nil {
+		return err
+	}
+	return q.MessageQueue.Publish(topic, sealed)
+}
+
+func (q *Queue) PublishRetained(topic string, msg edgekv.Message) error {
+	rp, ok := q.MessageQueue.(edgekv.RetainPublisher)
+	if !ok {
+		return fmt.Errorf("secure: message queue %T does not support retained messages", q.MessageQueue)
+	}
+
+	sealed, err := q.Seal(topic, msg)
+	if err != nil {
+		return err
+	}
+	return rp.PublishRetained(topic, sealed)
+}
+
+// Subscribe 订阅主题，验证失败的消息记录日志后丢弃
+func (q *Queue) Subscribe(topic string, fn func(msg edgekv.Message) error) error {
+	return q.MessageQueue.Subscribe(topic, func(msg edgekv.Message) error {
+		opened, err := q.Open(msg)
+		if err != nil {
+			log.Errorf("secure: drop message on '%s': %s", msg.Topic, err)
+			return nil
+		}
+		return fn(opened)
+	})
+}
+
+// Seal 签名并加密发往 topic 的消息，主题没有接收方时只签名
+func (q *Queue) Seal(topic string, msg edgekv.Message) (edgekv.Message, error) {
+	data, err := q.Codec.Marshal(msg)
+	if err != nil {
+		return msg, err
+	}
+
+	var (
+		key    = q.Key()
+		sealed = MessageSealed{Sender: key.ID}
+	)
+
+	if owner, ok := recipientOf(topic); ok && !q.SignOnly {
+		recipient, ok := q.Registry.Current(owner)
+		if !ok {
+			return msg, fmt.Errorf("%w of '%s'", ErrUnknownKey, owner)
+		}
+
+		if data, err = recipient.seal(data); err != nil {
+			return msg, fmt.Errorf("secure: encrypt message error: %w", err)
+		}
+		sealed.Recipient = recipient.ID
+	}
+
+	sealed.Data = data
+	sealed.Sig = key.sign(signed(topic, sealed))
+
+	return edgekv.Message{
+		ID:      msg.ID,
+		Time:    msg.Time,
+		From:    msg.From,
+		Type:    CmdSealed,
+		Payload: sealed,
+	}, nil
+}
+
+// Open 验证并解密收到的消息，返回原消息
+func (q *Queue) Open(msg edgekv.Message) (edgekv.Message, error) {
+	if msg.Type != CmdSealed {
+		if q.AllowPlain {
+			return msg, nil
+		}
+		return msg, ErrUnsealed
+	}
+
+	sealed, ok := msg.Payload.(*MessageSealed)
+	if !ok {
+		return msg, fmt.Errorf("secure: invalid sealed payload %T", msg.Payload)
+	}
+
+	sender, ok := q.Registry.Lookup(sealed.Sender)
+	if !ok {
+		return msg, fmt.Errorf("%w '%s'", ErrUnknownKey, sealed.Sender)
+	}
+
+	if owner, ok := senderOf(msg.Topic); ok && sender.Owner != owner {
+		return msg, fmt.Errorf("secure: key of '%s' signed message on topic of '%s'", sender.Owner, owner)
+	}
+
+	if !sender.verify(signed(msg.Topic, *sealed), sealed.Sig) {
+		return msg, ErrSignature
+	}
+
+	var data = sealed.Data
+	if len(sealed.Recipient) > 0 {
+		key, ok := q.privateKey(sealed.Recipient)
+		if !ok {
+			return msg, fmt.Errorf("%w '%s'", ErrUnknownKey, sealed.Recipient)
+		}
+
+		if data, ok = key.open(data); !ok {
+			return msg, ErrDecrypt
+		}
+	} else if _, ok := recipientOf(msg.Topic); ok && !q.SignOnly {
+		return msg, fmt.Errorf("secure: message on '%s' is not encrypted", msg.Topic)
+	}
+
+	var opened edgekv.Message
+	if err := q.Codec.Unmarshal(data, &opened); err != nil {
+		return msg, err
+	}
+
+	opened.Topic = msg.Topic
+	opened.Retained = msg.Retained
+	return opened, nil
+}
+
+// Rotate 用当前密钥签名发布新的公钥，之后改用新密钥签名，旧密钥仍用于解密;
+// 接收方在 AcceptRotation 中吊销旧的公钥，之后旧密钥签名的消息都被拒绝。
+// 边缘节点发布到 {ns}/up/keys, Center 以保留消息发布到 Registry 中每个节点的 {ns}/down/keys
+func (q *Queue) Rotate(key *PrivateKey) error {
+	var old = q.Key()
+	if key.Owner != old.Owner {
+		return fmt.Errorf("secure: rotate key of '%s' with key of '%s'", old.Owner, key.Owner)
+	}
+
+	msg := edgekv.NewMessage(old.Owner, CmdRotateKey, MessageRotateKey{Key: key.Public()})
+	if old.Owner == CenterOwner {
+		for _, owner := range q.Registry.Owners() {
+			if owner == CenterOwner {
+				continue
+			}
+
+			if err := q.publishKey(edgekv.EdgeID(owner).DownTopic(TopicKeys), msg); err != nil {
+				return err
+			}
+		}
+	} else if err := q.Publish(edgekv.EdgeID(old.Owner).UpTopic(TopicKeys), msg); err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	q.keys[key.ID] = key
+	q.key = key
+	q.mu.Unlock()
+	return nil
+}
+
+func (q *Queue) publishKey(topic string, msg edgekv.Message) error {
+	if _, ok := q.MessageQueue.(edgekv.RetainPublisher); ok {
+		return q.PublishRetained(topic, msg)
+	}
+	return q.Publish(topic, msg)
+}
+
+// AcceptRotation 订阅密钥轮换的频道，把对方用旧密钥签名的新公钥加入 Registry, 并按 RevokeAfter 吊销签名的旧密钥。
+// Center 订阅 edgekv.UpWildcard(TopicKeys), 边缘节点订阅自己的 DownTopic(TopicKeys)
+func (q *Queue) AcceptRotation(topic string) error {
+	return q.MessageQueue.Subscribe(topic, func(raw edgekv.Message) error {
+		// 轮换必须由旧密钥签名，AllowPlain 时也不接受未签名的轮换
+		sealed, ok := raw.Payload.(*MessageSealed)
+		if raw.Type != CmdSealed || !ok {
+			log.Errorf("secure: drop unsealed message on '%s'", raw.Topic)
+			return nil
+		}
+
+		msg, err := q.Open(raw)
+		if err != nil {
+			log.Errorf("secure: drop message on '%s': %s", raw.Topic, err)
+			return nil
+		}
+
+		if msg.Type != CmdRotateKey {
+			return nil
+		}
+
+		rotate, ok := msg.Payload.(*MessageRotateKey)
+		if !ok {
+			return fmt.Errorf("secure: invalid rotate key payload %T", msg.Payload)
+		}
+
+		// Open 已经检查签名者就是主题的所有者
+		if owner, ok := senderOf(msg.Topic); !ok || rotate.Key.Owner != owner {
+			log.Errorf("secure: drop key of '%s' on '%s'", rotate.Key.Owner, msg.Topic)
+			return nil
+		}
+
+		if _, ok := q.Registry.Lookup(rotate.Key.ID); ok {
+			return nil
+		}
+
+		log.Infof("secure: rotate key of '%s' to '%s'", rotate.Key.Owner, rotate.Key.ID)
+		if err := q.Registry.Add(rotate.Key); err != nil {
+			log.Errorf("secure: add key '%s' error %s", rotate.Key.ID, err)
+			return nil
+		}
+
+		q.revoke(sealed.Sender)
+		return nil
+	})
+}
+
+// revoke 按 RevokeAfter 吊销被轮换替换的密钥
+func (q *Queue) revoke(id string) {
+	revoke := func() {
+		if err := q.Registry.Revoke(id); err != nil {
+			log.Errorf("secure: revoke key '%s' error %s", id, err)
+		}
+	}
+
+	if q.RevokeAfter > 0 {
+		time.AfterFunc(q.RevokeAfter, revoke)
+	} else {
+		revoke()
+	}
+}
+
+// recipientOf 返回 topic 上消息的接收方
+func recipientOf(topic string) (string, bool) {
+	id, dir, _, ok := edgekv.ParseTopic(topic)
+	if !ok {
+		return "", false
+	}
+
+	if dir == edgekv.DirUp {
+		return CenterOwner, true
+	}
+	return string(id), true
+}
+
+// senderOf 返回允许在 topic 上发布消息的所有者
+func senderOf(topic string) (string, bool) {
+	id, dir, _, ok := edgekv.ParseTopic(topic)
+	if !ok {
+		return "", false
+	}
+
+	if dir == edgekv.DirUp {
+		return string(id), true
+	}
+	return CenterOwner, true
+}
+
+// signed 返回签名覆盖的内容
+func signed(topic string, sealed MessageSealed) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("edgekv-sealed-v1")
+	for _, s := range []string{topic, sealed.Sender, sealed.Recipient} {
+		buf.WriteByte(0)
+		buf.WriteString(s)
+	}
+	buf.WriteByte(0)
+	buf.Write(sealed.Data)
+	return buf.Bytes()
+}
+
+func init() {
+	edgekv.RegisterCommand(CmdSealed, func() interface{} { return new(MessageSealed) })
+	edgekv.RegisterCommand(CmdRotateKey, func() interface{} { return new(MessageRotateKey) })
+}
@@ -0,0 +1,320 @@
+package secure
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/mq/memory"
+	"github.com/hysios/edgekv/mq/mqtest"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPeer struct {
+	key *PrivateKey
+	reg *Registry
+	raw edgekv.MessageQueue
+	mq  *Queue
+}
+
+func newPeer(t *testing.T, broker, owner string) *testPeer {
+	key, err := GenerateKey(owner)
+	if err != nil {
+		t.Fatalf("generate key error %s", err)
+	}
+
+	raw, err := memory.OpenMemoryMQ("memory://" + broker + "/edgekv")
+	if err != nil {
+		t.Fatalf("open memory mq error %s", err)
+	}
+
+	reg := NewRegistry()
+	return &testPeer{key: key, reg: reg, raw: raw, mq: Wrap(raw, key, reg)}
+}
+
+// trust 互相注册公钥
+func trust(peers ...*testPeer) {
+	for _, a := range peers {
+		for _, b := range peers {
+			if a != b {
+				a.reg.Add(b.key.Public())
+			}
+		}
+	}
+}
+
+func recv(t *testing.T, ch chan edgekv.Message) edgekv.Message {
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(mqtest.Timeout):
+		t.Fatalf("wait message timeout")
+	}
+	return edgekv.Message{}
+}
+
+func nothing(t *testing.T, ch chan edgekv.Message) {
+	select {
+	case msg := <-ch:
+		t.Errorf("unexpected message %v", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func changelog(from, key string) edgekv.Message {
+	return edgekv.NewMessage(from, edgekv.CmdChangelog, edgekv.MessageChangelog{Key: key})
+}
+
+func TestSecureMQ(t *testing.T) {
+	key, _ := GenerateKey("mqtest")
+	reg := NewRegistry()
+	reg.Add(key.Public())
+
+	// 不在边缘节点命名空间中的主题只签名
+	mqtest.TestQueue(t, func() edgekv.MessageQueue {
+		mq, err := memory.OpenMemoryMQ("memory://mqtest-secure/edgekv")
+		if err != nil {
+			t.Fatalf("open memory mq error %s", err)
+		}
+		return Wrap(mq, key, reg)
+	})
+}
+
+func TestQueue_SealOpen(t *testing.T) {
+	center := newPeer(t, "seal", CenterOwner)
+	edge := newPeer(t, "seal", "E1")
+	trust(center, edge)
+
+	var (
+		ch    = make(chan edgekv.Message, 1)
+		rawCh = make(chan edgekv.Message, 1)
+		topic = edgekv.EdgeID("E1").DownTopic(edgekv.TopicSync)
+	)
+	edge.mq.Subscribe(topic, func(msg edgekv.Message) error {
+		ch <- msg
+		return nil
+	})
+	edge.raw.Subscribe(topic, func(msg edgekv.Message) error {
+		rawCh <- msg
+		return nil
+	})
+
+	sent := changelog("E1", "secret.password")
+	assert.NoError(t, center.mq.Publish(topic, sent))
+
+	msg := recv(t, ch)
+	assert.Equal(t, msg.ID, sent.ID)
+	assert.Equal(t, msg.Topic, topic)
+	if cmdMsg, ok := msg.Payload.(*edgekv.MessageChangelog); assert.True(t, ok) {
+		assert.Equal(t, cmdMsg.Key, "secret.password")
+	}
+
+	// 代理上只有密文
+	raw := recv(t, rawCh)
+	assert.Equal(t, raw.Type, CmdSealed)
+	if sealed, ok := raw.Payload.(*MessageSealed); assert.True(t, ok) {
+		assert.Equal(t, sealed.Sender, center.key.ID)
+		assert.Equal(t, sealed.Recipient, edge.key.ID)
+		assert.False(t, bytes.Contains(sealed.Data, []byte("secret.password")))
+	}
+}
+
+func TestQueue_Forged(t *testing.T) {
+	center := newPeer(t, "forged", CenterOwner)
+	e1 := newPeer(t, "forged", "E1")
+	e2 := newPeer(t, "forged", "E2")
+	trust(center, e1, e2)
+
+	var ch = make(chan edgekv.Message, 4)
+	center.mq.Subscribe(edgekv.UpWildcard(edgekv.TopicSync), func(msg edgekv.Message) error {
+		ch <- msg
+		return nil
+	})
+
+	// E2 用自己的密钥在 E1 的主题上发布
+	assert.NoError(t, e2.mq.Publish(edgekv.EdgeID("E1").UpTopic(edgekv.TopicSync), changelog("E1", "forged")))
+	// 未签名的消息
+	assert.NoError(t, e1.raw.Publish(edgekv.EdgeID("E1").UpTopic(edgekv.TopicSync), changelog("E1", "plain")))
+	nothing(t, ch)
+
+	// 篡改密文
+	sealed, err := e1.mq.Seal(edgekv.EdgeID("E1").UpTopic(edgekv.TopicSync), changelog("E1", "tampered"))
+	assert.NoError(t, err)
+	payload := sealed.Payload.(MessageSealed)
+	payload.Data[len(payload.Data)-1] ^= 0xff
+	sealed.Payload = payload
+	assert.NoError(t, e1.raw.Publish(edgekv.EdgeID("E1").UpTopic(edgekv.TopicSync), sealed))
+	nothing(t, ch)
+
+	// 边缘节点不能冒充 Center 发布配置
+	var edgeCh = make(chan edgekv.Message, 1)
+	e1.mq.Subscribe(edgekv.EdgeID("E1").DownTopic(edgekv.TopicSync), func(msg edgekv.Message) error {
+		edgeCh <- msg
+		return nil
+	})
+	e2.reg.Add(e1.key.Public())
+	assert.NoError(t, e2.mq.Publish(edgekv.EdgeID("E1").DownTopic(edgekv.TopicSync), changelog("E1", "forged")))
+	nothing(t, edgeCh)
+
+	assert.NoError(t, e1.mq.Publish(edgekv.EdgeID("E1").UpTopic(edgekv.TopicSync), changelog("E1", "ok")))
+	msg := recv(t, ch)
+	assert.Equal(t, msg.Payload.(*edgekv.MessageChangelog).Key, "ok")
+}
+
+func TestQueue_Rotate(t *testing.T) {
+	center := newPeer(t, "rotate", CenterOwner)
+	edge := newPeer(t, "rotate", "E1")
+	trust(center, edge)
+
+	assert.NoError(t, center.mq.AcceptRotation(edgekv.UpWildcard(TopicKeys)))
+	assert.NoError(t, edge.mq.AcceptRotation(edgekv.EdgeID("E1").DownTopic(TopicKeys)))
+
+	var (
+		up     = make(chan edgekv.Message, 1)
+		down   = make(chan edgekv.Message, 1)
+		upTp   = edgekv.EdgeID("E1").UpTopic(edgekv.TopicSync)
+		downTp = edgekv.EdgeID("E1").DownTopic(edgekv.TopicSync)
+	)
+	center.mq.Subscribe(upTp, func(msg edgekv.Message) error {
+		up <- msg
+		return nil
+	})
+	edge.mq.Subscribe(downTp, func(msg edgekv.Message) error {
+		down <- msg
+		return nil
+	})
+
+	// 边缘节点轮换密钥
+	newKey, _ := GenerateKey("E1")
+	assert.NoError(t, edge.mq.Rotate(newKey))
+	assert.Eventually(t, func() bool {
+		cur, ok := center.reg.Current("E1")
+		return ok && cur.ID == newKey.ID
+	}, mqtest.Timeout, 10*time.Millisecond)
+
+	assert.NoError(t, edge.mq.Publish(upTp, changelog("E1", "new")))
+	assert.Equal(t, recv(t, up).Payload.(*edgekv.MessageChangelog).Key, "new")
+
+	// 旧密钥已经吊销，泄露的旧密钥签名的消息被拒绝
+	_, ok := center.reg.Lookup(edge.key.ID)
+	assert.False(t, ok)
+	assert.NoError(t, Wrap(edge.raw, edge.key, edge.reg).Publish(upTp, changelog("E1", "old")))
+	nothing(t, up)
+
+	// Center 轮换密钥，边缘节点从保留消息中收到新公钥
+	newCenter, _ := GenerateKey(CenterOwner)
+	assert.NoError(t, center.mq.Rotate(newCenter))
+	assert.Eventually(t, func() bool {
+		cur, ok := edge.reg.Current(CenterOwner)
+		return ok && cur.ID == newCenter.ID
+	}, mqtest.Timeout, 10*time.Millisecond)
+
+	assert.NoError(t, center.mq.Publish(downTp, changelog("E1", "down")))
+	msg := recv(t, down)
+	assert.Equal(t, msg.Payload.(*edgekv.MessageChangelog).Key, "down")
+
+	assert.NoError(t, Wrap(center.raw, center.key, center.reg).Publish(downTp, changelog("E1", "old")))
+	nothing(t, down)
+
+	// 其他节点不能替 E1 轮换密钥
+	other := newPeer(t, "rotate", "E2")
+	trust(center, other)
+	forged, _ := GenerateKey("E1")
+	other.mq.Publish(edgekv.EdgeID("E1").UpTopic(TopicKeys), edgekv.NewMessage("E1", CmdRotateKey, MessageRotateKey{Key: forged.Public()}))
+	time.Sleep(100 * time.Millisecond)
+	cur, _ := center.reg.Current("E1")
+	assert.Equal(t, cur.ID, newKey.ID)
+	_, ok = center.reg.Lookup(newKey.ID)
+	assert.True(t, ok)
+}
+
+func TestQueue_RevokeAfter(t *testing.T) {
+	center := newPeer(t, "revoke", CenterOwner)
+	edge := newPeer(t, "revoke", "E1")
+	trust(center, edge)
+
+	center.mq.RevokeAfter = 200 * time.Millisecond
+	assert.NoError(t, center.mq.AcceptRotation(edgekv.UpWildcard(TopicKeys)))
+
+	newKey, _ := GenerateKey("E1")
+	assert.NoError(t, edge.mq.Rotate(newKey))
+	assert.Eventually(t, func() bool {
+		cur, ok := center.reg.Current("E1")
+		return ok && cur.ID == newKey.ID
+	}, mqtest.Timeout, 10*time.Millisecond)
+
+	// 宽限期内旧密钥仍然有效，之后被吊销
+	_, ok := center.reg.Lookup(edge.key.ID)
+	assert.True(t, ok)
+	assert.Eventually(t, func() bool {
+		_, ok := center.reg.Lookup(edge.key.ID)
+		return !ok
+	}, mqtest.Timeout, 10*time.Millisecond)
+}
+
+func TestRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secure")
+	if err != nil {
+		t.Fatalf("create temp dir error %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "registry.json")
+	reg, err := OpenRegistry(filename)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	k1, _ := GenerateKey("E1")
+	k2, _ := GenerateKey("E1")
+	assert.NoError(t, reg.Add(k2.Public()))
+	// 较旧的密钥不会替换当前密钥
+	assert.NoError(t, reg.Add(k1.Public()))
+
+	reg, err = OpenRegistry(filename)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	cur, ok := reg.Current("E1")
+	assert.True(t, ok)
+	assert.Equal(t, cur.ID, k2.ID)
+
+	// 吊销当前密钥后回退到旧密钥
+	assert.NoError(t, reg.Revoke(k2.ID))
+	_, ok = reg.Lookup(k2.ID)
+	assert.False(t, ok)
+	cur, _ = reg.Current("E1")
+	assert.Equal(t, cur.ID, k1.ID)
+	assert.Error(t, reg.Add(k2.Public()))
+
+	var bad = k1.Public()
+	bad.Owner = "E2"
+	bad.ID = "0000"
+	assert.Error(t, reg.Add(bad))
+	assert.Equal(t, reg.Owners(), []string{"E1"})
+}
+
+func TestLoadKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secure")
+	if err != nil {
+		t.Fatalf("create temp dir error %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, _ := GenerateKey("E1")
+	filename := filepath.Join(dir, "E1.key")
+	assert.NoError(t, key.Save(filename))
+
+	loaded, err := LoadKey(filename)
+	if assert.NoError(t, err) {
+		assert.Equal(t, loaded.ID, key.ID)
+		assert.Equal(t, loaded.SignKey, key.SignKey)
+		assert.Equal(t, loaded.BoxKey, key.BoxKey)
+		assert.True(t, loaded.Created.Equal(key.Created))
+	}
+}
@@ -0,0 +1,62 @@
+package edgekv
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPayload(t *testing.T) {
+	var tests = []struct {
+		cmd  Command
+		want interface{}
+	}{
+		{CmdChangelog, &MessageChangelog{}},
+		{CmdDeclareBinder, &MessageDeclareBinder{}},
+		{CmdGetBind, &MessageGetBind{}},
+		{CmdSetBind, &MessageSetBind{}},
+		{CmdRetBind, &MessageRetBind{}},
+		{CmdDeleteBind, &MessageDeleteBind{}},
+	}
+
+	for _, tt := range tests {
+		payload, err := NewPayload(tt.cmd)
+		assert.NoError(t, err)
+		assert.IsType(t, tt.want, payload, tt.cmd)
+	}
+
+	_, err := NewPayload("reboot")
+	assert.True(t, errors.Is(err, ErrUnknownCommand))
+}
+
+func TestMessage_Build(t *testing.T) {
+	var msg = Message{Type: CmdRetBind}
+	assert.True(t, msg.Build())
+	assert.IsType(t, &MessageRetBind{}, msg.Payload)
+
+	msg = Message{Type: "reboot"}
+	assert.False(t, msg.Build())
+}
+
+func TestMessage_Normalize(t *testing.T) {
+	var msg = Message{Type: CmdGetBind, Payload: MessageGetBind{Key: "on"}}
+	assert.NoError(t, msg.Normalize())
+	if getmsg, ok := msg.Payload.(*MessageGetBind); assert.True(t, ok) {
+		assert.Equal(t, getmsg.Key, "on")
+	}
+
+	msg = Message{Type: CmdGetBind, Payload: &MessageGetBind{Key: "on"}}
+	assert.NoError(t, msg.Normalize())
+	assert.IsType(t, &MessageGetBind{}, msg.Payload)
+
+	msg = Message{Type: CmdGetBind}
+	assert.NoError(t, msg.Normalize())
+	assert.IsType(t, &MessageGetBind{}, msg.Payload)
+
+	msg = Message{Type: CmdGetBind, Payload: MessageSetBind{}}
+	assert.Error(t, msg.Normalize())
+
+	msg = Message{Type: "reboot", Payload: MessageSetBind{}}
+	assert.True(t, errors.Is(msg.Normalize(), ErrUnknownCommand))
+}
@@ -0,0 +1,193 @@
+// Package openapi 生成 Edge 与 Center HTTP API 的 OpenAPI 3 文档
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Version 生成的文档使用的 OpenAPI 版本
+const Version = "3.0.3"
+
+const refPrefix = "#/components/schemas/"
+
+// Document OpenAPI 文档
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// PathItem 路径上的操作，键为小写的 HTTP 方法
+type PathItem map[string]*Operation
+
+type Operation struct {
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	OperationID string               `json:"operationId,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+type RequestBody struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required,omitempty"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+// Schema OpenAPI 使用的 JSON Schema
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	ContentEncoding      string             `json:"contentEncoding,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+}
+
+// New 创建空的文档
+func New(title, version string) *Document {
+	return &Document{
+		OpenAPI:    Version,
+		Info:       Info{Title: title, Version: version},
+		Paths:      make(map[string]*PathItem),
+		Components: Components{Schemas: make(map[string]*Schema)},
+	}
+}
+
+// Ref 引用组件中名为 name 的 Schema
+func Ref(name string) *Schema {
+	return &Schema{Ref: refPrefix + name}
+}
+
+// Add 添加路径上的操作，path 可以是 mux 的路由模板，参数中的正则表达式会被去掉，
+// 操作没有声明的路径参数自动添加为必需的字符串参数
+func (doc *Document) Add(method, path string, op *Operation) {
+	path, params := parsePath(path)
+	for _, name := range params {
+		if !op.hasParam(name, "path") {
+			op.Parameters = append(op.Parameters, &Parameter{
+				Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"},
+			})
+		}
+	}
+
+	if op.Responses == nil {
+		op.Responses = make(map[string]*Response)
+	}
+
+	item, ok := doc.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		doc.Paths[path] = item
+	}
+	(*item)[strings.ToLower(method)] = op
+}
+
+// AddSchema 添加组件中的 Schema, 返回对它的引用
+func (doc *Document) AddSchema(name string, s *Schema) *Schema {
+	doc.Components.Schemas[name] = s
+	return Ref(name)
+}
+
+func (op *Operation) hasParam(name, in string) bool {
+	for _, p := range op.Parameters {
+		if p.Name == name && p.In == in {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePath 把 /keys/{key:.+} 转换为 /keys/{key}, 并返回其中的参数名
+func parsePath(tpl string) (string, []string) {
+	var (
+		b      strings.Builder
+		params []string
+	)
+
+	for {
+		i := strings.IndexByte(tpl, '{')
+		if i < 0 {
+			b.WriteString(tpl)
+			break
+		}
+		j := strings.IndexByte(tpl[i:], '}')
+		if j < 0 {
+			b.WriteString(tpl)
+			break
+		}
+
+		name := tpl[i+1 : i+j]
+		if k := strings.IndexByte(name, ':'); k >= 0 {
+			name = name[:k]
+		}
+		params = append(params, name)
+
+		b.WriteString(tpl[:i])
+		b.WriteString("{" + name + "}")
+		tpl = tpl[i+j+1:]
+	}
+	return b.String(), params
+}
+
+// Content 返回 mimeType 的内容描述
+func Content(mimeType string, s *Schema) map[string]MediaType {
+	return map[string]MediaType{mimeType: {Schema: s}}
+}
+
+// JSON 返回 application/json 的内容描述
+func JSON(s *Schema) map[string]MediaType {
+	return Content("application/json", s)
+}
+
+// Handler 以 JSON 返回 build 生成的文档，每次请求时重新生成，之后注册的模型也会出现在文档中
+func Handler(build func() *Document) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := json.MarshalIndent(build(), "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	})
+}
@@ -0,0 +1,115 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePath(t *testing.T) {
+	path, params := parsePath("/api/{version}/keys/{key:.+}")
+	assert.Equal(t, "/api/{version}/keys/{key}", path)
+	assert.Equal(t, []string{"version", "key"}, params)
+
+	path, params = parsePath("/keys")
+	assert.Equal(t, "/keys", path)
+	assert.Empty(t, params)
+}
+
+type base struct {
+	ID string `json:"id"`
+}
+
+type node struct {
+	base
+	Name     string           `json:"name"`
+	Tags     []string         `json:"tags,omitempty"`
+	Raw      []byte           `json:"raw,omitempty"`
+	Created  time.Time        `json:"created"`
+	Value    interface{}      `json:"value"`
+	Children map[string]*node `json:"children,omitempty"`
+	Skip     string           `json:"-"`
+	private  string
+}
+
+func TestSchemaFor(t *testing.T) {
+	doc := New("test", "1.0")
+
+	ref := doc.SchemaFor(&node{})
+	assert.Equal(t, Ref("node"), ref)
+
+	s := doc.Components.Schemas["node"]
+	assert.Equal(t, "object", s.Type)
+	assert.Equal(t, []string{"id", "name", "created", "value"}, s.Required)
+	assert.Equal(t, &Schema{Type: "string"}, s.Properties["id"])
+	assert.Equal(t, &Schema{Type: "array", Items: &Schema{Type: "string"}}, s.Properties["tags"])
+	assert.Equal(t, &Schema{Type: "string", Format: "byte"}, s.Properties["raw"])
+	assert.Equal(t, &Schema{Type: "string", Format: "date-time"}, s.Properties["created"])
+	assert.Equal(t, &Schema{}, s.Properties["value"])
+
+	// 自引用的结构体使用引用
+	assert.Equal(t, &Schema{Type: "object", AdditionalProperties: Ref("node")}, s.Properties["children"])
+	assert.NotContains(t, s.Properties, "Skip")
+	assert.NotContains(t, s.Properties, "private")
+}
+
+func TestDocument_Routes(t *testing.T) {
+	var (
+		doc    = New("test", "1.0")
+		r      = mux.NewRouter()
+		routes = []Route{
+			{Method: http.MethodGet, Path: "/keys/{key:.+}", Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(mux.Vars(r)["key"]))
+			}, Doc: func(doc *Document) *Operation {
+				return &Operation{Summary: "get"}
+			}},
+			{Method: http.MethodPut, Path: "/internal", Handler: func(w http.ResponseWriter, r *http.Request) {}},
+		}
+	)
+
+	Register(r, routes)
+	doc.AddRoutes("/api", routes)
+
+	// 路由按模板注册，文档中去掉参数的正则表达式并补上路径参数
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/keys/net/eth0", nil))
+	assert.Equal(t, "net/eth0", w.Body.String())
+
+	op := (*doc.Paths["/api/keys/{key}"])["get"]
+	if assert.NotNil(t, op) {
+		assert.Equal(t, "get", op.Summary)
+		assert.Equal(t, []*Parameter{{Name: "key", In: "path", Required: true, Schema: &Schema{Type: "string"}}}, op.Parameters)
+	}
+	assert.NotContains(t, doc.Paths, "/api/internal")
+}
+
+func TestHandler(t *testing.T) {
+	var reg = NewRegistry()
+	reg.Register("net", &Schema{Type: "object"})
+	reg.Register("app", &Schema{Type: "object"})
+	assert.Equal(t, []string{"app", "net"}, reg.Models())
+
+	h := Handler(func() *Document {
+		doc := New("test", "1.0")
+		for _, model := range reg.Models() {
+			s, _ := reg.Lookup(model)
+			doc.AddSchema(model, s)
+		}
+		return doc
+	})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var doc Document
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, Version, doc.OpenAPI)
+	assert.Contains(t, doc.Components.Schemas, "net")
+	assert.Contains(t, doc.Components.Schemas, "app")
+}
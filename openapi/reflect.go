@@ -0,0 +1,116 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// SchemaFor 按 encoding/json 的规则生成 v 的类型的 Schema, 具名的结构体加入组件并返回引用
+func (doc *Document) SchemaFor(v interface{}) *Schema {
+	return doc.schemaOf(reflect.TypeOf(v))
+}
+
+func (doc *Document) schemaOf(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return doc.schemaOf(t.Elem())
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: doc.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: doc.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if len(t.Name()) == 0 {
+			return doc.structSchema(t)
+		}
+
+		name := t.Name()
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			// 先占位，自引用的结构体 (例如 Schema 的 Properties) 得到引用而不是无限递归
+			doc.Components.Schemas[name] = &Schema{}
+			doc.Components.Schemas[name] = doc.structSchema(t)
+		}
+		return Ref(name)
+	default:
+		// interface{} 为任意值
+		return &Schema{}
+	}
+}
+
+func (doc *Document) structSchema(t reflect.Type) *Schema {
+	var s = &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	doc.addFields(s, t)
+	return s
+}
+
+func (doc *Document) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := tag, ""
+		if j := strings.IndexByte(tag, ','); j >= 0 {
+			name, opts = tag[:j], tag[j+1:]
+		}
+
+		// 没有 json 名称的嵌入结构体，字段展开到外层
+		if f.Anonymous && len(name) == 0 {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				doc.addFields(s, ft)
+				continue
+			}
+		}
+
+		if len(f.PkgPath) > 0 {
+			continue
+		}
+		if len(name) == 0 {
+			name = f.Name
+		}
+
+		s.Properties[name] = doc.schemaOf(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
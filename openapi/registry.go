@@ -0,0 +1,53 @@
+package openapi
+
+import (
+	"sort"
+	"sync"
+)
+
+// Registry 模型的 JSON Schema 注册表，模型是存储中的顶层键，例如 net 保存 net.eth0.ip 等配置，
+// 生成文档时为每个模型添加带有类型的路径
+type Registry struct {
+	mu     sync.RWMutex
+	models map[string]*Schema
+}
+
+// DefaultRegistry 默认的注册表，Edge 与 Center 没有指定注册表时使用
+var DefaultRegistry = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{models: make(map[string]*Schema)}
+}
+
+// Register 注册模型的 Schema, 重复注册时替换
+func (reg *Registry) Register(model string, s *Schema) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.models[model] = s
+}
+
+// Lookup 返回模型的 Schema
+func (reg *Registry) Lookup(model string) (*Schema, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	s, ok := reg.models[model]
+	return s, ok
+}
+
+// Models 返回按名称排序的模型
+func (reg *Registry) Models() []string {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	var models = make([]string, 0, len(reg.models))
+	for model := range reg.models {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	return models
+}
+
+// RegisterModel 在 DefaultRegistry 中注册模型的 Schema
+func RegisterModel(model string, s *Schema) {
+	DefaultRegistry.Register(model, s)
+}
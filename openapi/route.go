@@ -0,0 +1,32 @@
+package openapi
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Route 一条路由及其文档，路由与文档由同一张表生成，不会不一致
+type Route struct {
+	Method  string
+	Path    string
+	Handler http.HandlerFunc
+	// Doc 生成路由的文档，为 nil 时不出现在文档中
+	Doc func(doc *Document) *Operation
+}
+
+// Register 把 routes 注册到 r
+func Register(r *mux.Router, routes []Route) {
+	for _, route := range routes {
+		r.HandleFunc(route.Path, route.Handler).Methods(route.Method)
+	}
+}
+
+// AddRoutes 把有文档的路由加入文档，prefix 为路由在服务中的路径前缀
+func (doc *Document) AddRoutes(prefix string, routes []Route) {
+	for _, route := range routes {
+		if route.Doc != nil {
+			doc.Add(route.Method, prefix+route.Path, route.Doc(doc))
+		}
+	}
+}
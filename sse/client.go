@@ -0,0 +1,115 @@
+package sse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hysios/log"
+)
+
+// DefaultRetry 服务端没有设置 retry 时的重连间隔
+var DefaultRetry = 3 * time.Second
+
+// ErrStopped 服务端要求客户端停止重连 (204 No Content)
+var ErrStopped = errors.New("sse: server stopped the stream")
+
+// StatusError 服务端返回了非 200 的响应，客户端不再重连
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("sse: unexpected status %d", e.StatusCode)
+}
+
+// Client 事件流客户端，连接断开后按服务端的 retry 间隔重连，
+// 并通过 Last-Event-ID 请求服务端补发断线期间的事件
+type Client struct {
+	HTTP   *http.Client
+	Header http.Header
+	Retry  time.Duration
+	// LastEventID 最后收到的事件 ID
+	LastEventID string
+}
+
+// Stream 连接 url 并把事件交给 fn, 直到 ctx 结束或服务端拒绝连接
+func (c *Client) Stream(ctx context.Context, url string, fn func(ev Event)) error {
+	var retry = c.Retry
+	if retry <= 0 {
+		retry = DefaultRetry
+	}
+
+	for {
+		err := c.stream(ctx, url, fn, &retry)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var status *StatusError
+		if errors.Is(err, ErrStopped) || errors.As(err, &status) {
+			return err
+		}
+
+		log.Debugf("sse: stream '%s' error %v, reconnect in %s", url, err, retry)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retry):
+		}
+	}
+}
+
+func (c *Client) stream(ctx context.Context, url string, fn func(ev Event), retry *time.Duration) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return &StatusError{StatusCode: http.StatusBadRequest}
+	}
+
+	for k, vs := range c.Header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Accept", MimeType)
+	req.Header.Set("Cache-Control", "no-cache")
+	if len(c.LastEventID) > 0 {
+		req.Header.Set("Last-Event-ID", c.LastEventID)
+	}
+
+	var client = c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNoContent:
+		return ErrStopped
+	case resp.StatusCode != http.StatusOK:
+		return &StatusError{StatusCode: resp.StatusCode}
+	case !strings.HasPrefix(resp.Header.Get("Content-Type"), MimeType):
+		return fmt.Errorf("sse: unexpected content type '%s'", resp.Header.Get("Content-Type"))
+	}
+
+	rd := NewReader(resp.Body)
+	rd.lastEventID = c.LastEventID
+	for {
+		ev, err := rd.Next()
+		if rd.Retry() > 0 {
+			*retry = rd.Retry()
+		}
+		if err != nil {
+			return err
+		}
+
+		c.LastEventID = ev.ID
+		fn(ev)
+	}
+}
@@ -0,0 +1,239 @@
+// Package sse 实现 Server-Sent Events (text/event-stream) 的编码、解析与自动重连的客户端，
+// 支持 event、id、data、retry 字段，客户端重连时通过 Last-Event-ID 续传。
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MimeType 事件流的内容类型
+const MimeType = "text/event-stream"
+
+var ErrNoFlusher = errors.New("sse: response writer does not support flushing")
+
+// Event 事件流中的一个事件
+type Event struct {
+	ID    string
+	Event string
+	Data  []byte
+	// Retry 写入时设置客户端的重连间隔，读取时为流中最后一次设置的值
+	Retry time.Duration
+}
+
+// Writer 把事件写入 HTTP 响应，每个事件写入后立即 Flush
+type Writer struct {
+	w io.Writer
+	f http.Flusher
+}
+
+// NewWriter 设置事件流的响应头，并立即发送给客户端
+func NewWriter(w http.ResponseWriter) (*Writer, error) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		return nil, ErrNoFlusher
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", MimeType)
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	// 关闭反向代理的缓冲
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	f.Flush()
+
+	return &Writer{w: w, f: f}, nil
+}
+
+// Send 写入一个事件
+func (w *Writer) Send(ev Event) error {
+	var buf bytes.Buffer
+
+	if len(ev.ID) > 0 {
+		if strings.ContainsAny(ev.ID, "\r\n\x00") {
+			return fmt.Errorf("sse: invalid event id '%s'", ev.ID)
+		}
+		fmt.Fprintf(&buf, "id: %s\n", ev.ID)
+	}
+
+	if len(ev.Event) > 0 {
+		if strings.ContainsAny(ev.Event, "\r\n") {
+			return fmt.Errorf("sse: invalid event name '%s'", ev.Event)
+		}
+		fmt.Fprintf(&buf, "event: %s\n", ev.Event)
+	}
+
+	if ev.Retry > 0 {
+		fmt.Fprintf(&buf, "retry: %d\n", ev.Retry.Milliseconds())
+	}
+
+	for _, line := range splitLines(ev.Data) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+
+	return w.write(buf.Bytes())
+}
+
+// Retry 设置客户端的重连间隔
+func (w *Writer) Retry(d time.Duration) error {
+	return w.write([]byte(fmt.Sprintf("retry: %d\n\n", d.Milliseconds())))
+}
+
+// Comment 写入注释行，客户端会忽略它，用作心跳保持连接
+func (w *Writer) Comment(text string) error {
+	var buf bytes.Buffer
+	for _, line := range splitLines([]byte(text)) {
+		buf.WriteString(": ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	return w.write(buf.Bytes())
+}
+
+func (w *Writer) write(b []byte) error {
+	if _, err := w.w.Write(b); err != nil {
+		return err
+	}
+	w.f.Flush()
+	return nil
+}
+
+// splitLines 按 \r\n、\r 或 \n 分行，空内容返回一个空行
+func splitLines(b []byte) [][]byte {
+	var lines [][]byte
+	for {
+		i := bytes.IndexAny(b, "\r\n")
+		if i < 0 {
+			return append(lines, b)
+		}
+
+		lines = append(lines, b[:i])
+		if b[i] == '\r' && i+1 < len(b) && b[i+1] == '\n' {
+			i++
+		}
+		b = b[i+1:]
+	}
+}
+
+// Reader 解析事件流
+type Reader struct {
+	r           *bufio.Reader
+	lastEventID string
+	retry       time.Duration
+	started     bool
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next 返回下一个事件，流结束时返回 io.EOF, 没有结束的事件被丢弃
+func (r *Reader) Next() (Event, error) {
+	var (
+		name string
+		data bytes.Buffer
+	)
+
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			return Event{}, err
+		}
+
+		if len(line) == 0 {
+			// 空行结束一个事件，没有数据的事件不分发
+			if data.Len() == 0 {
+				name = ""
+				continue
+			}
+
+			if len(name) == 0 {
+				name = "message"
+			}
+			return Event{
+				ID:    r.lastEventID,
+				Event: name,
+				Data:  bytes.TrimSuffix(data.Bytes(), []byte("\n")),
+				Retry: r.retry,
+			}, nil
+		}
+
+		if line[0] == ':' {
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+
+		switch field {
+		case "event":
+			name = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				r.lastEventID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 63); err == nil {
+				r.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
+
+// LastEventID 返回最后收到的事件 ID
+func (r *Reader) LastEventID() string {
+	return r.lastEventID
+}
+
+// Retry 返回服务端设置的重连间隔，没有设置时为 0
+func (r *Reader) Retry() time.Duration {
+	return r.retry
+}
+
+// readLine 读取以 \r\n、\r 或 \n 结束的一行
+func (r *Reader) readLine() (string, error) {
+	var line []byte
+	for {
+		c, err := r.r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+
+		switch c {
+		case '\n':
+			return r.text(line), nil
+		case '\r':
+			if next, err := r.r.Peek(1); err == nil && next[0] == '\n' {
+				r.r.ReadByte()
+			}
+			return r.text(line), nil
+		default:
+			line = append(line, c)
+		}
+	}
+}
+
+func (r *Reader) text(line []byte) string {
+	if !r.started {
+		r.started = true
+		line = bytes.TrimPrefix(line, []byte("\xef\xbb\xbf"))
+	}
+	return string(line)
+}
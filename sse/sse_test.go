@@ -0,0 +1,153 @@
+package sse
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReader(t *testing.T) {
+	var stream = "\xef\xbb\xbf: comment\n" +
+		"retry: 1500\n\n" +
+		"data: first\n" +
+		"data:second\n\n" +
+		"id: 1\r\n" +
+		"event: change\r\n" +
+		"data: {\"key\": \"a\"}\r\n\r\n" +
+		"event: ignored\n\n" +
+		"data: no id\r\r" +
+		"id: 2\x00\n" +
+		"data\n\n" +
+		"data: unterminated"
+
+	rd := NewReader(strings.NewReader(stream))
+
+	ev, err := rd.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, ev.Event, "message")
+	assert.Equal(t, string(ev.Data), "first\nsecond")
+	assert.Equal(t, ev.Retry, 1500*time.Millisecond)
+
+	ev, err = rd.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, ev, Event{ID: "1", Event: "change", Data: []byte(`{"key": "a"}`), Retry: 1500 * time.Millisecond})
+
+	// 没有数据的事件不分发，之后的事件沿用最后的 ID
+	ev, err = rd.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, ev.Event, "message")
+	assert.Equal(t, ev.ID, "1")
+	assert.Equal(t, string(ev.Data), "no id")
+
+	// 含有 NUL 的 ID 被忽略，只有字段名的 data 是空行
+	ev, err = rd.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, ev.ID, "1")
+	assert.Equal(t, string(ev.Data), "")
+
+	_, err = rd.Next()
+	assert.Equal(t, err, io.EOF)
+}
+
+func TestWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w, err := NewWriter(rec)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, w.Retry(2*time.Second))
+	assert.NoError(t, w.Comment("ping"))
+	assert.NoError(t, w.Send(Event{ID: "7", Event: "change", Data: []byte("line1\nline2\r\nline3")}))
+	assert.Error(t, w.Send(Event{ID: "bad\nid"}))
+
+	assert.Equal(t, rec.Header().Get("Content-Type"), MimeType)
+	assert.Equal(t, rec.Body.String(), "retry: 2000\n\n: ping\n\nid: 7\nevent: change\ndata: line1\ndata: line2\ndata: line3\n\n")
+
+	rd := NewReader(rec.Body)
+	ev, err := rd.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, ev, Event{ID: "7", Event: "change", Data: []byte("line1\nline2\nline3"), Retry: 2 * time.Second})
+}
+
+func TestClient_Resume(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		lastIDs []string
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		lastIDs = append(lastIDs, r.Header.Get("Last-Event-ID"))
+		n := len(lastIDs)
+		mu.Unlock()
+
+		w, err := NewWriter(rw)
+		if err != nil {
+			t.Errorf("new writer error %s", err)
+			return
+		}
+
+		switch n {
+		case 1:
+			// 发送两个事件后断开
+			w.Retry(10 * time.Millisecond)
+			w.Send(Event{ID: "1", Data: []byte("a")})
+			w.Send(Event{ID: "2", Data: []byte("b")})
+		case 2:
+			w.Send(Event{ID: "3", Data: []byte("c")})
+			<-r.Context().Done()
+		}
+	}))
+	defer ts.Close()
+
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		got         = make(chan string, 3)
+		client      = &Client{Retry: time.Hour}
+		done        = make(chan error, 1)
+	)
+
+	go func() {
+		done <- client.Stream(ctx, ts.URL, func(ev Event) {
+			got <- string(ev.Data)
+		})
+	}()
+
+	for _, want := range []string{"a", "b", "c"} {
+		select {
+		case data := <-got:
+			assert.Equal(t, data, want)
+		case <-time.After(3 * time.Second):
+			t.Fatalf("wait event %s timeout", want)
+		}
+	}
+
+	cancel()
+	assert.Equal(t, <-done, context.Canceled)
+	assert.Equal(t, client.LastEventID, "3")
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, lastIDs, []string{"", "2"})
+}
+
+func TestClient_Status(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	var client Client
+	err := client.Stream(context.Background(), ts.URL, func(ev Event) {})
+
+	var status *StatusError
+	if assert.ErrorAs(t, err, &status) {
+		assert.Equal(t, status.StatusCode, http.StatusNotFound)
+	}
+}
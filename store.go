@@ -34,6 +34,11 @@ type Store interface {
 	Accessor
 }
 
+// Deleter 支持删除键的存储，删除键以及它下面所有的子键，键不存在时不返回错误
+type Deleter interface {
+	Delete(key string) error
+}
+
 type Publisher interface {
 }
 
@@ -75,10 +80,9 @@ type Accessor interface {
 	SetDefault(key string, val interface{})
 	AllKeys() []string
 	AllSettings() map[string]interface{}
-	// UnmarshalKey(key string, rawVal interface{}, opts ...DecoderConfigOption) error
-	// Unmarshal(rawVal interface{}, opts ...DecoderConfigOption) error
-	// UnmarshalExact(rawVal interface{}, opts ...DecoderConfigOption) error
-
+	UnmarshalKey(key string, rawVal interface{}, opts ...DecoderConfigOption) error
+	Unmarshal(rawVal interface{}, opts ...DecoderConfigOption) error
+	UnmarshalExact(rawVal interface{}, opts ...DecoderConfigOption) error
 }
 
 type OpenStoreFunc func(args ...string) (Store, error)
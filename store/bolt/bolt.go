@@ -0,0 +1,273 @@
+package bolt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/store/internal/storeval"
+	"github.com/hysios/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltStore 每个模型前缀是一个 bucket, 嵌套的 map 路径对应子 bucket,
+// 叶子节点的值以 gob 编码存储在所在 bucket 的键上
+type boltStore struct {
+	edgekv.Accessor
+
+	db *bolt.DB
+}
+
+var (
+	ErrInvalidModel = errors.New("bolt_store: model value must be a map or struct")
+	ErrEmptyKey     = errors.New("bolt_store: empty key")
+)
+
+var OpenTimeout = 3 * time.Second
+
+func OpenBoltStore(filename string) (*boltStore, error) {
+	var (
+		store = &boltStore{}
+		db    *bolt.DB
+		err   error
+	)
+
+	if db, err = bolt.Open(filename, 0600, &bolt.Options{Timeout: OpenTimeout}); err != nil {
+		return nil, err
+	}
+
+	store.Accessor = edgekv.MakeAccessor(store)
+	store.db = db
+	return store, nil
+}
+
+func (store *boltStore) Get(key string) (val interface{}, ok bool) {
+	if err := store.db.View(func(tx *bolt.Tx) error {
+		val, ok = store.get(tx, splitPath(key))
+		return nil
+	}); err != nil {
+		log.Infof("bolt: get key '%s' error: %s", key, err)
+		return nil, false
+	}
+	return
+}
+
+func (store *boltStore) Keys() []string {
+	var keys []string
+	if err := store.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			keys = append(keys, string(name))
+			return nil
+		})
+	}); err != nil {
+		return nil
+	}
+	return keys
+}
+
+func (store *boltStore) Set(key string, val interface{}) (old interface{}, err error) {
+	var paths = splitPath(key)
+	if len(paths) == 0 {
+		return nil, ErrEmptyKey
+	}
+
+	val = storeval.Value(val)
+	if _, ok := val.(map[string]interface{}); !ok && len(paths) == 1 {
+		return nil, ErrInvalidModel
+	}
+
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		old, _ = store.get(tx, paths)
+
+		if len(paths) == 1 {
+			if err := tx.DeleteBucket([]byte(paths[0])); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+				return err
+			}
+			b, err := tx.CreateBucket([]byte(paths[0]))
+			if err != nil {
+				return err
+			}
+			return putMap(b, val.(map[string]interface{}))
+		}
+
+		b, err := tx.CreateBucketIfNotExists([]byte(paths[0]))
+		if err != nil {
+			return err
+		}
+
+		parents, field := paths[1:len(paths)-1], []byte(paths[len(paths)-1])
+		for _, p := range parents {
+			// 父级原本是叶子节点时, 覆盖为子 bucket
+			if v := b.Get([]byte(p)); v != nil {
+				if err = b.Delete([]byte(p)); err != nil {
+					return err
+				}
+			}
+			if b, err = b.CreateBucketIfNotExists([]byte(p)); err != nil {
+				return err
+			}
+		}
+
+		if err = del(b, field); err != nil {
+			return err
+		}
+		return put(b, field, val)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bolt_store: set key '%s' error: %w", key, err)
+	}
+
+	return old, nil
+}
+
+// Delete 删除键以及它下面所有的子键
+func (store *boltStore) Delete(key string) error {
+	var paths = splitPath(key)
+	if len(paths) == 0 {
+		return ErrEmptyKey
+	}
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		if len(paths) == 1 {
+			if err := tx.DeleteBucket([]byte(paths[0])); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+				return err
+			}
+			return nil
+		}
+
+		b := bucket(tx, paths[:len(paths)-1])
+		if b == nil {
+			return nil
+		}
+		return del(b, []byte(paths[len(paths)-1]))
+	})
+}
+
+func (store *boltStore) Close() error {
+	return store.db.Close()
+}
+
+func (store *boltStore) get(tx *bolt.Tx, paths []string) (interface{}, bool) {
+	if len(paths) == 0 {
+		return nil, false
+	}
+
+	if len(paths) == 1 {
+		b := tx.Bucket([]byte(paths[0]))
+		if b == nil {
+			return nil, false
+		}
+		return getMap(b), true
+	}
+
+	b := bucket(tx, paths[:len(paths)-1])
+	if b == nil {
+		return nil, false
+	}
+
+	field := []byte(paths[len(paths)-1])
+	if sub := b.Bucket(field); sub != nil {
+		return getMap(sub), true
+	}
+
+	raw := b.Get(field)
+	if raw == nil {
+		return nil, false
+	}
+
+	val, err := storeval.Decode(raw)
+	if err != nil {
+		log.Infof("bolt: decode key '%s' error: %s", strings.Join(paths, "."), err)
+		return nil, false
+	}
+	return val, true
+}
+
+func bucket(tx *bolt.Tx, paths []string) *bolt.Bucket {
+	b := tx.Bucket([]byte(paths[0]))
+	for _, p := range paths[1:] {
+		if b == nil {
+			return nil
+		}
+		b = b.Bucket([]byte(p))
+	}
+	return b
+}
+
+func getMap(b *bolt.Bucket) map[string]interface{} {
+	var m = make(map[string]interface{})
+	b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			if sub := b.Bucket(k); sub != nil {
+				m[string(k)] = getMap(sub)
+			}
+			return nil
+		}
+
+		val, err := storeval.Decode(v)
+		if err != nil {
+			log.Infof("bolt: decode key '%s' error: %s", k, err)
+			return nil
+		}
+		m[string(k)] = val
+		return nil
+	})
+	return m
+}
+
+func put(b *bolt.Bucket, key []byte, val interface{}) error {
+	if m, ok := val.(map[string]interface{}); ok {
+		sub, err := b.CreateBucket(key)
+		if err != nil {
+			return err
+		}
+		return putMap(sub, m)
+	}
+
+	raw, err := storeval.Encode(val)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, raw)
+}
+
+func putMap(b *bolt.Bucket, m map[string]interface{}) error {
+	for k, v := range m {
+		if err := put(b, []byte(k), storeval.Value(v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func del(b *bolt.Bucket, key []byte) error {
+	if b.Bucket(key) != nil {
+		return b.DeleteBucket(key)
+	}
+	return b.Delete(key)
+}
+
+func splitPath(key string) []string {
+	if len(key) == 0 {
+		return nil
+	}
+	return strings.Split(key, ".")
+}
+
+func init() {
+	edgekv.RegisterStore("bolt", func(args ...string) (edgekv.Store, error) {
+		if len(args) < 1 {
+			return nil, fmt.Errorf("missing open filename of bolt")
+		}
+
+		if store, err := OpenBoltStore(args[0]); err != nil {
+			return nil, fmt.Errorf("bolt_store: open bolt error %w", err)
+		} else {
+			return store, nil
+		}
+	})
+}
+
+var _ edgekv.Store = &boltStore{}
@@ -0,0 +1,58 @@
+package bolt
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/store/storetest"
+	"github.com/stretchr/testify/assert"
+)
+
+type Map = map[string]interface{}
+
+// openStore 在测试的临时目录中打开一个空的存储，测试结束后关闭
+func openStore(t *testing.T) *boltStore {
+	store, err := OpenBoltStore(filepath.Join(t.TempDir(), "test.bolt"))
+	if err != nil {
+		t.Fatalf("open store error %s", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// 叶子节点与子 bucket 之间可以互相覆盖
+func Test_boltStore_Bucket(t *testing.T) {
+	store := openStore(t)
+
+	_, err := store.Set("test", Map{"age": 18, "on": true})
+	assert.NoError(t, err)
+
+	old, err := store.Set("test.age.years", 18)
+	assert.NoError(t, err)
+	assert.Nil(t, old)
+	assert.Equal(t, store.GetStringMap("test.age"), Map{"years": 18})
+
+	old, err = store.Set("test.age", 20)
+	assert.NoError(t, err)
+	assert.Equal(t, old, Map{"years": 18})
+	assert.Equal(t, store.GetInt("test.age"), 20)
+	assert.True(t, store.GetBool("test.on"))
+}
+
+func Test_boltStore_Errors(t *testing.T) {
+	store := openStore(t)
+
+	_, err := store.Set("test", 1)
+	assert.Equal(t, err, ErrInvalidModel)
+
+	_, err = store.Set("", Map{"on": true})
+	assert.Equal(t, err, ErrEmptyKey)
+	assert.Equal(t, store.Delete(""), ErrEmptyKey)
+}
+
+func Test_boltStore_Conformance(t *testing.T) {
+	storetest.TestStore(t, func() edgekv.Store {
+		return openStore(t)
+	})
+}
@@ -4,8 +4,8 @@ import (
 	"errors"
 	"fmt"
 
-	"github.com/fatih/structs"
 	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/store/internal/storeval"
 	"github.com/hysios/edgekv/utils"
 	"github.com/hysios/log"
 	"github.com/hysios/mapindex"
@@ -38,10 +38,12 @@ func OpenBuntDBStore(filename string) (*buntdbStore, error) {
 func (store *buntdbStore) Get(key string) (val interface{}, ok bool) {
 	var err error
 	if val, err = store.get(key); err != nil {
-		log.Infof("buntdb: get key '%s' error: %s", key, err)
+		if !errors.Is(err, buntdb.ErrNotFound) {
+			log.Infof("buntdb: get key '%s' error: %s", key, err)
+		}
 		return nil, false
 	}
-	return val, true
+	return val, val != nil
 }
 
 func (store *buntdbStore) Keys() []string {
@@ -59,42 +61,38 @@ func (store *buntdbStore) Keys() []string {
 }
 
 func (store *buntdbStore) Set(key string, val interface{}) (old interface{}, err error) {
-	var (
-		prefix, subkey = edgekv.SplitKey(key)
-		m              = make(map[string]interface{})
-	)
+	var prefix, subkey = edgekv.SplitKey(key)
 
-	store.db.View(func(tx *buntdb.Tx) error {
-		raw, err := tx.Get(prefix)
-		if err != nil {
-			return err
-		}
+	val = storeval.Value(val)
+	if _, ok := val.(map[string]interface{}); !ok && len(subkey) == 0 {
+		return nil, fmt.Errorf("buntdb_store: model '%s' value must be a map or struct", key)
+	}
 
-		if err = utils.Unmarshal([]byte(raw), &m); err != nil {
-			return fmt.Errorf("buntdb_store: unmarshal error: %w", err)
+	// 读取与写入在同一个事务中完成，避免并发写入同一模型时丢失更新
+	if err = store.db.Update(func(tx *buntdb.Tx) error {
+		var (
+			m   = make(map[string]interface{})
+			b   []byte
+			raw string
+			err error
+		)
+
+		if raw, err = tx.Get(prefix); err == nil {
+			if err = utils.Unmarshal([]byte(raw), &m); err != nil {
+				return fmt.Errorf("buntdb_store: unmarshal error: %w", err)
+			}
+			old = m
+		} else if !errors.Is(err, buntdb.ErrNotFound) {
+			return err
 		}
 
-		return nil
-	})
-
-	if len(subkey) > 0 {
-		old = mapindex.Get(m, subkey)
-		mapindex.Set(&m, subkey, val, mapindex.OptOverwrite())
-	} else {
-		old = m
-
-		switch x := val.(type) {
-		case map[string]interface{}:
-			m = x
-		default:
-			m = structs.Map(val)
+		if len(subkey) > 0 {
+			old = mapindex.Get(m, subkey)
+			mapindex.Set(&m, subkey, val, mapindex.OptOverwrite())
+		} else {
+			m = val.(map[string]interface{})
 		}
 
-	}
-
-	if err = store.db.Update(func(tx *buntdb.Tx) error {
-		var b []byte
-		// _, _, err = tx.Set(prefix,  utils.Stringify(m), nil)
 		if b, err = utils.Marshal(m); err != nil {
 			return err
 		}
@@ -104,8 +102,41 @@ func (store *buntdbStore) Set(key string, val interface{}) (old interface{}, err
 		return nil, err
 	}
 
-	return
+	return old, nil
+}
+
+// Delete 删除键以及它下面所有的子键，键不存在时不返回错误
+func (store *buntdbStore) Delete(key string) error {
+	var prefix, subkey = edgekv.SplitKey(key)
+
+	return store.db.Update(func(tx *buntdb.Tx) error {
+		if len(subkey) == 0 {
+			if _, err := tx.Delete(prefix); err != nil && !errors.Is(err, buntdb.ErrNotFound) {
+				return err
+			}
+			return nil
+		}
+
+		raw, err := tx.Get(prefix)
+		if errors.Is(err, buntdb.ErrNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var m = make(map[string]interface{})
+		if err = utils.Unmarshal([]byte(raw), &m); err != nil {
+			return fmt.Errorf("buntdb_store: unmarshal error: %w", err)
+		}
+		storeval.Delete(m, subkey)
 
+		b, err := utils.Marshal(m)
+		if err != nil {
+			return err
+		}
+		_, _, err = tx.Set(prefix, string(b), nil)
+		return err
+	})
 }
 
 func (store *buntdbStore) get(key string) (val interface{}, err error) {
@@ -115,12 +146,14 @@ func (store *buntdbStore) get(key string) (val interface{}, err error) {
 		out            = make(map[string]interface{})
 	)
 
-	store.db.View(func(tx *buntdb.Tx) error {
+	if err = store.db.View(func(tx *buntdb.Tx) error {
 		if raw, err = tx.Get(prefix); err != nil {
 			return err
 		}
 		return utils.Unmarshal([]byte(raw), &out)
-	})
+	}); err != nil {
+		return nil, err
+	}
 
 	if len(subkey) > 0 {
 		val = mapindex.Get(out, subkey)
@@ -3,11 +3,13 @@ package buntdb
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/fatih/structs"
 	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/store/storetest"
 	"github.com/hysios/edgekv/utils"
 	"github.com/stretchr/testify/assert"
 	"github.com/tidwall/buntdb"
@@ -136,3 +138,14 @@ func Test_buntdbStore_Keys(t *testing.T) {
 	assert.Greater(t, len(keys), 0)
 	t.Logf("keys %v", keys)
 }
+
+func Test_buntdbStore_Conformance(t *testing.T) {
+	storetest.TestStore(t, func() edgekv.Store {
+		store, err := OpenBuntDBStore(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatalf("open store error %s", err)
+		}
+		t.Cleanup(func() { store.db.Close() })
+		return store
+	})
+}
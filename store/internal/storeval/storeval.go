@@ -0,0 +1,54 @@
+// Package storeval 存储后端共用的值转换与编码
+package storeval
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/fatih/structs"
+	"github.com/hysios/edgekv/utils"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Value 把结构体转换成 map 存储，time.Time 保持不变
+func Value(val interface{}) interface{} {
+	v := reflect.Indirect(reflect.ValueOf(val))
+	if v.Kind() == reflect.Struct && v.Type() != timeType {
+		return structs.Map(val)
+	}
+	return val
+}
+
+// Delete 删除 m 中以 . 分隔的 key 以及它下面所有的子键，路径不存在时什么也不做
+func Delete(m map[string]interface{}, key string) {
+	var paths = strings.Split(key, ".")
+	for _, p := range paths[:len(paths)-1] {
+		sub, ok := m[p].(map[string]interface{})
+		if !ok {
+			return
+		}
+		m = sub
+	}
+	delete(m, paths[len(paths)-1])
+}
+
+// row 包装叶子节点的值，使 gob 编码时保留 interface{} 的具体类型
+type row struct {
+	Value interface{}
+}
+
+// Encode 编码单个叶子节点的值
+func Encode(val interface{}) ([]byte, error) {
+	return utils.Marshal(row{Value: val})
+}
+
+// Decode 解码 Encode 编码的值
+func Decode(b []byte) (interface{}, error) {
+	var r row
+	if err := utils.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+	return r.Value, nil
+}
@@ -0,0 +1,57 @@
+package memory
+
+import (
+	"strings"
+
+	"github.com/hysios/edgekv"
+)
+
+type edgeStore struct {
+	edgekv.Accessor
+
+	ID     edgekv.EdgeID
+	master *memStore
+}
+
+func (m *memStore) OpenEdge(edgeID edgekv.EdgeID) edgekv.Store {
+	var store = &edgeStore{master: m, ID: edgeID}
+	store.Accessor = edgekv.MakeAccessor(store)
+
+	return store
+}
+
+func (m *memStore) EdgeKey(edgeID edgekv.EdgeID, key string) string {
+	return edgekv.Edgekey(edgeID, key)
+}
+
+// WatchEdges 内存存储不产生变化事件，Edge 的变化由 center.CenterServer 分发
+func (m *memStore) WatchEdges(prefix string, fn edgekv.EdgeChangeFunc) {
+}
+
+func (edge *edgeStore) Get(key string) (val interface{}, ok bool) {
+	return edge.master.Get(edge.master.EdgeKey(edge.ID, key))
+}
+
+func (edge *edgeStore) Keys() []string {
+	var (
+		prefix = edge.master.EdgeKey(edge.ID, "")
+		keys   []string
+	)
+
+	for _, key := range edge.master.allKeys() {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, strings.TrimPrefix(key, prefix))
+		}
+	}
+	return keys
+}
+
+func (edge *edgeStore) Set(key string, val interface{}) (old interface{}, err error) {
+	return edge.master.Set(edge.master.EdgeKey(edge.ID, key), val)
+}
+
+func (edge *edgeStore) Delete(key string) error {
+	return edge.master.Delete(edge.master.EdgeKey(edge.ID, key))
+}
+
+var _ edgekv.Store = &edgeStore{}
@@ -1,16 +1,22 @@
 package memory
 
 import (
+	"fmt"
+	"strings"
+	"sync"
+
 	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/store/internal/storeval"
 	"github.com/hysios/mapindex"
 )
 
 type memStore struct {
 	values map[string]interface{}
+	mu     sync.RWMutex
 	edgekv.Accessor
 }
 
-func OpenMapStore() edgekv.Store {
+func OpenMapStore() edgekv.CenterStore {
 	store := &memStore{
 		values: make(map[string]interface{}),
 	}
@@ -26,7 +32,8 @@ func (m *memStore) init() {
 }
 
 func (m *memStore) Get(key string) (val interface{}, ok bool) {
-	m.init()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
 	if val = mapindex.Get(&m.values, key); val != nil {
 		ok = true
@@ -35,7 +42,21 @@ func (m *memStore) Get(key string) (val interface{}, ok bool) {
 	return
 }
 
+// Keys 返回所有模型的前缀，不包含 Edge 的键
 func (m *memStore) Keys() []string {
+	var keys []string
+	for _, key := range m.allKeys() {
+		if !strings.Contains(key, ":") {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (m *memStore) allKeys() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	var keys []string
 	for key := range m.values {
 		keys = append(keys, key)
@@ -44,6 +65,15 @@ func (m *memStore) Keys() []string {
 }
 
 func (m *memStore) Set(key string, val interface{}) (old interface{}, err error) {
+	val = storeval.Value(val)
+	if _, ok := val.(map[string]interface{}); !ok {
+		if _, field := edgekv.SplitKey(key); len(field) == 0 {
+			return nil, fmt.Errorf("memory_store: model '%s' value must be a map or struct", key)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.init()
 
 	old = mapindex.Get(&m.values, key)
@@ -51,6 +81,15 @@ func (m *memStore) Set(key string, val interface{}) (old interface{}, err error)
 	return old, nil
 }
 
+// Delete 删除键以及它下面所有的子键
+func (m *memStore) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	storeval.Delete(m.values, key)
+	return nil
+}
+
 func (m *memStore) SetSyncer(_ edgekv.MessageQueue) {
 }
 
@@ -60,4 +99,4 @@ func init() {
 	})
 }
 
-var _ edgekv.Store = &memStore{}
+var _ edgekv.CenterStore = &memStore{}
@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/store/storetest"
+)
+
+func TestMemStore(t *testing.T) {
+	storetest.TestCenterStore(t, func() edgekv.CenterStore {
+		return OpenMapStore()
+	})
+}
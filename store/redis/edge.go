@@ -35,9 +35,11 @@ func (edge *EdgeStore) Set(key string, val interface{}) (old interface{}, err er
 		fullkey = edge.master.edgeNode(edge.ID, key)
 	)
 
-	old, _ = edge.Get(key)
-	edge.master.Set(fullkey, val)
-	return old, nil
+	return edge.master.Set(fullkey, val)
+}
+
+func (edge *EdgeStore) Delete(key string) error {
+	return edge.master.Delete(edge.master.edgeNode(edge.ID, key))
 }
 
 func (edge *EdgeStore) Watch(prefix string, fn edgekv.ChangeFunc) {
@@ -5,14 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
-	"reflect"
 	"strconv"
 	"strings"
-	"time"
 
-	"github.com/fatih/structs"
 	"github.com/go-redis/redis/v8"
 	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/store/internal/storeval"
 	"github.com/hysios/edgekv/utils"
 	"github.com/hysios/log"
 	"github.com/hysios/mapindex"
@@ -111,87 +109,150 @@ func (store *RedisStore) Get(key string) (val interface{}, ok bool) {
 }
 
 func (store *RedisStore) ListKeys(prefix string) []string {
-	var ctx = context.Background()
-	keys, _, _ := store.rdb.Scan(ctx, 0, store.fullkey(prefix+"*"), -1).Result()
-	for i, key := range keys {
-		keys[i] = strings.TrimPrefix(key, store.fullkey(prefix))
+	var (
+		ctx  = context.Background()
+		iter = store.rdb.Scan(ctx, 0, store.fullkey(prefix+"*"), 0).Iterator()
+		keys []string
+	)
+
+	for iter.Next(ctx) {
+		keys = append(keys, strings.TrimPrefix(iter.Val(), store.fullkey(prefix)))
+	}
+	if err := iter.Err(); err != nil {
+		log.Debugf("redis_store: scan keys '%s' error: %s", prefix, err)
 	}
 	return keys
 }
 
+// Keys 返回所有模型的前缀，不包含 Edge 的键
 func (store *RedisStore) Keys() []string {
-	//TODO: 实现 keys
-	panic("nonimplement")
+	var keys []string
+	for _, key := range store.ListKeys("") {
+		if !strings.Contains(key, ":") {
+			keys = append(keys, key)
+		}
+	}
+	return keys
 }
 
 func (store *RedisStore) EdgeKey(edgeID edgekv.EdgeID, key string) string {
 	return edgekv.Edgekey(edgeID, key)
 }
 
-var timeType = reflect.TypeOf(new(time.Time)).Elem()
+// MaxRetries 并发写入同一模型冲突时的最大重试次数
+var MaxRetries = 100
+
+func (store *RedisStore) Set(key string, val interface{}) (old interface{}, err error) {
+	var (
+		prefix, subkey = edgekv.SplitKey(key)
+		fullkey        = store.fullkey(prefix)
+		ctx            = context.Background()
+	)
 
-func (store *RedisStore) value(val interface{}) interface{} {
-	v := reflect.ValueOf(val)
-	v = reflect.Indirect(v)
-	switch v.Kind() {
-	case reflect.Map:
-		return val
-	case reflect.Struct:
-		if v.Type() != timeType {
-			return structs.Map(val)
+	val = storeval.Value(val)
+	if _, ok := val.(map[string]interface{}); !ok && len(subkey) == 0 {
+		return nil, fmt.Errorf("redis_store: model '%s' value must be a map or struct", key)
+	}
+
+	// 使用 WATCH 乐观锁完成读取与写入，冲突时重试
+	var txf = func(tx *redis.Tx) error {
+		var (
+			m   = make(map[string]interface{})
+			raw []byte
+			b   []byte
+			err error
+		)
+
+		old = nil
+		if raw, err = tx.Get(ctx, fullkey).Bytes(); err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+
+		if len(raw) > 0 {
+			if err = utils.Unmarshal(raw, &m); err != nil {
+				return fmt.Errorf("redis_store: unmarshal error: %w", err)
+			}
+			old = m
+		}
+
+		if len(subkey) > 0 {
+			old = mapindex.Get(m, subkey)
+			mapindex.Set(&m, subkey, val, mapindex.OptOverwrite())
 		} else {
-			return val
+			m = val.(map[string]interface{})
+		}
+
+		if b, err = utils.Marshal(m); err != nil {
+			return err
 		}
-	default:
-		return val
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, fullkey, string(b), 0)
+			return nil
+		})
+		return err
 	}
+
+	for i := 0; i < MaxRetries; i++ {
+		if err = store.rdb.Watch(ctx, txf, fullkey); !errors.Is(err, redis.TxFailedErr) {
+			break
+		}
+	}
+
+	if err != nil {
+		log.Debugf("redis_store: set key %s error: %s", prefix, err)
+		return nil, err
+	}
+
+	return old, nil
 }
 
-func (store *RedisStore) Set(key string, val interface{}) (old interface{}, err error) {
+// Delete 删除键以及它下面所有的子键，键不存在时不返回错误
+func (store *RedisStore) Delete(key string) (err error) {
 	var (
 		prefix, subkey = edgekv.SplitKey(key)
-		m              = make(map[string]interface{})
-		raw            []byte
+		fullkey        = store.fullkey(prefix)
 		ctx            = context.Background()
 	)
 
-	val = store.value(val)
-
-	if raw, err = store.rdb.Get(ctx, store.fullkey(prefix)).Bytes(); err != nil {
-		log.Debugf("redis_store: get key '%s' error: %s", prefix, err)
+	if len(subkey) == 0 {
+		return store.rdb.Del(ctx, fullkey).Err()
 	}
 
-	if len(raw) > 0 {
+	// 与 Set 相同，使用 WATCH 乐观锁修改模型，冲突时重试
+	var txf = func(tx *redis.Tx) error {
+		var m = make(map[string]interface{})
+
+		raw, err := tx.Get(ctx, fullkey).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
 		if err = utils.Unmarshal(raw, &m); err != nil {
-			log.Debugf("redis_store: unmarshal error: %s", err)
-			return
+			return fmt.Errorf("redis_store: unmarshal error: %w", err)
 		}
-	}
+		storeval.Delete(m, subkey)
 
-	if len(subkey) > 0 {
-		old = mapindex.Get(m, subkey)
-		mapindex.Set(&m, subkey, val, mapindex.OptOverwrite())
-	} else {
-		old = m
-		switch x := val.(type) {
-		case map[string]interface{}:
-			m = x
-		default:
-			m = structs.Map(x)
+		b, err := utils.Marshal(m)
+		if err != nil {
+			return err
 		}
-	}
 
-	var b []byte
-	if b, err = utils.Marshal(m); err != nil {
-		return nil, err
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, fullkey, string(b), 0)
+			return nil
+		})
+		return err
 	}
 
-	if _, err := store.rdb.Set(ctx, store.fullkey(prefix), string(b), -1).Result(); err != nil {
-		// if _, err := store.rdb.Set(prefix, utils.Stringify(m), -1).Result(); err != nil {
-		log.Debugf("redis_store: set key %s error: %s", prefix, err)
+	for i := 0; i < MaxRetries; i++ {
+		if err = store.rdb.Watch(ctx, txf, fullkey); !errors.Is(err, redis.TxFailedErr) {
+			break
+		}
 	}
-
-	return
+	return err
 }
 
 func (store *RedisStore) Watch(prefix string, fn edgekv.ChangeFunc) {
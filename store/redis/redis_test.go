@@ -9,6 +9,7 @@ import (
 	"github.com/fatih/structs"
 	"github.com/go-redis/redis/v8"
 	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/store/storetest"
 	"github.com/hysios/edgekv/utils"
 	"github.com/hysios/log"
 )
@@ -172,3 +173,21 @@ func TestRedisStore_Get(t *testing.T) {
 	// bad test
 	tests.get("User.UpdatedAt", nil, false)
 }
+
+func TestRedisStore_Conformance(t *testing.T) {
+	var ctx = context.Background()
+
+	store, err := OpenRedisStore("redis://127.0.0.1:6379/storetest?db=4")
+	if err != nil {
+		t.Fatalf("open redis failed %s", err)
+	}
+
+	if err = store.rdb.Ping(ctx).Err(); err != nil {
+		t.Skipf("redis is not available: %s", err)
+	}
+
+	storetest.TestCenterStore(t, func() edgekv.CenterStore {
+		store.rdb.FlushDB(ctx)
+		return store
+	})
+}
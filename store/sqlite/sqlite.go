@@ -0,0 +1,422 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/store/internal/storeval"
+	"github.com/hysios/log"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteStore 以扁平化的键路径为行存储数据，每个叶子节点一行，
+// 例如 user.profile.money 会存储为单独的一行，读取前缀时再还原为 map
+type sqliteStore struct {
+	edgekv.Accessor
+
+	db *sql.DB
+}
+
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS edgekv (
+		key      TEXT PRIMARY KEY,
+		value    BLOB NOT NULL,
+		revision INTEGER NOT NULL
+	) WITHOUT ROWID`,
+	`CREATE INDEX IF NOT EXISTS edgekv_revision ON edgekv (revision)`,
+	`CREATE TABLE IF NOT EXISTS edgekv_meta (
+		name  TEXT PRIMARY KEY,
+		value INTEGER NOT NULL
+	)`,
+	`INSERT OR IGNORE INTO edgekv_meta (name, value) VALUES ('revision', 0)`,
+}
+
+var pragmas = []string{
+	"PRAGMA journal_mode=WAL",
+	"PRAGMA synchronous=NORMAL",
+	"PRAGMA busy_timeout=5000",
+}
+
+// OpenSqliteStore 打开 sqlite 存储，数据库以 WAL 模式打开
+func OpenSqliteStore(filename string) (*sqliteStore, error) {
+	var (
+		store = &sqliteStore{}
+		db    *sql.DB
+		err   error
+	)
+
+	if db, err = sql.Open("sqlite", filename); err != nil {
+		return nil, err
+	}
+	// sqlite 同一时间只允许一个写入者，单连接可以避免 SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	for _, stmt := range append(pragmas, schema...) {
+		if _, err = db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("sqlite_store: init database error: %w", err)
+		}
+	}
+
+	store.Accessor = edgekv.MakeAccessor(store)
+	store.db = db
+	return store, nil
+}
+
+func (store *sqliteStore) Get(key string) (val interface{}, ok bool) {
+	if err := store.View(func(tx *Tx) error {
+		val, ok = tx.Get(key)
+		return nil
+	}); err != nil {
+		log.Infof("sqlite: get key '%s' error: %s", key, err)
+		return nil, false
+	}
+	return
+}
+
+func (store *sqliteStore) Keys() []string {
+	var keys []string
+	if err := store.View(func(tx *Tx) (err error) {
+		keys, err = tx.prefixes()
+		return err
+	}); err != nil {
+		log.Infof("sqlite: list keys error: %s", err)
+		return nil
+	}
+	return keys
+}
+
+// ListKeys 列出所有以 prefix 开头的叶子键
+func (store *sqliteStore) ListKeys(prefix string) []string {
+	var keys []string
+	if err := store.View(func(tx *Tx) (err error) {
+		keys, err = tx.ListKeys(prefix)
+		return err
+	}); err != nil {
+		log.Infof("sqlite: list keys '%s' error: %s", prefix, err)
+		return nil
+	}
+	return keys
+}
+
+func (store *sqliteStore) Set(key string, val interface{}) (old interface{}, err error) {
+	err = store.Update(func(tx *Tx) error {
+		old, err = tx.Set(key, val)
+		return err
+	})
+	return
+}
+
+// Delete 删除键以及它下面所有的子键
+func (store *sqliteStore) Delete(key string) error {
+	return store.Update(func(tx *Tx) error {
+		return tx.Delete(key)
+	})
+}
+
+// Revision 返回当前数据库的修订号，每次写入事务提交后递增
+func (store *sqliteStore) Revision() int64 {
+	var rev int64
+	if err := store.View(func(tx *Tx) (err error) {
+		rev, err = tx.Revision()
+		return err
+	}); err != nil {
+		log.Infof("sqlite: read revision error: %s", err)
+	}
+	return rev
+}
+
+// View 在只读事务中执行 fn
+func (store *sqliteStore) View(fn func(tx *Tx) error) error {
+	return store.txn(false, fn)
+}
+
+// Update 在读写事务中执行 fn, fn 返回错误时回滚
+func (store *sqliteStore) Update(fn func(tx *Tx) error) error {
+	return store.txn(true, fn)
+}
+
+func (store *sqliteStore) txn(writable bool, fn func(tx *Tx) error) error {
+	sqltx, err := store.db.Begin()
+	if err != nil {
+		return fmt.Errorf("sqlite_store: begin transaction error: %w", err)
+	}
+
+	var tx = &Tx{tx: sqltx, writable: writable}
+	if err = fn(tx); err != nil {
+		sqltx.Rollback()
+		return err
+	}
+
+	if !writable {
+		return sqltx.Rollback()
+	}
+	return sqltx.Commit()
+}
+
+func (store *sqliteStore) Close() error {
+	return store.db.Close()
+}
+
+var (
+	ErrTxNotWritable = errors.New("sqlite_store: tx not writable")
+	ErrInvalidModel  = errors.New("sqlite_store: model value must be a map or struct")
+)
+
+// Tx 是 sqlite 存储上的事务
+type Tx struct {
+	tx       *sql.Tx
+	writable bool
+	revision int64
+}
+
+// Get 读取键值，如果键是叶子节点直接返回，否则使用前缀查询还原成 map
+func (tx *Tx) Get(key string) (val interface{}, ok bool) {
+	var raw []byte
+	switch err := tx.tx.QueryRow(`SELECT value FROM edgekv WHERE key = ?`, key).Scan(&raw); {
+	case err == nil:
+		if val, err = storeval.Decode(raw); err != nil {
+			log.Infof("sqlite: decode key '%s' error: %s", key, err)
+			return nil, false
+		}
+		return val, true
+	case !errors.Is(err, sql.ErrNoRows):
+		log.Infof("sqlite: get key '%s' error: %s", key, err)
+		return nil, false
+	}
+
+	rows, err := tx.scan(key)
+	if err != nil {
+		log.Infof("sqlite: get key '%s' error: %s", key, err)
+		return nil, false
+	}
+
+	if len(rows) == 0 {
+		return nil, false
+	}
+
+	return unflatten(rows), true
+}
+
+// ListKeys 列出所有以 prefix 开头的叶子键, prefix 为空时列出全部
+func (tx *Tx) ListKeys(prefix string) ([]string, error) {
+	var (
+		rows *sql.Rows
+		keys []string
+		err  error
+	)
+
+	if len(prefix) == 0 {
+		rows, err = tx.tx.Query(`SELECT key FROM edgekv ORDER BY key`)
+	} else {
+		lo, hi := prefixRange(prefix)
+		rows, err = tx.tx.Query(`SELECT key FROM edgekv WHERE key = ? OR (key >= ? AND key < ?) ORDER BY key`, prefix, lo, hi)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// Set 写入键值, 返回写入前的旧值
+func (tx *Tx) Set(key string, val interface{}) (old interface{}, err error) {
+	if !tx.writable {
+		return nil, ErrTxNotWritable
+	}
+
+	val = storeval.Value(val)
+	if _, field := edgekv.SplitKey(key); len(field) == 0 {
+		if _, ok := val.(map[string]interface{}); !ok {
+			return nil, ErrInvalidModel
+		}
+	}
+
+	old, _ = tx.Get(key)
+
+	if err = tx.Delete(key); err != nil {
+		return nil, err
+	}
+
+	// 覆盖父级的叶子节点，例如 test.id 原本是数值，现在要写入 test.id.value
+	for parent, field := edgekv.SplitLastKey(key); len(field) > 0; parent, field = edgekv.SplitLastKey(parent) {
+		if _, err = tx.tx.Exec(`DELETE FROM edgekv WHERE key = ?`, parent); err != nil {
+			return nil, err
+		}
+	}
+
+	var rev int64
+	if rev, err = tx.nextRevision(); err != nil {
+		return nil, err
+	}
+
+	var leaves = make(map[string]interface{})
+	flatten(key, val, leaves)
+	for leaf, v := range leaves {
+		var b []byte
+		if b, err = storeval.Encode(v); err != nil {
+			return nil, fmt.Errorf("sqlite_store: marshal key '%s' error: %w", leaf, err)
+		}
+
+		if _, err = tx.tx.Exec(`INSERT INTO edgekv (key, value, revision) VALUES (?, ?, ?)`, leaf, b, rev); err != nil {
+			return nil, err
+		}
+	}
+
+	return old, nil
+}
+
+// Delete 删除键以及它下面所有的子键
+func (tx *Tx) Delete(key string) error {
+	if !tx.writable {
+		return ErrTxNotWritable
+	}
+
+	if _, err := tx.nextRevision(); err != nil {
+		return err
+	}
+
+	lo, hi := prefixRange(key)
+	_, err := tx.tx.Exec(`DELETE FROM edgekv WHERE key = ? OR (key >= ? AND key < ?)`, key, lo, hi)
+	return err
+}
+
+// Revision 返回当前的修订号
+func (tx *Tx) Revision() (rev int64, err error) {
+	err = tx.tx.QueryRow(`SELECT value FROM edgekv_meta WHERE name = 'revision'`).Scan(&rev)
+	return
+}
+
+// nextRevision 同一个事务内只递增一次修订号
+func (tx *Tx) nextRevision() (int64, error) {
+	if tx.revision > 0 {
+		return tx.revision, nil
+	}
+
+	if _, err := tx.tx.Exec(`UPDATE edgekv_meta SET value = value + 1 WHERE name = 'revision'`); err != nil {
+		return 0, err
+	}
+
+	rev, err := tx.Revision()
+	if err != nil {
+		return 0, err
+	}
+	tx.revision = rev
+	return rev, nil
+}
+
+func (tx *Tx) scan(prefix string) (map[string]interface{}, error) {
+	lo, hi := prefixRange(prefix)
+	rows, err := tx.tx.Query(`SELECT key, value FROM edgekv WHERE key >= ? AND key < ?`, lo, hi)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out = make(map[string]interface{})
+	for rows.Next() {
+		var (
+			key string
+			raw []byte
+		)
+		if err = rows.Scan(&key, &raw); err != nil {
+			return nil, err
+		}
+
+		if out[strings.TrimPrefix(key, lo)], err = storeval.Decode(raw); err != nil {
+			return nil, fmt.Errorf("sqlite_store: decode key '%s' error: %w", key, err)
+		}
+	}
+
+	return out, rows.Err()
+}
+
+func (tx *Tx) prefixes() ([]string, error) {
+	keys, err := tx.ListKeys("")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		seen     = make(map[string]bool)
+		prefixes []string
+	)
+	for _, key := range keys {
+		prefix, _ := edgekv.SplitKey(key)
+		if !seen[prefix] {
+			seen[prefix] = true
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	sort.Strings(prefixes)
+	return prefixes, nil
+}
+
+// prefixRange 返回 prefix 所有子键的区间 [prefix., prefix/), '/' 是 '.' 的下一个字符,
+// 这样前缀查询可以走主键索引
+func prefixRange(prefix string) (lo, hi string) {
+	return prefix + ".", prefix + "/"
+}
+
+// flatten 把嵌套的 map 展开为叶子节点，空 map 与其它值一样作为叶子存储
+func flatten(key string, val interface{}, out map[string]interface{}) {
+	m, ok := val.(map[string]interface{})
+	if !ok || len(m) == 0 {
+		out[key] = val
+		return
+	}
+
+	for k, v := range m {
+		flatten(key+"."+k, storeval.Value(v), out)
+	}
+}
+
+func unflatten(rows map[string]interface{}) map[string]interface{} {
+	var out = make(map[string]interface{})
+	for key, val := range rows {
+		var (
+			m     = out
+			paths = strings.Split(key, ".")
+		)
+		for _, p := range paths[:len(paths)-1] {
+			sub, ok := m[p].(map[string]interface{})
+			if !ok {
+				sub = make(map[string]interface{})
+				m[p] = sub
+			}
+			m = sub
+		}
+		m[paths[len(paths)-1]] = val
+	}
+	return out
+}
+
+func init() {
+	edgekv.RegisterStore("sqlite", func(args ...string) (edgekv.Store, error) {
+		if len(args) < 1 {
+			return nil, fmt.Errorf("missing open filename of sqlite")
+		}
+
+		if store, err := OpenSqliteStore(args[0]); err != nil {
+			return nil, fmt.Errorf("sqlite_store: open sqlite error %w", err)
+		} else {
+			return store, nil
+		}
+	})
+}
+
+var _ edgekv.Store = &sqliteStore{}
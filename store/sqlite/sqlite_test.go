@@ -0,0 +1,175 @@
+package sqlite
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fatih/structs"
+	"github.com/hysios/edgekv"
+	"github.com/hysios/edgekv/store/storetest"
+	"github.com/stretchr/testify/assert"
+)
+
+type Map = map[string]interface{}
+
+func testServer(t *testing.T) edgekv.Store {
+	store := openStore(t)
+
+	loadData(store, Map{
+		"test": Map{
+			"id":        1234,
+			"createdAt": time.Date(2020, 1, 2, 12, 59, 59, 0, time.UTC),
+			"on":        true,
+		},
+		"user": Map{
+			"username": "Bob",
+			"sex":      "male",
+			"avatar": []string{
+				"http://example.com/avatar1.jpg",
+				"http://example.com/avatar2.jpg",
+			},
+			"profile": Map{
+				"money": 1234.00,
+				"friends": []interface{}{
+					Map{"id": 1, "memoname": "Jim"},
+					Map{"id": 1},
+				},
+			},
+		},
+	})
+
+	return store
+}
+
+func loadData(store edgekv.Store, val interface{}) {
+	var vals Map
+
+	if _v, ok := val.(map[string]interface{}); ok {
+		vals = _v
+	} else {
+		vals = structs.Map(val)
+	}
+
+	for key, val := range vals {
+		store.Set(key, val)
+	}
+}
+
+func Test_sqliteStore_Get(t *testing.T) {
+	store := testServer(t)
+	v, ok := store.Get("_notfoundkey")
+	assert.False(t, ok)
+	assert.Nil(t, v)
+
+	b := store.GetBool("test.on")
+	assert.True(t, b)
+
+	tt := store.GetTime("test.createdAt")
+	assert.Equal(t, tt, time.Date(2020, 1, 2, 12, 59, 59, 0, time.UTC))
+
+	id := store.GetInt("test.id")
+	assert.Equal(t, id, 1234)
+
+	username := store.GetString("user.username")
+	assert.Equal(t, username, "Bob")
+
+	money := store.GetFloat64("user.profile.money")
+	assert.Equal(t, money, 1234.0)
+
+	v, ok = store.Get("test")
+	assert.True(t, ok)
+	t.Logf("test: %v", v)
+}
+
+func Test_sqliteStore_Set(t *testing.T) {
+	store := testServer(t)
+
+	store.Set("test.id", 1235)
+
+	assert.Equal(t, store.GetInt("test.id"), 1235)
+	assert.NotEqual(t, store.GetInt("test.id"), 1236)
+
+	m, ok := store.Get("test")
+	assert.True(t, ok)
+	assert.Equal(t, m, map[string]interface{}{"createdAt": time.Date(2020, 1, 2, 12, 59, 59, 0, time.UTC), "id": 1235, "on": true})
+
+	store.Set("user.profile.money", 10000.00)
+	assert.Equal(t, store.GetFloat64("user.profile.money"), 10000.0)
+
+	old, err := store.Set("test", map[string]interface{}{
+		"name":      "Alice",
+		"age":       18,
+		"updatedAt": time.Date(2020, 1, 24, 23, 59, 59, 0, time.UTC),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, old, m)
+
+	v, ok := store.Get("test")
+	assert.True(t, ok)
+	assert.Equal(t, v, map[string]interface{}{"name": "Alice", "age": 18, "updatedAt": time.Date(2020, 1, 24, 23, 59, 59, 0, time.UTC)})
+
+	store.Set("test.age.years", 18)
+	assert.Equal(t, store.GetInt("test.age.years"), 18)
+	assert.Equal(t, store.GetStringMap("test.age"), map[string]interface{}{"years": 18})
+}
+
+func Test_sqliteStore_Keys(t *testing.T) {
+	store := testServer(t)
+
+	keys := store.AllKeys()
+	assert.Equal(t, keys, []string{"test", "user"})
+	t.Logf("keys %v", keys)
+
+	leaves := store.(*sqliteStore).ListKeys("user.profile")
+	assert.Equal(t, leaves, []string{"user.profile.friends", "user.profile.money"})
+}
+
+func Test_sqliteStore_Update(t *testing.T) {
+	store := testServer(t).(*sqliteStore)
+	rev := store.Revision()
+
+	err := store.Update(func(tx *Tx) error {
+		tx.Set("test.on", false)
+		tx.Set("test.id", 0)
+		return os.ErrInvalid
+	})
+	assert.Equal(t, err, os.ErrInvalid)
+	assert.True(t, store.GetBool("test.on"))
+	assert.Equal(t, store.GetInt("test.id"), 1234)
+	assert.Equal(t, store.Revision(), rev)
+
+	err = store.Update(func(tx *Tx) error {
+		if _, err := tx.Set("test.on", false); err != nil {
+			return err
+		}
+		return tx.Delete("user.profile")
+	})
+	assert.NoError(t, err)
+	assert.False(t, store.GetBool("test.on"))
+	assert.Nil(t, store.GetStringMap("user.profile"))
+	assert.Equal(t, store.Revision(), rev+1)
+
+	err = store.View(func(tx *Tx) error {
+		_, err := tx.Set("test.on", true)
+		return err
+	})
+	assert.Equal(t, err, ErrTxNotWritable)
+}
+
+func Test_sqliteStore_Conformance(t *testing.T) {
+	storetest.TestStore(t, func() edgekv.Store {
+		return openStore(t)
+	})
+}
+
+// openStore 在测试的临时目录中打开一个空的存储，测试结束后关闭
+func openStore(t *testing.T) *sqliteStore {
+	store, err := OpenSqliteStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store error %s", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
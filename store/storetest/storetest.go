@@ -0,0 +1,336 @@
+// Package storetest 提供 edgekv.Store 与 edgekv.CenterStore 实现的一致性测试,
+// 每个存储后端在自己的测试中调用 TestStore / TestCenterStore 即可。
+//
+// 所有实现需要满足以下语义:
+//  1. Get 不存在的模型或字段返回 (nil, false)
+//  2. Set 返回写入前的旧值，不存在时返回 nil
+//  3. 结构体按 structs.Map 转换为 map 存储，读取时返回 map[string]interface{}
+//  4. time.Time 与 time.Duration 读写后类型保持不变
+//  5. AllKeys 返回所有模型的前缀，顺序不作要求
+//  6. 并发写入同一模型的不同字段不会丢失更新
+//  7. 模型(没有 . 的键)的值必须是 map 或结构体，否则 Set 返回错误
+//  8. 实现 edgekv.Deleter 的存储删除键以及它下面所有的子键，键不存在时不返回错误
+package storetest
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fatih/structs"
+	"github.com/hysios/edgekv"
+	"github.com/stretchr/testify/assert"
+)
+
+type Map = map[string]interface{}
+
+// OpenFunc 每次调用返回一个全新的、空的存储
+type OpenFunc func() edgekv.Store
+
+// OpenCenterFunc 每次调用返回一个全新的、空的中心存储
+type OpenCenterFunc func() edgekv.CenterStore
+
+type testUser struct {
+	Username  string
+	Age       int
+	CreatedAt time.Time
+	Timeout   time.Duration
+	Tags      []string
+	Profile   testProfile
+}
+
+type testProfile struct {
+	Money float64
+	Email string
+}
+
+var createdAt = time.Date(2020, 1, 2, 12, 59, 59, 0, time.UTC)
+
+func newUser() testUser {
+	return testUser{
+		Username:  "Bob",
+		Age:       18,
+		CreatedAt: createdAt,
+		Timeout:   34 * time.Second,
+		Tags:      []string{"high", "middle"},
+		Profile: testProfile{
+			Money: 1234.5,
+			Email: "bob@example.com",
+		},
+	}
+}
+
+// TestStore 对 open 返回的存储运行所有一致性测试
+func TestStore(t *testing.T, open OpenFunc) {
+	t.Run("NotFound", func(t *testing.T) { testNotFound(t, open()) })
+	t.Run("Nested", func(t *testing.T) { testNested(t, open()) })
+	t.Run("Struct", func(t *testing.T) { testStruct(t, open()) })
+	t.Run("Types", func(t *testing.T) { testTypes(t, open()) })
+	t.Run("Overwrite", func(t *testing.T) { testOverwrite(t, open()) })
+	t.Run("Keys", func(t *testing.T) { testKeys(t, open()) })
+	t.Run("Concurrent", func(t *testing.T) { testConcurrent(t, open()) })
+	t.Run("InvalidModel", func(t *testing.T) { testInvalidModel(t, open()) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, open()) })
+}
+
+// TestCenterStore 对 open 返回的中心存储运行一致性测试，包括每个 Edge 打开的存储
+func TestCenterStore(t *testing.T, open OpenCenterFunc) {
+	TestStore(t, func() edgekv.Store {
+		return open()
+	})
+
+	t.Run("Edge", func(t *testing.T) {
+		TestStore(t, func() edgekv.Store {
+			return open().OpenEdge("STORETEST")
+		})
+	})
+
+	t.Run("EdgeIsolation", func(t *testing.T) { testEdgeIsolation(t, open()) })
+}
+
+func testNotFound(t *testing.T, store edgekv.Store) {
+	val, ok := store.Get("_notfound")
+	assert.False(t, ok)
+	assert.Nil(t, val)
+
+	val, ok = store.Get("_notfound.field")
+	assert.False(t, ok)
+	assert.Nil(t, val)
+
+	_, err := store.Set("test", Map{"on": true})
+	assert.NoError(t, err)
+
+	val, ok = store.Get("test.off")
+	assert.False(t, ok)
+	assert.Nil(t, val)
+
+	assert.Equal(t, store.GetString("test.off"), "")
+	assert.Equal(t, store.GetInt("_notfound.id"), 0)
+}
+
+func testNested(t *testing.T, store edgekv.Store) {
+	_, err := store.Set("user", Map{
+		"username": "Bob",
+		"profile": Map{
+			"money": 1234.0,
+			"org": Map{
+				"name": "edgekv",
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, store.GetString("user.username"), "Bob")
+	assert.Equal(t, store.GetFloat64("user.profile.money"), 1234.0)
+	assert.Equal(t, store.GetString("user.profile.org.name"), "edgekv")
+
+	_, err = store.Set("user.profile.org.name", "hysios")
+	assert.NoError(t, err)
+	assert.Equal(t, store.GetString("user.profile.org.name"), "hysios")
+	assert.Equal(t, store.GetFloat64("user.profile.money"), 1234.0)
+
+	_, err = store.Set("user.profile.level", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, store.GetInt("user.profile.level"), 3)
+
+	profile := store.GetStringMap("user.profile")
+	assert.Equal(t, profile["money"], 1234.0)
+	assert.Equal(t, profile["level"], 3)
+	assert.Equal(t, profile["org"], Map{"name": "hysios"})
+
+	val, ok := store.Get("user")
+	assert.True(t, ok)
+	assert.Equal(t, val, Map{
+		"username": "Bob",
+		"profile": Map{
+			"money": 1234.0,
+			"level": 3,
+			"org":   Map{"name": "hysios"},
+		},
+	})
+}
+
+func testStruct(t *testing.T, store edgekv.Store) {
+	var user = newUser()
+	_, err := store.Set("user", user)
+	assert.NoError(t, err)
+
+	assert.Equal(t, store.GetString("user.Username"), "Bob")
+	assert.Equal(t, store.GetInt("user.Age"), 18)
+	assert.Equal(t, store.GetStringSlice("user.Tags"), []string{"high", "middle"})
+	assert.Equal(t, store.GetFloat64("user.Profile.Money"), 1234.5)
+	assert.Equal(t, store.GetString("user.Profile.Email"), "bob@example.com")
+
+	val, ok := store.Get("user")
+	assert.True(t, ok)
+	assert.IsType(t, Map{}, val)
+	assert.Equal(t, val, structs.Map(user))
+
+	_, err = store.Set("user.Profile", testProfile{Money: 1, Email: "alice@example.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, store.GetString("user.Profile.Email"), "alice@example.com")
+	assert.Equal(t, store.GetStringMap("user.Profile"), Map{"Money": 1.0, "Email": "alice@example.com"})
+}
+
+func testTypes(t *testing.T, store edgekv.Store) {
+	_, err := store.Set("types", newUser())
+	assert.NoError(t, err)
+
+	assert.Equal(t, store.GetTime("types.CreatedAt"), createdAt)
+	assert.Equal(t, store.GetDuration("types.Timeout"), 34*time.Second)
+
+	val, ok := store.Get("types.CreatedAt")
+	assert.True(t, ok)
+	assert.IsType(t, time.Time{}, val)
+
+	val, ok = store.Get("types.Timeout")
+	assert.True(t, ok)
+	assert.IsType(t, time.Duration(0), val)
+
+	var updatedAt = time.Date(2021, 4, 5, 6, 7, 8, 0, time.UTC)
+	_, err = store.Set("types.UpdatedAt", updatedAt)
+	assert.NoError(t, err)
+	assert.Equal(t, store.GetTime("types.UpdatedAt"), updatedAt)
+
+	_, err = store.Set("types.Timeout", 5*time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, store.GetDuration("types.Timeout"), 5*time.Minute)
+
+	_, err = store.Set("types.On", true)
+	assert.NoError(t, err)
+	assert.True(t, store.GetBool("types.On"))
+}
+
+func testOverwrite(t *testing.T, store edgekv.Store) {
+	old, err := store.Set("test", Map{"id": 1234, "on": true})
+	assert.NoError(t, err)
+	assert.Nil(t, old)
+
+	old, err = store.Set("test.id", 1235)
+	assert.NoError(t, err)
+	assert.Equal(t, old, 1234)
+
+	old, err = store.Set("test.name", "Alice")
+	assert.NoError(t, err)
+	assert.Nil(t, old)
+
+	old, err = store.Set("test", Map{"id": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, old, Map{"id": 1235, "on": true, "name": "Alice"})
+
+	val, ok := store.Get("test")
+	assert.True(t, ok)
+	assert.Equal(t, val, Map{"id": 1})
+
+	_, ok = store.Get("test.on")
+	assert.False(t, ok)
+}
+
+func testKeys(t *testing.T, store edgekv.Store) {
+	for _, key := range []string{"test", "user", "device"} {
+		_, err := store.Set(key, Map{"id": 1})
+		assert.NoError(t, err)
+	}
+	_, err := store.Set("user.profile.money", 1.0)
+	assert.NoError(t, err)
+
+	keys := store.AllKeys()
+	sort.Strings(keys)
+	assert.Equal(t, keys, []string{"device", "test", "user"})
+}
+
+func testConcurrent(t *testing.T, store edgekv.Store) {
+	const n = 16
+
+	_, err := store.Set("counter", Map{"total": n})
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			_, err := store.Set(fmt.Sprintf("counter.k%d", i), i)
+			assert.NoError(t, err)
+		}(i)
+
+		go func() {
+			defer wg.Done()
+			store.Get("counter")
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < n; i++ {
+		assert.Equal(t, store.GetInt(fmt.Sprintf("counter.k%d", i)), i, "counter.k%d", i)
+	}
+	assert.Equal(t, store.GetInt("counter.total"), n)
+}
+
+func testInvalidModel(t *testing.T, store edgekv.Store) {
+	for _, val := range []interface{}{1, "on", true, []string{"a"}, createdAt} {
+		_, err := store.Set("model", val)
+		assert.Error(t, err, "%v", val)
+	}
+
+	_, ok := store.Get("model")
+	assert.False(t, ok)
+
+	// 模型的字段可以是任意值
+	_, err := store.Set("model", Map{"on": true})
+	assert.NoError(t, err)
+	_, err = store.Set("model.on", false)
+	assert.NoError(t, err)
+	assert.False(t, store.GetBool("model.on"))
+}
+
+func testDelete(t *testing.T, store edgekv.Store) {
+	deleter, ok := store.(edgekv.Deleter)
+	if !ok {
+		t.Skipf("%T does not implement edgekv.Deleter", store)
+	}
+
+	_, err := store.Set("user", newUser())
+	assert.NoError(t, err)
+	_, err = store.Set("other", Map{"on": true})
+	assert.NoError(t, err)
+
+	assert.NoError(t, deleter.Delete("user.Profile"))
+	_, ok = store.Get("user.Profile.Email")
+	assert.False(t, ok)
+	_, ok = store.Get("user.Profile")
+	assert.False(t, ok)
+	assert.Equal(t, store.GetString("user.Username"), "Bob")
+
+	assert.NoError(t, deleter.Delete("user"))
+	_, ok = store.Get("user")
+	assert.False(t, ok)
+	_, ok = store.Get("user.Username")
+	assert.False(t, ok)
+	assert.True(t, store.GetBool("other.on"))
+
+	// 删除不存在的键
+	assert.NoError(t, deleter.Delete("user"))
+	assert.NoError(t, deleter.Delete("_notfound.field"))
+	assert.NoError(t, deleter.Delete("other.off.field"))
+}
+
+func testEdgeIsolation(t *testing.T, center edgekv.CenterStore) {
+	var (
+		edgeA = center.OpenEdge("STORETEST_A")
+		edgeB = center.OpenEdge("STORETEST_B")
+	)
+
+	_, err := edgeA.Set("test", Map{"on": true})
+	assert.NoError(t, err)
+
+	assert.True(t, edgeA.GetBool("test.on"))
+
+	_, ok := edgeB.Get("test.on")
+	assert.False(t, ok)
+
+	assert.True(t, center.GetBool(center.EdgeKey("STORETEST_A", "test.on")))
+	assert.Equal(t, edgeA.AllKeys(), []string{"test"})
+}
@@ -1,8 +1,13 @@
 package stream
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math/rand"
+	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -18,9 +23,22 @@ const (
 
 	// Send pings to peer with this period. Must be less than pongWait.
 	pingPeriod = (pongWait * 9) / 10
+)
+
+var (
+	// DefaultMaxMessageSize 默认允许对方发送的最大消息长度
+	DefaultMaxMessageSize int64 = 4096 * 10
+	// DefaultMinBackoff 断线后第一次重连前等待的时间，之后每次失败加倍
+	DefaultMinBackoff = 500 * time.Millisecond
+	// DefaultMaxBackoff 重连等待时间的上限
+	DefaultMaxBackoff = 30 * time.Second
+	// DefaultSendQueue 发送队列的默认大小
+	DefaultSendQueue = 256
+)
 
-	// Maximum message size allowed from peer.
-	maxMessageSize = 4096 * 10
+var (
+	ErrClosed        = errors.New("stream_client: client closed")
+	ErrSendQueueFull = errors.New("stream_client: send queue full")
 )
 
 type MessageType int
@@ -32,16 +50,149 @@ const (
 
 type MessageFunc func(typ MessageType, msg []byte)
 
+// State 连接状态
+type State int
+
+const (
+	StateIdle State = iota
+	StateConnecting
+	StateConnected
+	StateDisconnected
+	StateClosed
+)
+
+var stateNames = map[State]string{
+	StateIdle:         "idle",
+	StateConnecting:   "connecting",
+	StateConnected:    "connected",
+	StateDisconnected: "disconnected",
+	StateClosed:       "closed",
+}
+
+func (s State) String() string {
+	return stateNames[s]
+}
+
+// Client websocket 消息流的客户端，连接断开后按指数退避自动重连，
+// 断线期间发送的消息保存在发送队列中，重连之后继续发送
 type Client struct {
-	URL url.URL
+	URL    url.URL
+	Dialer *websocket.Dialer
+	Header http.Header
+
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// SendTimeout 发送队列满时 Send 等待的最长时间, 为 0 时立即返回 ErrSendQueueFull
+	SendTimeout time.Duration
 
-	conn    *websocket.Conn
-	send    chan []byte
+	// MaxMessageSize 允许对方发送的最大消息长度，超过时断开连接
+	MaxMessageSize int64
+	// ReadBufferSize 与 WriteBufferSize 为 0 时使用 Dialer 或 Upgrader 的设置
+	ReadBufferSize  int
+	WriteBufferSize int
+	// Compression 协商 permessage-deflate 压缩，对方不支持时不压缩
+	Compression      bool
+	CompressionLevel int
+	// TextMessages 以文本帧发送消息，便于浏览器等直接读取字符串，消息必须是 UTF-8
+	TextMessages bool
+
+	mu      sync.RWMutex
+	state   State
 	handler MessageFunc
+	// waitHandler 为 true 时 (服务端) 读取的消息等待 Message 设置回调之后再处理，
+	// 避免 Upgrade 返回之前对方发送的消息因为没有回调而丢弃
+	waitHandler bool
+	handlerSet  chan struct{}
+	onConnect   []func() error
+	onState     []func(State)
+
+	send      chan []byte
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+
+	// retry 从队列取出后写入失败的消息，下一个连接首先发送; 只在 writePump 中访问,
+	// 同一时间只有一个连接的 writePump 在运行
+	retry []byte
+}
+
+type ClientOpt func(client *Client)
+
+// WithDialer 使用自定义的 Dialer, 例如通过 unix socket 连接
+func WithDialer(dialer *websocket.Dialer) ClientOpt {
+	return func(client *Client) {
+		client.Dialer = dialer
+	}
+}
+
+// WithBackoff 设置重连等待时间的范围
+func WithBackoff(min, max time.Duration) ClientOpt {
+	return func(client *Client) {
+		client.MinBackoff = min
+		client.MaxBackoff = max
+	}
+}
+
+// WithSendQueue 设置发送队列的大小
+func WithSendQueue(size int) ClientOpt {
+	return func(client *Client) {
+		client.send = make(chan []byte, size)
+	}
+}
+
+// WithMaxMessageSize 设置允许对方发送的最大消息长度
+func WithMaxMessageSize(size int64) ClientOpt {
+	return func(client *Client) {
+		client.MaxMessageSize = size
+	}
+}
+
+// WithBufferSize 设置连接的读写缓冲大小
+func WithBufferSize(read, write int) ClientOpt {
+	return func(client *Client) {
+		client.ReadBufferSize = read
+		client.WriteBufferSize = write
+	}
+}
+
+// WithCompression 开启 permessage-deflate 压缩, level 为 flate 的压缩级别，0 使用默认级别
+func WithCompression(level int) ClientOpt {
+	return func(client *Client) {
+		client.Compression = true
+		client.CompressionLevel = level
+	}
+}
+
+// WithTextMessages 以文本帧发送消息
+func WithTextMessages() ClientOpt {
+	return func(client *Client) {
+		client.TextMessages = true
+	}
 }
 
-func NewClient(uri string) (*Client, error) {
-	var client = &Client{}
+// WithSendTimeout 设置发送队列满时 Send 等待的最长时间
+func WithSendTimeout(timeout time.Duration) ClientOpt {
+	return func(client *Client) {
+		client.SendTimeout = timeout
+	}
+}
+
+func newClient() *Client {
+	var client = &Client{
+		Dialer:         websocket.DefaultDialer,
+		MinBackoff:     DefaultMinBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+		MaxMessageSize: DefaultMaxMessageSize,
+		send:           make(chan []byte, DefaultSendQueue),
+		handlerSet:     make(chan struct{}),
+	}
+	client.ctx, client.cancel = context.WithCancel(context.Background())
+	return client
+}
+
+func NewClient(uri string, opts ...ClientOpt) (*Client, error) {
+	var client = newClient()
 
 	u, err := url.Parse(uri)
 	if err != nil {
@@ -54,7 +205,10 @@ func NewClient(uri string) (*Client, error) {
 	}
 
 	client.URL = *u
-	client.send = make(chan []byte, 256)
+	for _, opt := range opts {
+		opt(client)
+	}
+
 	if err = client.Connect(); err != nil {
 		return nil, err
 	}
@@ -62,23 +216,182 @@ func NewClient(uri string) (*Client, error) {
 	return client, nil
 }
 
+// Connect 建立第一次连接，之后在后台保持连接直到 Close
 func (client *Client) Connect() error {
+	conn, err := client.dial()
+	if err != nil {
+		return err
+	}
+
+	client.wg.Add(1)
+	go client.run(conn)
+	return nil
+}
+
+func (client *Client) dial() (*websocket.Conn, error) {
+	client.setState(StateConnecting)
 	log.Infof("connecting to %s", client.URL.String())
 
-	c, _, err := websocket.DefaultDialer.Dial(client.URL.String(), nil)
+	var dialer = *client.Dialer
+	if client.ReadBufferSize > 0 {
+		dialer.ReadBufferSize = client.ReadBufferSize
+	}
+	if client.WriteBufferSize > 0 {
+		dialer.WriteBufferSize = client.WriteBufferSize
+	}
+	dialer.EnableCompression = dialer.EnableCompression || client.Compression
+
+	c, _, err := dialer.DialContext(client.ctx, client.URL.String(), client.Header)
 	if err != nil {
-		return fmt.Errorf("stream_client: dial error: %w", err)
+		client.setState(StateDisconnected)
+		return nil, fmt.Errorf("stream_client: dial error: %w", err)
 	}
 
-	client.conn = c
-	// client.send = make(chan []byte, 256)
-	go client.readPump()
-	go client.writePump()
-	return nil
+	client.setState(StateConnected)
+	return c, nil
 }
 
+// run 处理连接，连接断开后重连，直到 Close
+func (client *Client) run(conn *websocket.Conn) {
+	defer client.wg.Done()
+
+	for conn != nil {
+		client.serve(conn)
+		if client.closed() {
+			return
+		}
+
+		client.setState(StateDisconnected)
+		conn = client.redial()
+	}
+}
+
+func (client *Client) redial() *websocket.Conn {
+	var backoff = client.MinBackoff
+
+	for {
+		// 加入 ±20% 的随机抖动，避免大量客户端同时重连
+		wait := backoff + time.Duration((rand.Float64()*0.4-0.2)*float64(backoff))
+		select {
+		case <-client.ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+
+		conn, err := client.dial()
+		if err == nil {
+			return conn
+		}
+		log.Errorf("%s, retry in %s", err, backoff)
+
+		if backoff *= 2; backoff > client.MaxBackoff {
+			backoff = client.MaxBackoff
+		}
+	}
+}
+
+// serve 运行连接的读写循环，连接断开或者 Close 时返回
+func (client *Client) serve(conn *websocket.Conn) {
+	conn.SetReadLimit(client.MaxMessageSize)
+	if client.Compression {
+		// 没有协商压缩的连接上不起作用
+		conn.EnableWriteCompression(true)
+		if client.CompressionLevel != 0 {
+			if err := conn.SetCompressionLevel(client.CompressionLevel); err != nil {
+				log.Errorf("stream_client: %s", err)
+			}
+		}
+	}
+
+	var (
+		stop = make(chan struct{})
+		wg   sync.WaitGroup
+	)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		client.writePump(conn, stop)
+	}()
+
+	go client.registered(conn)
+
+	client.readPump(conn)
+	close(stop)
+	wg.Wait()
+}
+
+// registered 调用连接建立之后的钩子，失败时断开连接重试
+func (client *Client) registered(conn *websocket.Conn) {
+	client.mu.RLock()
+	hooks := client.onConnect
+	client.mu.RUnlock()
+
+	for _, fn := range hooks {
+		if err := fn(); err != nil {
+			log.Errorf("stream_client: connect hook error %s", err)
+			conn.Close()
+			return
+		}
+	}
+}
+
+func (client *Client) closed() bool {
+	select {
+	case <-client.ctx.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+func (client *Client) shutdown() {
+	client.closeOnce.Do(client.cancel)
+}
+
+// Close 停止重连与读写循环，队列中未发送的消息被丢弃，不能在消息回调中调用
 func (client *Client) Close() error {
-	return client.conn.Close()
+	client.shutdown()
+	client.wg.Wait()
+	client.setState(StateClosed)
+	return nil
+}
+
+// OnConnect 添加连接 (重新) 建立之后调用的钩子，用于重新注册订阅等状态，
+// 钩子返回错误时断开连接并重试
+func (client *Client) OnConnect(fn func() error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.onConnect = append(client.onConnect, fn)
+}
+
+// OnState 添加连接状态变化的回调
+func (client *Client) OnState(fn func(State)) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.onState = append(client.onState, fn)
+}
+
+// State 返回当前的连接状态
+func (client *Client) State() State {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+	return client.state
+}
+
+func (client *Client) setState(state State) {
+	client.mu.Lock()
+	if client.state == state || client.state == StateClosed {
+		client.mu.Unlock()
+		return
+	}
+	client.state = state
+	callbacks := client.onState
+	client.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn(state)
+	}
 }
 
 var mtConverts = map[int]MessageType{
@@ -86,16 +399,13 @@ var mtConverts = map[int]MessageType{
 	2: StBinary,
 }
 
-func (client *Client) readPump() {
-	defer func() {
-		// client.hub.unregister <- c
-		client.conn.Close()
-	}()
-	client.conn.SetReadLimit(maxMessageSize)
-	client.conn.SetReadDeadline(time.Now().Add(pongWait))
-	client.conn.SetPongHandler(func(string) error { client.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+func (client *Client) readPump(conn *websocket.Conn) {
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error { conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 	for {
-		mt, message, err := client.conn.ReadMessage()
+		mt, message, err := conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Errorf("error: %v", err)
@@ -103,58 +413,114 @@ func (client *Client) readPump() {
 			break
 		}
 
-		if client.handler != nil {
-			client.handler(mtConverts[mt], message)
+		handler := client.messageHandler()
+		if handler == nil && client.waitHandler {
+			select {
+			case <-client.handlerSet:
+				handler = client.messageHandler()
+			case <-client.ctx.Done():
+				return
+			}
+		}
+
+		if handler != nil {
+			handler(mtConverts[mt], message)
 		}
 	}
 }
 
-func (client *Client) writePump() {
+func (client *Client) writePump(conn *websocket.Conn, stop chan struct{}) {
+	var mt = websocket.BinaryMessage
+	if client.TextMessages {
+		mt = websocket.TextMessage
+	}
+
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
 		ticker.Stop()
-		client.conn.Close()
+		conn.Close()
 	}()
-	for {
-		select {
-		case message, ok := <-client.send:
-			client.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if !ok {
-				// The hub closed the channel.
-				client.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
-
-			w, err := client.conn.NextWriter(websocket.BinaryMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
 
-			// Add queued chat messages to the current websocket message.
-			n := len(client.send)
-			for i := 0; i < n; i++ {
-				// w.Write(newline)
-				w.Write(<-client.send)
-			}
+	if client.retry != nil {
+		conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := conn.WriteMessage(mt, client.retry); err != nil {
+			log.Errorf("stream_client: write message error %s", err)
+			return
+		}
+		client.retry = nil
+	}
 
-			if err := w.Close(); err != nil {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-client.ctx.Done():
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return
+		case message := <-client.send:
+			// 每条消息单独一帧，接收方每次读取的都是一条完整的消息
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(mt, message); err != nil {
+				// 对方可能已经收到，重连后重新发送，消息至少投递一次
+				log.Errorf("stream_client: write message error %s", err)
+				client.retry = message
 				return
 			}
 		case <-ticker.C:
-			client.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := client.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
 		}
 	}
 }
 
+// Send 把消息放入发送队列，队列满时等待 SendTimeout 后返回 ErrSendQueueFull
 func (client *Client) Send(b []byte) (int, error) {
-	client.send <- b
-	return len(b), nil
+	if client.closed() {
+		return 0, ErrClosed
+	}
+
+	select {
+	case client.send <- b:
+		return len(b), nil
+	default:
+	}
+
+	if client.SendTimeout <= 0 {
+		return 0, ErrSendQueueFull
+	}
+
+	timer := time.NewTimer(client.SendTimeout)
+	defer timer.Stop()
+
+	select {
+	case client.send <- b:
+		return len(b), nil
+	case <-client.ctx.Done():
+		return 0, ErrClosed
+	case <-timer.C:
+		return 0, ErrSendQueueFull
+	}
 }
 
 func (client *Client) Message(fn MessageFunc) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if fn != nil {
+		select {
+		case <-client.handlerSet:
+		default:
+			close(client.handlerSet)
+		}
+	}
 	client.handler = fn
 }
+
+func (client *Client) messageHandler() MessageFunc {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+	return client.handler
+}
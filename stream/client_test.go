@@ -1,12 +1,17 @@
 package stream
 
 import (
+	"bytes"
+	"compress/flate"
+	"fmt"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/tj/assert"
 )
 
@@ -51,3 +56,291 @@ func TestClient_Connect(t *testing.T) {
 	})
 	time.Sleep(300 * time.Millisecond)
 }
+
+// echoServer 回显收到的消息, drop 关闭当前所有连接
+func echoServer(t *testing.T) (ts *httptest.Server, drop func()) {
+	var (
+		mu    sync.Mutex
+		conns []*Server
+	)
+
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serve, err := Upgrade(w, r)
+		if err != nil {
+			t.Errorf("upgrade error %s", err)
+			return
+		}
+
+		serve.Message(func(_ MessageType, msg []byte) {
+			serve.Send(msg)
+		})
+
+		mu.Lock()
+		conns = append(conns, serve)
+		mu.Unlock()
+	}))
+
+	drop = func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, serve := range conns {
+			serve.Close()
+		}
+		conns = nil
+	}
+	return ts, drop
+}
+
+func waitState(t *testing.T, ch chan State, want State) {
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case st := <-ch:
+			if st == want {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("wait state %s timeout", want)
+		}
+	}
+}
+
+func TestClient_Reconnect(t *testing.T) {
+	ts, drop := echoServer(t)
+	defer ts.Close()
+
+	client, err := NewClient(ts.URL, WithBackoff(10*time.Millisecond, 50*time.Millisecond))
+	assert.NoError(t, err)
+	defer client.Close()
+
+	var (
+		states = make(chan State, 16)
+		hooks  = make(chan struct{}, 4)
+		recv   = make(chan []byte, 4)
+	)
+	client.OnState(func(st State) { states <- st })
+	client.OnConnect(func() error {
+		hooks <- struct{}{}
+		return nil
+	})
+	client.Message(func(_ MessageType, msg []byte) { recv <- msg })
+	assert.Equal(t, client.State(), StateConnected)
+
+	drop()
+	waitState(t, states, StateDisconnected)
+	waitState(t, states, StateConnected)
+
+	select {
+	case <-hooks:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("wait connect hook timeout")
+	}
+
+	// 重连之后的连接可以继续收发
+	client.Send([]byte("after reconnect"))
+	select {
+	case msg := <-recv:
+		assert.Equal(t, msg, []byte("after reconnect"))
+	case <-time.After(3 * time.Second):
+		t.Fatalf("wait echo timeout")
+	}
+}
+
+func TestClient_SendQueueFull(t *testing.T) {
+	ts, drop := echoServer(t)
+
+	client, err := NewClient(ts.URL, WithBackoff(time.Hour, time.Hour), WithSendQueue(2), WithSendTimeout(10*time.Millisecond))
+	assert.NoError(t, err)
+	defer client.Close()
+
+	var states = make(chan State, 16)
+	client.OnState(func(st State) { states <- st })
+
+	// 断线期间消息留在队列中，队列满后 Send 不会一直阻塞
+	drop()
+	ts.Close()
+	waitState(t, states, StateDisconnected)
+
+	_, err = client.Send([]byte("1"))
+	assert.NoError(t, err)
+	_, err = client.Send([]byte("2"))
+	assert.NoError(t, err)
+	_, err = client.Send([]byte("3"))
+	assert.Equal(t, err, ErrSendQueueFull)
+}
+
+func TestClient_Close(t *testing.T) {
+	ts, _ := echoServer(t)
+	defer ts.Close()
+
+	client, err := NewClient(ts.URL)
+	assert.NoError(t, err)
+
+	var done = make(chan struct{})
+	go func() {
+		client.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("close timeout")
+	}
+
+	assert.Equal(t, client.State(), StateClosed)
+	_, err = client.Send([]byte("closed"))
+	assert.Equal(t, err, ErrClosed)
+}
+
+// collectServer 记录收到的每条消息
+func collectServer(t *testing.T, opts ...ClientOpt) (*httptest.Server, chan []byte, chan *Server) {
+	var (
+		msgs  = make(chan []byte, 128)
+		conns = make(chan *Server, 1)
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serve, err := Upgrade(w, r, opts...)
+		if err != nil {
+			t.Errorf("upgrade error %s", err)
+			return
+		}
+
+		serve.Message(func(_ MessageType, msg []byte) {
+			msgs <- msg
+		})
+		conns <- serve
+	}))
+	return ts, msgs, conns
+}
+
+func TestClient_OneMessagePerFrame(t *testing.T) {
+	ts, msgs, _ := collectServer(t)
+	defer ts.Close()
+
+	client, err := NewClient(ts.URL)
+	assert.NoError(t, err)
+	defer client.Close()
+
+	// 连续发送的消息不会合并到同一帧
+	for i := 0; i < 50; i++ {
+		client.Send([]byte(fmt.Sprintf("message %d", i)))
+	}
+
+	for i := 0; i < 50; i++ {
+		select {
+		case msg := <-msgs:
+			assert.Equal(t, string(msg), fmt.Sprintf("message %d", i))
+		case <-time.After(3 * time.Second):
+			t.Fatalf("wait message %d timeout", i)
+		}
+	}
+}
+
+func TestClient_RetryFailedWrite(t *testing.T) {
+	ts, msgs, _ := collectServer(t)
+	defer ts.Close()
+
+	var (
+		client = newClient()
+		url    = "ws" + ts.URL[len("http"):]
+	)
+
+	// 写入已经断开的连接失败，消息留到下一个连接发送
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.NoError(t, err)
+	conn.Close()
+	client.send <- []byte("lost")
+	client.writePump(conn, make(chan struct{}))
+	assert.Equal(t, client.retry, []byte("lost"))
+
+	conn, _, err = websocket.DefaultDialer.Dial(url, nil)
+	assert.NoError(t, err)
+	stop := make(chan struct{})
+	defer close(stop)
+	go client.writePump(conn, stop)
+
+	select {
+	case msg := <-msgs:
+		assert.Equal(t, string(msg), "lost")
+	case <-time.After(3 * time.Second):
+		t.Fatalf("wait retry message timeout")
+	}
+}
+
+func TestClient_MaxMessageSize(t *testing.T) {
+	ts, msgs, _ := collectServer(t, WithMaxMessageSize(16))
+	defer ts.Close()
+
+	client, err := NewClient(ts.URL, WithBackoff(time.Hour, time.Hour))
+	assert.NoError(t, err)
+	defer client.Close()
+
+	var states = make(chan State, 16)
+	client.OnState(func(st State) { states <- st })
+
+	client.Send([]byte("small"))
+	assert.Equal(t, string(<-msgs), "small")
+
+	// 超过长度限制的消息使服务端断开连接
+	client.Send(bytes.Repeat([]byte("x"), 64))
+	waitState(t, states, StateDisconnected)
+}
+
+func TestClient_Compression(t *testing.T) {
+	ts, msgs, conns := collectServer(t, WithCompression(0))
+	defer ts.Close()
+
+	client, err := NewClient(ts.URL, WithCompression(flate.BestCompression), WithMaxMessageSize(1<<20))
+	assert.NoError(t, err)
+	defer client.Close()
+
+	serve := <-conns
+	var replies = make(chan []byte, 1)
+	client.Message(func(_ MessageType, msg []byte) { replies <- msg })
+
+	var large = bytes.Repeat([]byte("edgekv "), 4096)
+	client.Send(large)
+	assert.Equal(t, <-msgs, large)
+
+	serve.Send([]byte("reply"))
+	select {
+	case msg := <-replies:
+		assert.Equal(t, string(msg), "reply")
+	case <-time.After(3 * time.Second):
+		t.Fatalf("wait reply timeout")
+	}
+}
+
+func TestServer_MessageBeforeHandler(t *testing.T) {
+	var msgs = make(chan []byte, 8)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serve, err := Upgrade(w, r)
+		if err != nil {
+			t.Errorf("upgrade error %s", err)
+			return
+		}
+
+		// 客户端连接后立即发送，回调在之后才设置
+		time.Sleep(200 * time.Millisecond)
+		serve.Message(func(_ MessageType, msg []byte) {
+			msgs <- msg
+		})
+	}))
+	defer ts.Close()
+
+	client, err := NewClient(ts.URL)
+	assert.NoError(t, err)
+	defer client.Close()
+
+	client.Send([]byte("hello"))
+
+	select {
+	case msg := <-msgs:
+		assert.Equal(t, string(msg), "hello")
+	case <-time.After(3 * time.Second):
+		t.Fatal("message before handler was dropped")
+	}
+}
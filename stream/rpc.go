@@ -0,0 +1,265 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hysios/log"
+)
+
+var (
+	// DefaultCallTimeout 没有设置截止时间的调用等待回复的最长时间
+	DefaultCallTimeout = 10 * time.Second
+
+	ErrDisconnected  = errors.New("stream_rpc: connection lost")
+	ErrUnknownMethod = errors.New("stream_rpc: unknown method")
+)
+
+// Conn RPC 使用的消息流, Client 与 Server 都实现了它
+type Conn interface {
+	Message(fn MessageFunc)
+	Send([]byte) (int, error)
+	OnState(fn func(State))
+}
+
+// rpcFrame 请求与回复的帧，用 gob 编码
+type rpcFrame struct {
+	ID     uint64
+	Method string
+	Reply  bool
+	Error  string
+	Body   []byte
+}
+
+type callResult struct {
+	frame rpcFrame
+	err   error
+}
+
+// RemoteError 对方处理请求时返回的错误
+type RemoteError struct {
+	Method  string
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("stream_rpc: %s: %s", e.Method, e.Message)
+}
+
+// Is 让 errors.Is(err, ErrUnknownMethod) 对对方返回的未知方法错误成立
+func (e *RemoteError) Is(target error) bool {
+	return target == ErrUnknownMethod && e.Message == ErrUnknownMethod.Error()
+}
+
+// Request 收到的请求
+type Request struct {
+	Method string
+	body   []byte
+}
+
+// Decode 把请求的参数解码到 v
+func (req *Request) Decode(v interface{}) error {
+	return decodeBody(req.body, v)
+}
+
+// HandlerFunc 处理请求，返回的结果编码后回复给调用方
+type HandlerFunc func(ctx context.Context, req *Request) (interface{}, error)
+
+// RPC 消息流上的请求/回复，每个请求有唯一的 ID, 可以同时进行多个调用，
+// 双方都可以注册方法并调用对方的方法
+type RPC struct {
+	Timeout time.Duration
+
+	conn     Conn
+	mu       sync.Mutex
+	nextID   uint64
+	pending  map[uint64]chan callResult
+	handlers map[string]HandlerFunc
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// NewRPC 在消息流上创建 RPC, 之后消息流的消息都由 RPC 处理
+func NewRPC(conn Conn) *RPC {
+	var rpc = &RPC{
+		Timeout:  DefaultCallTimeout,
+		conn:     conn,
+		pending:  make(map[uint64]chan callResult),
+		handlers: make(map[string]HandlerFunc),
+	}
+	rpc.ctx, rpc.cancel = context.WithCancel(context.Background())
+
+	conn.Message(rpc.receive)
+	conn.OnState(func(state State) {
+		switch state {
+		case StateDisconnected:
+			// 断开的连接上的回复不会再到达
+			rpc.fail(ErrDisconnected)
+		case StateClosed:
+			rpc.fail(ErrClosed)
+			rpc.cancel()
+		}
+	})
+	return rpc
+}
+
+// Handle 注册方法
+func (rpc *RPC) Handle(method string, fn HandlerFunc) {
+	rpc.mu.Lock()
+	defer rpc.mu.Unlock()
+	rpc.handlers[method] = fn
+}
+
+// Call 调用对方的方法并等待回复，结果解码到 reply, reply 为 nil 时忽略结果
+func (rpc *RPC) Call(ctx context.Context, method string, args, reply interface{}) error {
+	body, err := encodeBody(args)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := ctx.Deadline(); !ok && rpc.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rpc.Timeout)
+		defer cancel()
+	}
+
+	var ch = make(chan callResult, 1)
+	rpc.mu.Lock()
+	rpc.nextID++
+	id := rpc.nextID
+	rpc.pending[id] = ch
+	rpc.mu.Unlock()
+
+	defer func() {
+		rpc.mu.Lock()
+		delete(rpc.pending, id)
+		rpc.mu.Unlock()
+	}()
+
+	if err = rpc.send(rpcFrame{ID: id, Method: method, Body: body}); err != nil {
+		return err
+	}
+
+	select {
+	case res := <-ch:
+		if res.err != nil {
+			return res.err
+		}
+
+		if len(res.frame.Error) > 0 {
+			return &RemoteError{Method: method, Message: res.frame.Error}
+		}
+
+		if reply != nil && len(res.frame.Body) > 0 {
+			return decodeBody(res.frame.Body, reply)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("stream_rpc: call %s: %w", method, ctx.Err())
+	}
+}
+
+func (rpc *RPC) send(frame rpcFrame) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(frame); err != nil {
+		return fmt.Errorf("stream_rpc: encode frame error: %w", err)
+	}
+
+	_, err := rpc.conn.Send(buf.Bytes())
+	return err
+}
+
+// receive 处理收到的帧，每个消息是一个帧
+func (rpc *RPC) receive(mt MessageType, msg []byte) {
+	var frame rpcFrame
+	if err := gob.NewDecoder(bytes.NewReader(msg)).Decode(&frame); err != nil {
+		log.Errorf("stream_rpc: decode frame error %s", err)
+		return
+	}
+
+	if frame.Reply {
+		rpc.deliver(frame)
+	} else {
+		go rpc.serve(frame)
+	}
+}
+
+func (rpc *RPC) deliver(frame rpcFrame) {
+	rpc.mu.Lock()
+	ch, ok := rpc.pending[frame.ID]
+	delete(rpc.pending, frame.ID)
+	rpc.mu.Unlock()
+
+	if !ok {
+		log.Debugf("stream_rpc: drop reply of request %d", frame.ID)
+		return
+	}
+	ch <- callResult{frame: frame}
+}
+
+func (rpc *RPC) serve(req rpcFrame) {
+	var reply = rpcFrame{ID: req.ID, Reply: true}
+
+	rpc.mu.Lock()
+	fn, ok := rpc.handlers[req.Method]
+	rpc.mu.Unlock()
+
+	if !ok {
+		reply.Error = ErrUnknownMethod.Error()
+	} else if result, err := rpc.call(fn, req); err != nil {
+		reply.Error = err.Error()
+	} else if result != nil {
+		if reply.Body, err = encodeBody(result); err != nil {
+			reply.Error = err.Error()
+		}
+	}
+
+	if err := rpc.send(reply); err != nil {
+		log.Errorf("stream_rpc: reply %s error %s", req.Method, err)
+	}
+}
+
+func (rpc *RPC) call(fn HandlerFunc, req rpcFrame) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return fn(rpc.ctx, &Request{Method: req.Method, body: req.Body})
+}
+
+// fail 以 err 结束所有等待回复的调用
+func (rpc *RPC) fail(err error) {
+	rpc.mu.Lock()
+	defer rpc.mu.Unlock()
+
+	for id, ch := range rpc.pending {
+		ch <- callResult{err: err}
+		delete(rpc.pending, id)
+	}
+}
+
+func encodeBody(v interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, fmt.Errorf("stream_rpc: encode body error: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeBody(b []byte, v interface{}) error {
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(v); err != nil {
+		return fmt.Errorf("stream_rpc: decode body error: %w", err)
+	}
+	return nil
+}
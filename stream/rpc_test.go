@@ -0,0 +1,113 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tj/assert"
+)
+
+type addArgs struct {
+	A, B int
+}
+
+// rpcServer 提供 add, fail, slow 三个方法
+func rpcServer(t *testing.T) (*httptest.Server, chan *Server) {
+	var conns = make(chan *Server, 4)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serve, err := Upgrade(w, r)
+		if err != nil {
+			t.Errorf("upgrade error %s", err)
+			return
+		}
+
+		rpc := NewRPC(serve)
+		rpc.Handle("add", func(ctx context.Context, req *Request) (interface{}, error) {
+			var args addArgs
+			if err := req.Decode(&args); err != nil {
+				return nil, err
+			}
+			return args.A + args.B, nil
+		})
+		rpc.Handle("fail", func(ctx context.Context, req *Request) (interface{}, error) {
+			return nil, errors.New("boom")
+		})
+		rpc.Handle("slow", func(ctx context.Context, req *Request) (interface{}, error) {
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+			}
+			return nil, nil
+		})
+		conns <- serve
+	}))
+	return ts, conns
+}
+
+func TestRPC_Call(t *testing.T) {
+	ts, _ := rpcServer(t)
+	defer ts.Close()
+
+	client, err := NewClient(ts.URL)
+	assert.NoError(t, err)
+	defer client.Close()
+
+	rpc := NewRPC(client)
+
+	// 同时进行的调用按请求 ID 收到各自的回复
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var sum int
+			assert.NoError(t, rpc.Call(context.Background(), "add", addArgs{A: i, B: 1}, &sum))
+			assert.Equal(t, sum, i+1, fmt.Sprintf("call %d", i))
+		}(i)
+	}
+	wg.Wait()
+
+	err = rpc.Call(context.Background(), "fail", nil, nil)
+	var remote *RemoteError
+	assert.True(t, errors.As(err, &remote))
+	assert.Equal(t, remote.Message, "boom")
+
+	assert.True(t, errors.Is(rpc.Call(context.Background(), "nothing", nil, nil), ErrUnknownMethod))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.True(t, errors.Is(rpc.Call(ctx, "slow", nil, nil), context.DeadlineExceeded))
+}
+
+func TestRPC_Disconnected(t *testing.T) {
+	ts, conns := rpcServer(t)
+	defer ts.Close()
+
+	client, err := NewClient(ts.URL, WithBackoff(time.Hour, time.Hour))
+	assert.NoError(t, err)
+	defer client.Close()
+
+	rpc := NewRPC(client)
+	serve := <-conns
+
+	var done = make(chan error, 1)
+	go func() {
+		done <- rpc.Call(context.Background(), "slow", nil, nil)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	serve.Close()
+
+	select {
+	case err := <-done:
+		assert.Equal(t, err, ErrDisconnected)
+	case <-time.After(3 * time.Second):
+		t.Fatalf("pending call not failed after disconnect")
+	}
+}
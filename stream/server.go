@@ -11,19 +11,41 @@ var upgrader = websocket.Upgrader{
 	WriteBufferSize: 1024,
 }
 
+// Server 服务端的消息流，连接断开后不会重连，之后的 Send 返回 ErrClosed
 type Server struct {
 	*Client
 }
 
-func Upgrade(w http.ResponseWriter, r *http.Request) (*Server, error) {
-	var serve = &Server{}
+// Upgrade 把请求升级为消息流, opts 中的连接选项 (消息长度、缓冲、压缩) 同样适用于服务端;
+// 调用 Message 设置回调之前收到的消息等待回调设置之后处理
+func Upgrade(w http.ResponseWriter, r *http.Request, opts ...ClientOpt) (*Server, error) {
+	var serve = &Server{Client: newClient()}
+	serve.waitHandler = true
+	for _, opt := range opts {
+		opt(serve.Client)
+	}
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+	var up = upgrader
+	if serve.ReadBufferSize > 0 {
+		up.ReadBufferSize = serve.ReadBufferSize
+	}
+	if serve.WriteBufferSize > 0 {
+		up.WriteBufferSize = serve.WriteBufferSize
+	}
+	up.EnableCompression = serve.Compression
+
+	conn, err := up.Upgrade(w, r, nil)
 	if err != nil {
 		return nil, err
 	}
-	serve.Client = &Client{conn: conn, send: make(chan []byte, 256)}
-	go serve.readPump()
-	go serve.writePump()
+
+	serve.setState(StateConnected)
+	serve.wg.Add(1)
+	go func() {
+		defer serve.wg.Done()
+		serve.serve(conn)
+		serve.shutdown()
+		serve.setState(StateClosed)
+	}()
 	return serve, nil
 }
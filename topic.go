@@ -1,7 +1,153 @@
 package edgekv
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// 主题的方向，每个边缘节点的命名空间下分为上行与下行两部分，
+// 代理的 ACL 只需要允许设备发布 {ns}/up/# 并订阅 {ns}/down/#
+const (
+	DirUp   = "up"
+	DirDown = "down"
+)
+
+// 边缘节点与中心之间使用的主题名称
+const (
+	TopicSync   = "sync"
+	TopicBinder = "binder"
+	TopicBind   = "bind"
+	// TopicDesired 每个模型一个保留消息主题，例如 edgekv/EDGE1/down/desired/test
+	TopicDesired = "desired"
+)
+
+const edgeMarker = "EDGEKVEDGEID"
+
+type topicTemplate struct {
+	tpl *template.Template
+	re  *regexp.Regexp
+}
+
+var (
+	topicTpl *topicTemplate
+	topicMu  sync.RWMutex
+)
 
 func Edgekey(edgeID EdgeID, key string) string {
 	return fmt.Sprintf("%s:%s", edgeID, key)
 }
+
+// SetTopicPattern 设置边缘节点主题命名空间的模板, {{ .EdgeID }} 必须单独占据一层，
+// 这样中心可以用 + 通配所有的边缘节点
+func SetTopicPattern(pattern string) error {
+	tpl, err := parseTopicPattern(pattern)
+	if err != nil {
+		return err
+	}
+
+	topicMu.Lock()
+	defer topicMu.Unlock()
+	TopicPattern = pattern
+	topicTpl = tpl
+	return nil
+}
+
+func parseTopicPattern(pattern string) (*topicTemplate, error) {
+	tpl, err := template.New("edgekv").Parse(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("edgekv: parse topic pattern error: %w", err)
+	}
+
+	var (
+		t     = &topicTemplate{tpl: tpl}
+		ns    = t.execute(edgeMarker)
+		count int
+	)
+
+	for _, s := range strings.Split(ns, "/") {
+		if s == edgeMarker {
+			count++
+		} else if strings.Contains(s, edgeMarker) {
+			count = -1
+			break
+		}
+	}
+
+	if count != 1 {
+		return nil, errors.New("edgekv: topic pattern must contain {{ .EdgeID }} as one whole level")
+	}
+
+	expr := strings.Replace(regexp.QuoteMeta(ns), edgeMarker, `([^/]+)`, 1)
+	t.re = regexp.MustCompile(`^` + expr + `/(` + DirUp + `|` + DirDown + `)/(.+)$`)
+	return t, nil
+}
+
+func (t *topicTemplate) execute(id EdgeID) string {
+	var sb strings.Builder
+	t.tpl.Execute(&sb, Map{"EdgeID": id})
+	return sb.String()
+}
+
+// UpWildcard 中心订阅所有边缘节点上行主题的过滤器，例如 edgekv/+/up/sync
+func UpWildcard(name string) string {
+	return EdgeID("+").UpTopic(name)
+}
+
+// DownWildcard 所有边缘节点下行主题的过滤器，例如 edgekv/+/down/sync
+func DownWildcard(name string) string {
+	return EdgeID("+").DownTopic(name)
+}
+
+// ParseTopic 从边缘节点的主题中解析出节点 ID、方向与名称
+func ParseTopic(topic string) (id EdgeID, dir, name string, ok bool) {
+	topicMu.RLock()
+	defer topicMu.RUnlock()
+
+	m := topicTpl.re.FindStringSubmatch(topic)
+	if m == nil {
+		return "", "", "", false
+	}
+	return EdgeID(m[1]), m[2], m[3], true
+}
+
+// MatchTopic 判断 topic 是否匹配 MQTT 风格的订阅过滤器, + 匹配单层, # 匹配剩余的所有层
+func MatchTopic(filter, topic string) bool {
+	var (
+		fs = strings.Split(filter, "/")
+		ts = strings.Split(topic, "/")
+	)
+
+	for i, f := range fs {
+		switch {
+		case f == "#":
+			return true
+		case i >= len(ts):
+			return false
+		case f == "+":
+		case f != ts[i]:
+			return false
+		}
+	}
+
+	return len(fs) == len(ts)
+}
+
+// IsWildcardTopic 判断订阅过滤器中是否包含通配符
+func IsWildcardTopic(filter string) bool {
+	for _, s := range strings.Split(filter, "/") {
+		if s == "+" || s == "#" {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	if err := SetTopicPattern(TopicPattern); err != nil {
+		panic(err)
+	}
+}
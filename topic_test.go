@@ -0,0 +1,53 @@
+package edgekv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEdgeID_Topic(t *testing.T) {
+	var id = EdgeID("EDGE1")
+	assert.Equal(t, "edgekv/EDGE1", id.Topic())
+	assert.Equal(t, "edgekv/EDGE1/up/sync", id.UpTopic(TopicSync))
+	assert.Equal(t, "edgekv/EDGE1/down/bind", id.DownTopic(TopicBind))
+	assert.Equal(t, "edgekv/+/up/sync", UpWildcard(TopicSync))
+	assert.Equal(t, "edgekv/+/down/sync", DownWildcard(TopicSync))
+	assert.True(t, MatchTopic(UpWildcard(TopicSync), id.UpTopic(TopicSync)))
+	assert.False(t, MatchTopic(UpWildcard(TopicSync), id.DownTopic(TopicSync)))
+}
+
+func TestParseTopic(t *testing.T) {
+	id, dir, name, ok := ParseTopic("edgekv/EDGE1/up/sync")
+	assert.True(t, ok)
+	assert.Equal(t, EdgeID("EDGE1"), id)
+	assert.Equal(t, DirUp, dir)
+	assert.Equal(t, TopicSync, name)
+
+	_, _, name, ok = ParseTopic("edgekv/EDGE1/down/bind/get")
+	assert.True(t, ok)
+	assert.Equal(t, "bind/get", name)
+
+	for _, topic := range []string{"sync", "edgekv/EDGE1/sync", "other/EDGE1/up/sync", "edgekv/EDGE1/up"} {
+		_, _, _, ok = ParseTopic(topic)
+		assert.False(t, ok, topic)
+	}
+}
+
+func TestSetTopicPattern(t *testing.T) {
+	defer SetTopicPattern(TopicPattern)
+
+	assert.NoError(t, SetTopicPattern("tenant/a.b/devices/{{ .EdgeID }}"))
+	assert.Equal(t, "tenant/a.b/devices/EDGE1/up/sync", EdgeID("EDGE1").UpTopic(TopicSync))
+
+	id, _, _, ok := ParseTopic("tenant/a.b/devices/EDGE1/up/sync")
+	assert.True(t, ok)
+	assert.Equal(t, EdgeID("EDGE1"), id)
+
+	_, _, _, ok = ParseTopic("tenant/aXb/devices/EDGE1/up/sync")
+	assert.False(t, ok)
+
+	assert.Error(t, SetTopicPattern("edgekv/dev-{{ .EdgeID }}"))
+	assert.Error(t, SetTopicPattern("edgekv"))
+	assert.Error(t, SetTopicPattern("edgekv/{{ .EdgeID"))
+}
@@ -0,0 +1,170 @@
+package edgekv
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hysios/mapindex"
+	"github.com/mitchellh/mapstructure"
+)
+
+// DecoderConfigOption 修改 Unmarshal 使用的 mapstructure 配置，例如更换结构体标签
+type DecoderConfigOption func(*mapstructure.DecoderConfig)
+
+// DecodeHook 替换默认的转换函数
+func DecodeHook(hook mapstructure.DecodeHookFunc) DecoderConfigOption {
+	return func(c *mapstructure.DecoderConfig) {
+		c.DecodeHook = hook
+	}
+}
+
+// TagName 使用其他的结构体标签，默认为 mapstructure
+func TagName(name string) DecoderConfigOption {
+	return func(c *mapstructure.DecoderConfig) {
+		c.TagName = name
+	}
+}
+
+// UnmarshalKey 把 key 的值解码到 rawVal, 默认值中的字段补充存储中没有的字段
+func (a *accessor) UnmarshalKey(key string, rawVal interface{}, opts ...DecoderConfigOption) error {
+	var input interface{}
+	if a.defaults != nil {
+		input = mapindex.Get(a.defaults, key)
+	}
+
+	if v, ok := a.getter.Get(key); ok {
+		if m, ok := v.(map[string]interface{}); ok {
+			def, _ := input.(map[string]interface{})
+			input = mergeSettings(mergeSettings(make(map[string]interface{}), def), m)
+		} else {
+			input = v
+		}
+	}
+
+	return decode(input, decoderConfig(rawVal, opts...))
+}
+
+// Unmarshal 把所有的键值解码到 rawVal
+func (a *accessor) Unmarshal(rawVal interface{}, opts ...DecoderConfigOption) error {
+	return decode(a.settings(), decoderConfig(rawVal, opts...))
+}
+
+// UnmarshalExact 与 Unmarshal 相同，存在 rawVal 中没有的字段时返回错误
+func (a *accessor) UnmarshalExact(rawVal interface{}, opts ...DecoderConfigOption) error {
+	config := decoderConfig(rawVal, opts...)
+	config.ErrorUnused = true
+	return decode(a.settings(), config)
+}
+
+// settings 按键的层级展开所有的值，并合并默认值
+func (a *accessor) settings() map[string]interface{} {
+	var values = make(map[string]interface{})
+	for _, key := range a.getter.Keys() {
+		if v, ok := a.getter.Get(key); ok {
+			mapindex.Set2(values, key, v)
+		}
+	}
+
+	return mergeSettings(mergeSettings(make(map[string]interface{}), a.defaults), values)
+}
+
+// mergeSettings 把 src 合并到 dst, 对象逐层合并，其他的值覆盖; 返回的结果不引用 src 中的对象
+func mergeSettings(dst, src map[string]interface{}) map[string]interface{} {
+	for k, v := range src {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			dst[k] = v
+			continue
+		}
+
+		sub, ok := dst[k].(map[string]interface{})
+		if !ok {
+			sub = make(map[string]interface{})
+		}
+		dst[k] = mergeSettings(sub, m)
+	}
+	return dst
+}
+
+func decoderConfig(output interface{}, opts ...DecoderConfigOption) *mapstructure.DecoderConfig {
+	c := &mapstructure.DecoderConfig{
+		Result:           output,
+		WeaklyTypedInput: true,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToTimeHookFunc(time.RFC3339),
+			StringToSizeHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func decode(input interface{}, config *mapstructure.DecoderConfig) error {
+	decoder, err := mapstructure.NewDecoder(config)
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(input)
+}
+
+// StringToSizeHookFunc 把带单位的大小转换为整数，例如 "512kb" 与 "16MB"
+func StringToSizeHookFunc() mapstructure.DecodeHookFunc {
+	return func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String {
+			return data, nil
+		}
+
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			return data, nil
+		}
+
+		s := data.(string)
+		if _, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+			return data, nil
+		}
+
+		size, ok := parseSizeInBytes(s)
+		if !ok {
+			return data, nil
+		}
+		return size, nil
+	}
+}
+
+// parseSizeInBytes 解析 b, kb, mb, gb 为单位的大小，单位不区分大小写，可以省略 b; 超出 uint 的范围时返回 false
+func parseSizeInBytes(s string) (uint, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if v, err := strconv.ParseUint(s, 10, strconv.IntSize); err == nil {
+		return uint(v), true
+	}
+
+	var multiplier uint = 1
+	s = strings.TrimSuffix(s, "b")
+	switch {
+	case strings.HasSuffix(s, "k"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(s, "m"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(s, "g"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+
+	v, err := strconv.ParseUint(strings.TrimSpace(s), 10, strconv.IntSize)
+	// 乘以单位后超出 uint 的范围
+	if err != nil || v > uint64(^uint(0)/multiplier) {
+		return 0, false
+	}
+	return uint(v) * multiplier, true
+}
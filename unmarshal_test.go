@@ -0,0 +1,118 @@
+package edgekv
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/hysios/mapindex"
+	"github.com/stretchr/testify/assert"
+)
+
+type mapGetter map[string]interface{}
+
+func (m mapGetter) Get(key string) (interface{}, bool) {
+	val := mapindex.Get(map[string]interface{}(m), key)
+	return val, val != nil
+}
+
+func (m mapGetter) Keys() []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type serverConfig struct {
+	Addr    string
+	Timeout time.Duration
+	Started time.Time `mapstructure:"started_at"`
+	Buffer  uint      `mapstructure:"buffer_size"`
+	Peers   []string
+	Ports   []int
+}
+
+func TestAccessor_UnmarshalKey(t *testing.T) {
+	a := MakeAccessor(mapGetter{
+		"server": map[string]interface{}{
+			"addr":        ":7070",
+			"timeout":     "3s",
+			"started_at":  "2021-05-01T08:00:00Z",
+			"buffer_size": "64kb",
+			"peers":       "gw1,gw2",
+			"ports":       []interface{}{float64(80), "443"},
+		},
+	})
+	a.SetDefault("server.addr", ":80")
+	a.SetDefault("server.peers", []string{"gw0"})
+	a.SetDefault("server.retry", 3)
+
+	var cfg serverConfig
+	assert.NoError(t, a.UnmarshalKey("server", &cfg))
+	assert.Equal(t, serverConfig{
+		Addr:    ":7070",
+		Timeout: 3 * time.Second,
+		Started: time.Date(2021, 5, 1, 8, 0, 0, 0, time.UTC),
+		Buffer:  64 << 10,
+		Peers:   []string{"gw1", "gw2"},
+		Ports:   []int{80, 443},
+	}, cfg)
+
+	// 只有默认值的键
+	var retry int
+	assert.NoError(t, a.UnmarshalKey("server.retry", &retry))
+	assert.Equal(t, 3, retry)
+
+	assert.Error(t, a.UnmarshalKey("server.timeout", new(int)))
+}
+
+func TestAccessor_Unmarshal(t *testing.T) {
+	type config struct {
+		Server serverConfig
+		Debug  bool
+	}
+
+	a := MakeAccessor(mapGetter{
+		"server": map[string]interface{}{"addr": ":7070", "timeout": 1000},
+		"debug":  "true",
+	})
+	a.SetDefault("server.buffer_size", "1MB")
+
+	var cfg config
+	assert.NoError(t, a.Unmarshal(&cfg))
+	assert.Equal(t, ":7070", cfg.Server.Addr)
+	assert.Equal(t, time.Microsecond, cfg.Server.Timeout)
+	assert.Equal(t, uint(1<<20), cfg.Server.Buffer)
+	assert.True(t, cfg.Debug)
+
+	assert.NoError(t, a.UnmarshalExact(&cfg))
+
+	// 存储中有结构体没有的字段
+	a.SetDefault("server.tls", true)
+	assert.Error(t, a.UnmarshalExact(&cfg))
+
+	var tagged struct {
+		Listen string `json:"addr"`
+	}
+	assert.NoError(t, a.UnmarshalKey("server", &tagged, TagName("json")))
+	assert.Equal(t, ":7070", tagged.Listen)
+}
+
+func TestAccessor_GetSizeInBytes(t *testing.T) {
+	a := MakeAccessor(mapGetter{"a": "16 MB", "b": "512k", "c": 100, "d": "x"})
+	assert.Equal(t, uint(16<<20), a.GetSizeInBytes("a"))
+	assert.Equal(t, uint(512<<10), a.GetSizeInBytes("b"))
+	assert.Equal(t, uint(100), a.GetSizeInBytes("c"))
+	assert.Equal(t, uint(0), a.GetSizeInBytes("d"))
+
+	// 超出 uint 的范围
+	_, ok := parseSizeInBytes("18446744073709551615kb")
+	assert.False(t, ok)
+	_, ok = parseSizeInBytes("99999999999999999999")
+	assert.False(t, ok)
+	size, ok := parseSizeInBytes("1gb")
+	assert.True(t, ok)
+	assert.Equal(t, uint(1<<30), size)
+}
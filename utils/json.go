@@ -47,10 +47,10 @@ func Unmarshal(b []byte, val Any) error {
 func init() {
 	gob.Register(time.Time{})
 	gob.Register(map[string]interface{}{})
-	gob.Register(new(time.Duration))
+	// 保持已存储数据的类型名不变，但解码为 time.Duration 值而不是指针
+	gob.RegisterName("*time.Duration", time.Duration(0))
 	gob.Register([]interface{}{})
 	gob.Register(new(interface{}))
-	gob.Register(new(edgekv.MessageChangelog))
 	gob.Register(new(edgekv.Message))
 	gob.Register(new(Any))
 }
@@ -8,4 +8,7 @@ type WatchEvent struct {
 	Done func(bool)
 }
 
-const BinaryMimeType = "application/gob"
+const (
+	BinaryMimeType = "application/gob"
+	JSONMimeType   = "application/json"
+)